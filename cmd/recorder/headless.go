@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+)
+
+// runHeadless records without a window until SIGINT or SIGTERM, printing a
+// status line every statusInterval. SIGUSR1 toggles pause.
+func runHeadless(rec *recorder.Recorder, sessionID int64, statusInterval time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, pauseSignals...)...)
+	defer signal.Stop(signals)
+
+	if err := startRecorder(rec, sessionID); err != nil {
+		return fmt.Errorf("failed to start recording: %w", err)
+	}
+
+	log.Printf("Recording to %s", rec.GetCurrentFile())
+	if len(pauseSignals) > 0 {
+		log.Printf("Pause/resume with: kill -USR1 %d", os.Getpid())
+	}
+	log.Printf("Stop with Ctrl+C or: kill %d", os.Getpid())
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// The recorder stops itself before the disk fills up
+			if rec.GetState() == recorder.StateStopped {
+				log.Printf("Recording stopped (%s)", rec.GetStopReason())
+				return nil
+			}
+			log.Print(statusLine(rec))
+
+		case err := <-rec.Errors():
+			return fmt.Errorf("recording failed: %w", err)
+
+		case sig := <-signals:
+			if isPauseSignal(sig) {
+				togglePause(rec)
+				log.Print(statusLine(rec))
+				continue
+			}
+
+			log.Printf("Received %v, stopping...", sig)
+			duration := rec.GetDuration()
+			if err := rec.Stop(); err != nil {
+				return fmt.Errorf("failed to stop recording: %w", err)
+			}
+			log.Printf("Recording saved (%s)", formatDuration(duration))
+			return nil
+		}
+	}
+}
+
+// startRecorder starts a recording, linked to the session if one was given
+func startRecorder(rec *recorder.Recorder, sessionID int64) error {
+	if sessionID > 0 {
+		return rec.StartForSession(sessionID)
+	}
+	return rec.Start()
+}
+
+// togglePause pauses a running recording or resumes a paused one
+func togglePause(rec *recorder.Recorder) {
+	var err error
+	if rec.GetState() == recorder.StatePaused {
+		err = rec.Resume()
+	} else {
+		err = rec.Pause()
+	}
+	if err != nil {
+		log.Printf("Error toggling pause: %v", err)
+	}
+}
+
+// isPauseSignal reports whether sig is one of the pause signals
+func isPauseSignal(sig os.Signal) bool {
+	for _, pauseSignal := range pauseSignals {
+		if sig == pauseSignal {
+			return true
+		}
+	}
+	return false
+}
+
+// statusLine summarizes the recorder's state for the terminal
+func statusLine(rec *recorder.Recorder) string {
+	state := rec.GetState()
+	levels := rec.GetLevels()
+
+	parts := []string{
+		state.String(),
+		formatDuration(rec.GetDuration()),
+		formatBytes(rec.GetFileSize()),
+		fmt.Sprintf("level %.0f dB (peak %.0f dB)", levels.RMS, levels.Peak),
+	}
+	if rec.IsSkippingSilence() {
+		parts = append(parts, "skipping silence")
+	}
+	if levels.Clipping {
+		parts = append(parts, "CLIPPING")
+	}
+	if state == recorder.StateRecording && levels.SilentFor > silenceWarning {
+		parts = append(parts, fmt.Sprintf("NO AUDIO FOR %s", formatDuration(levels.SilentFor)))
+	}
+	if levels.DroppedBuffers > 0 {
+		parts = append(parts, fmt.Sprintf("DROPPED %d AUDIO BUFFERS", levels.DroppedBuffers))
+	}
+	if disk := rec.GetDiskStatus(); disk.Low {
+		parts = append(parts, fmt.Sprintf("LOW DISK SPACE: %s free", formatBytes(disk.FreeBytes)))
+	}
+
+	return strings.Join(parts, " | ")
+}
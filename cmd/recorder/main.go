@@ -1,8 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -11,13 +13,21 @@ import (
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
 )
 
 const (
-	defaultDataDir = "./data"
+	// meterFloor is the level, in dBFS, at which the VU meter reads empty
+	meterFloor = -60.0
+
+	// silenceWarning is how long the input may stay silent while recording
+	// before the UI warns about it
+	silenceWarning = 60 * time.Second
 )
 
 type RecorderUI struct {
@@ -28,14 +38,33 @@ type RecorderUI struct {
 	durationText binding.String
 	filenameText binding.String
 	filesizeText binding.String
+	levelValue   binding.Float
+	levelText    binding.String
+	clipText     binding.String
+	warningText  binding.String
+	markButton   *widget.Button
 	pauseButton  *widget.Button
 	stopButton   *widget.Button
 	dataDir      string
+	devices      []recorder.Device
+	sessionID    int64
 }
 
 func main() {
+	headless := flag.Bool("headless", false, "record from the terminal without opening a window")
+	sessionID := flag.Int64("session-id", 0, "link the new recording to this game session")
+	statusInterval := flag.Duration("status-interval", 10*time.Second, "how often headless mode prints a status line")
+	flag.Parse()
+
+	// Read the configuration from the environment once
+	settings := config.Load()
+	recorderConfig, err := recorder.NewConfig(settings)
+	if err != nil {
+		log.Printf("Ignoring invalid recorder settings: %v", err)
+	}
+
 	// Ensure data directory exists
-	dataDir := defaultDataDir
+	dataDir := settings.DataDir
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
@@ -43,7 +72,7 @@ func main() {
 	// Initialize database
 	database, err := db.New(db.Config{
 		DataDir: dataDir,
-		DBName:  "dnd_assistant.db",
+		DBName:  settings.DBName,
 	})
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -51,20 +80,65 @@ func main() {
 	defer database.Close()
 
 	recordingRepo := db.NewRecordingRepository(database)
+	recorderConfig.DB = recordingRepo
+
+	// Fail before recording anything if the session doesn't exist
+	if *sessionID != 0 {
+		if _, err := db.NewSessionRepository(database).GetByID(*sessionID); err != nil {
+			log.Fatalf("Session %d not found: %v", *sessionID, err)
+		}
+	}
+
+	// Repair recordings left behind by a crash or power loss
+	recovered, err := recorder.RecoverInterrupted(recordingRepo, recorderConfig.Format, recorder.RecoveryGracePeriod)
+	if err != nil {
+		log.Printf("Failed to recover interrupted recordings: %v", err)
+	}
+	for _, res := range recovered {
+		if res.Err != nil {
+			log.Printf("Recovery of recording %d (%s): %v", res.RecordingID, res.FilePath, res.Err)
+			continue
+		}
+		log.Printf("Recovery of recording %d (%s): %s, %ds", res.RecordingID, res.FilePath, res.Status, res.DurationSeconds)
+	}
+
+	// Offer a device picker unless a device is configured or there's no choice
+	var devices []recorder.Device
+	if settings.AudioDeviceID == "" && !*headless {
+		devices, err = recorder.ListDevices()
+		if err != nil {
+			log.Printf("Failed to list capture devices: %v", err)
+		}
+		for _, device := range devices {
+			log.Printf("Capture device %s: %s", device.ID, device.Name)
+		}
+		if len(devices) < 2 {
+			devices = nil
+		}
+	}
 
 	// Create recorder
-	rec := recorder.New(recorder.Config{
-		DataDir: dataDir,
-		Format:  recorder.DefaultAudioFormat(),
-		DB:      recordingRepo,
-	})
+	rec, err := recorder.New(recorderConfig)
+	if err != nil {
+		log.Fatalf("Failed to create recorder: %v", err)
+	}
+
+	// Record from the terminal when there's no display
+	if *headless {
+		if err := runHeadless(rec, *sessionID, *statusInterval); err != nil {
+			log.Printf("Headless recorder failed: %v", err)
+			database.Close()
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Create and run UI
-	ui := NewRecorderUI(rec, dataDir)
+	ui := NewRecorderUI(rec, dataDir, devices, *sessionID)
 	ui.Run()
 }
 
-func NewRecorderUI(rec *recorder.Recorder, dataDir string) *RecorderUI {
+func NewRecorderUI(rec *recorder.Recorder, dataDir string, devices []recorder.Device, sessionID int64) *RecorderUI {
 	a := app.New()
 	w := a.NewWindow("D&D Session Recorder")
 
@@ -81,10 +155,16 @@ func NewRecorderUI(rec *recorder.Recorder, dataDir string) *RecorderUI {
 		window:       w,
 		rec:          rec,
 		dataDir:      dataDir,
+		devices:      devices,
+		sessionID:    sessionID,
 		statusText:   binding.NewString(),
 		durationText: binding.NewString(),
 		filenameText: binding.NewString(),
 		filesizeText: binding.NewString(),
+		levelValue:   binding.NewFloat(),
+		levelText:    binding.NewString(),
+		clipText:     binding.NewString(),
+		warningText:  binding.NewString(),
 	}
 
 	// Initialize bindings
@@ -93,10 +173,66 @@ func NewRecorderUI(rec *recorder.Recorder, dataDir string) *RecorderUI {
 	ui.filenameText.Set("Initializing...")
 	ui.filesizeText.Set("")
 
-	ui.setupUI()
+	ui.setupWindow()
 	return ui
 }
 
+// showDevicePicker lets the user choose a capture device before recording
+// starts
+func (ui *RecorderUI) showDevicePicker() {
+	title := widget.NewLabel("🎙️  Choose a microphone")
+	title.Alignment = fyne.TextAlignCenter
+	title.TextStyle = fyne.TextStyle{Bold: true}
+
+	// Names aren't guaranteed to be unique, so number duplicates
+	options := make([]string, len(ui.devices))
+	byName := make(map[string]recorder.Device, len(ui.devices))
+	selected := ""
+	for i, device := range ui.devices {
+		name := device.Name
+		for n := 2; byName[name].ID != ""; n++ {
+			name = fmt.Sprintf("%s (%d)", device.Name, n)
+		}
+		options[i] = name
+		byName[name] = device
+		if device.IsDefault || selected == "" {
+			selected = name
+		}
+	}
+
+	picker := widget.NewSelect(options, nil)
+	picker.SetSelected(selected)
+
+	startButton := widget.NewButton("⏺️  Start Recording", func() {
+		device := byName[picker.Selected]
+		if err := ui.rec.SetSource(recorder.NewMalgoSource(device.ID)); err != nil {
+			log.Printf("Error selecting device: %v", err)
+			return
+		}
+		ui.startRecording()
+	})
+	startButton.Importance = widget.HighImportance
+
+	ui.window.SetContent(container.NewBorder(
+		title,
+		startButton,
+		nil, nil,
+		container.NewVBox(picker),
+	))
+}
+
+// startRecording starts the recorder and switches to the recording screen
+func (ui *RecorderUI) startRecording() {
+	if err := startRecorder(ui.rec, ui.sessionID); err != nil {
+		log.Fatalf("Failed to start recording: %v", err)
+	}
+
+	ui.setupUI()
+
+	// Start update loop using AfterFunc (runs on main thread)
+	ui.scheduleUpdate()
+}
+
 func (ui *RecorderUI) setupUI() {
 	// Create labels with data binding (thread-safe updates)
 	statusLabel := widget.NewLabelWithData(ui.statusText)
@@ -114,6 +250,27 @@ func (ui *RecorderUI) setupUI() {
 	filesizeLabel := widget.NewLabelWithData(ui.filesizeText)
 	filesizeLabel.Alignment = fyne.TextAlignCenter
 
+	// VU meter: RMS level as a bar, peak level and clipping beside it
+	levelBar := widget.NewProgressBarWithData(ui.levelValue)
+	levelBar.TextFormatter = func() string { return "" }
+
+	levelLabel := widget.NewLabelWithData(ui.levelText)
+
+	clipLabel := widget.NewLabelWithData(ui.clipText)
+	clipLabel.Importance = widget.DangerImportance
+	clipLabel.TextStyle = fyne.TextStyle{Bold: true}
+
+	warningLabel := widget.NewLabelWithData(ui.warningText)
+	warningLabel.Alignment = fyne.TextAlignCenter
+	warningLabel.Importance = widget.DangerImportance
+	warningLabel.TextStyle = fyne.TextStyle{Bold: true}
+	warningLabel.Wrapping = fyne.TextWrapWord
+
+	// Mark button drops a bookmark at the current offset
+	ui.markButton = widget.NewButton("🔖 Mark", func() {
+		ui.addMarker()
+	})
+
 	// Pause button - text updated in togglePause()
 	ui.pauseButton = widget.NewButton("⏸️  Pause", func() {
 		ui.togglePause()
@@ -133,21 +290,28 @@ func (ui *RecorderUI) setupUI() {
 			durationLabel,
 		),
 		// Bottom: Large buttons
-		container.NewGridWithColumns(2,
+		container.NewGridWithColumns(3,
+			ui.markButton,
 			ui.pauseButton,
 			ui.stopButton,
 		),
 		// Left/Right: nil
 		nil, nil,
-		// Center: File info (use full width available)
+		// Center: File info and input level (use full width available)
 		container.NewVBox(
 			filenameLabel,
 			filesizeLabel,
+			container.NewBorder(nil, nil, nil, container.NewHBox(levelLabel, clipLabel), levelBar),
+			warningLabel,
 		),
 	)
 
 	ui.window.SetContent(content)
+}
 
+// setupWindow configures the window itself, independent of which screen it
+// is showing
+func (ui *RecorderUI) setupWindow() {
 	// Don't set a fixed size - let it adapt to the screen
 	// Fullscreen will use the entire available display
 	ui.window.SetFullScreen(true)
@@ -160,14 +324,13 @@ func (ui *RecorderUI) setupUI() {
 }
 
 func (ui *RecorderUI) Run() {
-	// Start recording
-	if err := ui.rec.Start(); err != nil {
-		log.Fatalf("Failed to start recording: %v", err)
+	// Let the user pick a microphone first if there's more than one
+	if len(ui.devices) > 0 {
+		ui.showDevicePicker()
+	} else {
+		ui.startRecording()
 	}
 
-	// Start update loop using AfterFunc (runs on main thread)
-	ui.scheduleUpdate()
-
 	ui.window.ShowAndRun()
 }
 
@@ -177,21 +340,41 @@ func (ui *RecorderUI) scheduleUpdate() {
 		ticker := time.NewTicker(250 * time.Millisecond)
 		defer ticker.Stop()
 
-		for range ticker.C {
+		for {
+			select {
+			case err := <-ui.rec.Errors():
+				ui.statusText.Set("❌ Recording failed")
+				ui.warningText.Set(fmt.Sprintf("⚠️  %v — THE AUDIO UP TO THIS POINT WAS SAVED", err))
+				// Don't schedule next update once the recording failed
+				return
+			case <-ticker.C:
+			}
+
 			state := ui.rec.GetState()
 			duration := ui.rec.GetDuration()
 			currentFile := ui.rec.GetCurrentFile()
 			fileSize := ui.rec.GetFileSize()
+			lastCheckpoint := ui.rec.GetLastCheckpoint()
+			levels := ui.rec.GetLevels()
 
 			// Update status
 			statusText := ""
 			switch state {
 			case recorder.StateRecording:
 				statusText = "⏺️  Recording"
+				if ui.rec.IsSkippingSilence() {
+					statusText = "💤 Skipping silence"
+				}
 			case recorder.StatePaused:
 				statusText = "⏸️  Paused"
+			case recorder.StateFailed:
+				statusText = "❌ Recording failed"
 			case recorder.StateStopped:
-				statusText = "⏹️  Stopped"
+				// The recorder stops itself before the disk fills up
+				if ui.rec.GetStopReason() == models.StopReasonLowDisk {
+					ui.statusText.Set("⏹️  Stopped: disk almost full")
+					ui.warningText.Set("✅ Recording saved. Free up space before recording again.")
+				}
 				// Don't schedule next update if stopped
 				return
 			}
@@ -201,17 +384,37 @@ func (ui *RecorderUI) scheduleUpdate() {
 			var filename, sizeText string
 			if currentFile != "" {
 				filename = filepath.Base(currentFile)
-				sizeText = formatBytes(fileSize)
+				sizeText = fmt.Sprintf("%s • saved %s ago", formatBytes(fileSize), time.Since(lastCheckpoint).Round(time.Second))
 			} else {
 				filename = "Initializing..."
 				sizeText = ""
 			}
 
+			// Input level; a silent mic while paused is expected
+			clipText := ""
+			if levels.Clipping {
+				clipText = "CLIP"
+			}
+			warningText := ""
+			if state == recorder.StateRecording && levels.SilentFor > silenceWarning {
+				warningText = fmt.Sprintf("⚠️  NO AUDIO FOR %s — CHECK THE MICROPHONE", formatDuration(levels.SilentFor))
+			}
+			if levels.DroppedBuffers > 0 {
+				warningText = fmt.Sprintf("⚠️  %d AUDIO BUFFERS DROPPED — THE RECORDING HAS GAPS", levels.DroppedBuffers)
+			}
+			if disk := ui.rec.GetDiskStatus(); disk.Low {
+				warningText = fmt.Sprintf("⚠️  LOW DISK SPACE: %s FREE", formatBytes(disk.FreeBytes))
+			}
+
 			// Update bindings (thread-safe)
 			ui.statusText.Set(statusText)
 			ui.durationText.Set(durationText)
 			ui.filenameText.Set(filename)
 			ui.filesizeText.Set(sizeText)
+			ui.levelValue.Set(meterValue(levels.RMS))
+			ui.levelText.Set(fmt.Sprintf("%3.0f dB", levels.Peak))
+			ui.clipText.Set(clipText)
+			ui.warningText.Set(warningText)
 		}
 	}()
 }
@@ -233,14 +436,40 @@ func (ui *RecorderUI) togglePause() {
 	}
 }
 
+// addMarker bookmarks the current moment straight away, then offers to label
+// it so a slow typist doesn't shift the bookmark
+func (ui *RecorderUI) addMarker() {
+	marker, err := ui.rec.AddMarker("")
+	if err != nil {
+		log.Printf("Error adding marker: %v", err)
+		return
+	}
+
+	offset := time.Duration(marker.OffsetSeconds * float64(time.Second))
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Optional, e.g. Natural 20")
+
+	dialog.ShowForm(fmt.Sprintf("🔖 Marked %s", formatDuration(offset)), "Save", "Skip",
+		[]*widget.FormItem{widget.NewFormItem("Label", entry)},
+		func(save bool) {
+			if !save || entry.Text == "" {
+				return
+			}
+			if err := ui.rec.SetMarkerLabel(marker.ID, entry.Text); err != nil {
+				log.Printf("Error labelling marker: %v", err)
+			}
+		}, ui.window)
+}
+
 func (ui *RecorderUI) stop() {
 	state := ui.rec.GetState()
-	if state == recorder.StateStopped {
+	if state != recorder.StateRecording && state != recorder.StatePaused {
 		ui.app.Quit()
 		return
 	}
 
 	ui.statusText.Set("⏹️  Stopping...")
+	ui.markButton.Disable()
 	ui.pauseButton.Disable()
 	ui.stopButton.Disable()
 
@@ -262,6 +491,11 @@ func (ui *RecorderUI) stop() {
 	}()
 }
 
+// meterValue maps a level in dBFS onto the 0-1 range of the VU meter
+func meterValue(level float64) float64 {
+	return math.Min(math.Max((level-meterFloor)/-meterFloor, 0), 1)
+}
+
 func formatDuration(d time.Duration) string {
 	hours := int(d.Hours())
 	minutes := int(d.Minutes()) % 60
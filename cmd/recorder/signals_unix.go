@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignals toggle pause in headless mode
+var pauseSignals = []os.Signal{syscall.SIGUSR1}
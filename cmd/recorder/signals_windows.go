@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// pauseSignals toggle pause in headless mode. Windows has no SIGUSR1, so a
+// headless recording there can only be stopped.
+var pauseSignals []os.Signal
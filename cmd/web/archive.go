@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+)
+
+const (
+	// defaultArchiveAfterDays is how old a recording must be before the
+	// archive subcommand compresses it, unless ARCHIVE_AFTER_DAYS says
+	// otherwise
+	defaultArchiveAfterDays = 30
+
+	// archiveInterval is how often the server looks for recordings to archive
+	archiveInterval = 24 * time.Hour
+)
+
+// runArchive implements the archive subcommand: it transcodes completed WAV
+// recordings older than -days to FLAC once and reports what it did.
+// archiveAfterDays is the configured default, if any.
+func runArchive(repo *db.RecordingRepository, args []string, archiveAfterDays int) error {
+	if archiveAfterDays <= 0 {
+		archiveAfterDays = defaultArchiveAfterDays
+	}
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	days := flags.Int("days", archiveAfterDays, "archive recordings completed more than this many days ago")
+	flags.Parse(args)
+
+	results, err := recorder.ArchiveRecordings(repo, time.Duration(*days)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	var saved int64
+	for _, res := range results {
+		logArchiveResult(res)
+		saved += res.SavedBytes
+	}
+	fmt.Printf("Archived recordings older than %d days: %d candidates, %.1f MB saved\n", *days, len(results), float64(saved)/(1024*1024))
+	return nil
+}
+
+// archiveLoop archives recordings older than minAge now and then once every
+// archiveInterval. Skipped recordings are only reported by the subcommand,
+// so the log isn't repeated daily.
+func archiveLoop(repo *db.RecordingRepository, minAge time.Duration) {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		results, err := recorder.ArchiveRecordings(repo, minAge)
+		if err != nil {
+			log.Printf("Failed to archive recordings: %v", err)
+		}
+		for _, res := range results {
+			if res.Status != recorder.ArchiveSkipped {
+				logArchiveResult(res)
+			}
+		}
+
+		<-ticker.C
+	}
+}
+
+// logArchiveResult logs the outcome for one recording
+func logArchiveResult(res recorder.ArchiveResult) {
+	if res.Err != nil {
+		log.Printf("Archive of recording %d (%s): %s: %v", res.RecordingID, res.FilePath, res.Status, res.Err)
+		return
+	}
+	log.Printf("Archive of recording %d (%s): %s, %.1f MB saved", res.RecordingID, res.FilePath, res.Status, float64(res.SavedBytes)/(1024*1024))
+}
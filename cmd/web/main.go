@@ -1,27 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/ai"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/api"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
 	"github.com/rs/cors"
 )
 
-const (
-	defaultDataDir = "./data"
-	defaultPort    = "8080"
-)
-
 func main() {
-	// Get configuration from environment
-	dataDir := getEnv("DATA_DIR", defaultDataDir)
-	port := getEnv("PORT", defaultPort)
+	// Read the configuration from the environment once
+	settings := config.Load()
+	dataDir := settings.DataDir
+	port := settings.WebPort
+	recorderConfig, err := recorder.NewConfig(settings)
+	if err != nil {
+		log.Printf("Ignoring invalid recorder settings: %v", err)
+	}
 
 	// Ensure data directory exists
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
@@ -31,7 +39,7 @@ func main() {
 	// Initialize database
 	database, err := db.New(db.Config{
 		DataDir: dataDir,
-		DBName:  "dnd_assistant.db",
+		DBName:  settings.DBName,
 	})
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -39,10 +47,83 @@ func main() {
 	defer database.Close()
 
 	recordingRepo := db.NewRecordingRepository(database)
+	recorderConfig.DB = recordingRepo
+
+	// "web archive" compresses old recordings once and exits
+	if len(os.Args) > 1 && os.Args[1] == "archive" {
+		if err := runArchive(recordingRepo, os.Args[2:], settings.ArchiveAfterDays); err != nil {
+			log.Printf("Archive failed: %v", err)
+			database.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "web schedule" lists or sets the campaigns' weekly game times and exits
+	campaignRepo := db.NewCampaignRepository(database)
+	if len(os.Args) > 1 && os.Args[1] == "schedule" {
+		if err := runSchedule(campaignRepo, os.Args[2:]); err != nil {
+			log.Printf("Schedule failed: %v", err)
+			database.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Repair recordings left behind by a crash or power loss
+	recovered, err := recorder.RecoverInterrupted(recordingRepo, recorderConfig.Format, recorder.RecoveryGracePeriod)
+	if err != nil {
+		log.Printf("Failed to recover interrupted recordings: %v", err)
+	}
+	for _, res := range recovered {
+		if res.Err != nil {
+			log.Printf("Recovery of recording %d (%s): %v", res.RecordingID, res.FilePath, res.Err)
+			continue
+		}
+		log.Printf("Recovery of recording %d (%s): %s, %ds", res.RecordingID, res.FilePath, res.Status, res.DurationSeconds)
+	}
+
+	// Transcriptions that were running when the server stopped won't finish
+	if n, err := recordingRepo.FailInterruptedTranscriptions(); err != nil {
+		log.Printf("Failed to reset interrupted transcriptions: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted transcriptions failed", n)
+	}
+
+	// Compress old recordings in the background when configured to
+	if days := settings.ArchiveAfterDays; days > 0 {
+		go archiveLoop(recordingRepo, time.Duration(days)*24*time.Hour)
+	}
 
 	// Create API
 	apiHandler := api.NewAPI(recordingRepo, dataDir)
 
+	// Optionally host a recorder so the frontend can act as a remote control
+	var rec *recorder.Recorder
+	if settings.RecorderEnabled {
+		rec, err = recorder.New(recorderConfig)
+		if err != nil {
+			log.Fatalf("Failed to create recorder: %v", err)
+		}
+		apiHandler.SetRecorder(rec)
+
+		// Record campaigns at their weekly game time; see "web schedule"
+		scheduler := recorder.NewScheduler(rec, campaignRepo, db.NewSessionRepository(database))
+		go scheduler.Run(nil)
+	}
+
+	// Build the AI services from their configured providers, failing now
+	// rather than on the first transcription if one is misconfigured
+	if settings.AIEnabled {
+		services, err := ai.NewAIService(settings)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		apiHandler.SetAIService(services)
+		log.Printf("AI services: transcription %s, diarization %s, summaries %s, embeddings %s",
+			settings.TranscriptionProvider, settings.DiarizationProvider, settings.SummaryProvider, settings.EmbeddingProvider)
+	}
+
 	// Set up router
 	router := mux.NewRouter()
 
@@ -88,16 +169,33 @@ func main() {
 	fmt.Printf("========================\n\n")
 	fmt.Printf("Server starting on http://localhost%s\n", addr)
 	fmt.Printf("API available at http://localhost%s/api\n", addr)
-	fmt.Printf("Data directory: %s\n\n", absDataDir)
-
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	fmt.Printf("Data directory: %s\n", absDataDir)
+	if rec != nil {
+		fmt.Printf("Recorder: remote control at http://localhost%s/api/recorder\n", addr)
 	}
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	fmt.Println()
+
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	// Save any recording in progress before exiting
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		if rec != nil {
+			if state := rec.GetState(); state == recorder.StateRecording || state == recorder.StatePaused {
+				log.Printf("Stopping recording...")
+				if err := rec.Stop(); err != nil {
+					log.Printf("Failed to stop recording: %v", err)
+				}
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Server failed: %v", err)
 	}
-	return defaultValue
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// runSchedule implements the schedule subcommand. Without -campaign it lists
+// the schedules; with it, it sets or deletes that campaign's weekly game time.
+func runSchedule(campaigns *db.CampaignRepository, args []string) error {
+	flags := flag.NewFlagSet("schedule", flag.ExitOnError)
+	campaignID := flags.Int64("campaign", 0, "campaign to schedule")
+	day := flags.String("day", "", "day of the week the game is played, e.g. friday")
+	at := flags.String("time", "", "time the game starts, HH:MM in the server's time zone")
+	maxDuration := flags.Duration("max", recorder.DefaultScheduleMaxDuration, "stop recording after this long")
+	silence := flags.Duration("silence", recorder.DefaultScheduleSilence, "stop recording after this much silence")
+	disable := flags.Bool("disable", false, "keep the schedule but don't record")
+	remove := flags.Bool("delete", false, "delete the campaign's schedule")
+	flags.Parse(args)
+
+	if *campaignID == 0 {
+		return listSchedules(campaigns)
+	}
+	if *remove {
+		if err := campaigns.DeleteSchedule(*campaignID); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted schedule of campaign %d\n", *campaignID)
+		return nil
+	}
+
+	weekday, err := parseWeekday(*day)
+	if err != nil {
+		return err
+	}
+	if _, _, err := recorder.ParseStartTime(*at); err != nil {
+		return err
+	}
+	if _, err := campaigns.GetByID(*campaignID); err != nil {
+		return err
+	}
+
+	schedule, err := campaigns.SetSchedule(models.SetCampaignScheduleParams{
+		CampaignID:            *campaignID,
+		Weekday:               weekday,
+		StartTime:             *at,
+		MaxDurationSeconds:    int(maxDuration.Seconds()),
+		SilenceTimeoutSeconds: int(silence.Seconds()),
+		Enabled:               !*disable,
+	})
+	if err != nil {
+		return err
+	}
+	printSchedule(schedule)
+	return nil
+}
+
+// listSchedules prints every campaign's schedule
+func listSchedules(campaigns *db.CampaignRepository) error {
+	schedules, err := campaigns.ListSchedules()
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		fmt.Println("No campaigns are scheduled")
+	}
+	for _, schedule := range schedules {
+		printSchedule(schedule)
+	}
+	return nil
+}
+
+// printSchedule prints one schedule on a line
+func printSchedule(schedule *models.CampaignSchedule) {
+	status := "enabled"
+	if !schedule.Enabled {
+		status = "disabled"
+	}
+	fmt.Printf("Campaign %d: %ss at %s, stop after %v or %v of silence (%s)\n",
+		schedule.CampaignID, schedule.Weekday, schedule.StartTime,
+		time.Duration(schedule.MaxDurationSeconds)*time.Second,
+		time.Duration(schedule.SilenceTimeoutSeconds)*time.Second, status)
+}
+
+// parseWeekday parses a day name such as "friday" or "fri"
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(s)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if len(s) >= 3 && strings.HasPrefix(name, s) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid day %q (want e.g. friday)", s)
+}
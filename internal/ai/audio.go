@@ -0,0 +1,24 @@
+package ai
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/flac"
+)
+
+// wavInput returns the recording at filePath as a WAV file, for transcribers
+// that only read PCM. FLAC recordings are decoded into dir; WAV recordings
+// are returned as they are.
+func wavInput(filePath, dir string) (string, error) {
+	if !strings.EqualFold(filepath.Ext(filePath), ".flac") {
+		return filePath, nil
+	}
+
+	decoded := filepath.Join(dir, strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))+".wav")
+	if err := flac.Decode(filePath, decoded); err != nil {
+		return "", fmt.Errorf("failed to decode FLAC recording: %w", err)
+	}
+	return decoded, nil
+}
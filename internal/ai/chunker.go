@@ -0,0 +1,318 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+const (
+	// DefaultMaxChunkBytes keeps chunks under the 25 MB upload limit of the
+	// OpenAI transcription endpoint, about 13 minutes of 16 kHz mono audio
+	DefaultMaxChunkBytes = 24 << 20
+
+	// DefaultChunkOverlap is how much audio consecutive chunks share, so a
+	// word cut off at the end of one chunk is heard whole in the next
+	DefaultChunkOverlap = 5 * time.Second
+
+	// DefaultChunkSilenceSearch is how far back from a chunk's maximum
+	// length the chunker looks for a pause to cut at
+	DefaultChunkSilenceSearch = 30 * time.Second
+
+	// DefaultChunkConcurrency is how many chunks are transcribed at once
+	DefaultChunkConcurrency = 3
+
+	// silenceWindow is the resolution at which pauses are searched for
+	silenceWindow = 100 * time.Millisecond
+)
+
+// ChunkConfig configures a ChunkedTranscriber. Zero values use the defaults.
+type ChunkConfig struct {
+	MaxChunkBytes int64         // Largest file, header included, sent to the transcriber
+	Overlap       time.Duration // Audio shared by consecutive chunks
+	SilenceSearch time.Duration // How far before the maximum length to look for a pause
+	Concurrency   int           // Chunks transcribed at once
+	TempDir       string        // Where chunk files are written; empty uses the system default
+}
+
+// ChunkedTranscriber transcribes recordings too large for another Transcriber
+// in one go. It splits them into overlapping chunks that end in the quietest
+// moment near the size limit, transcribes a few chunks at a time and merges
+// the results, moving segments to the recording's timeline and dropping the
+// copies transcribed twice in the overlaps.
+type ChunkedTranscriber struct {
+	transcriber Transcriber
+	config      ChunkConfig
+}
+
+// NewChunkedTranscriber wraps transcriber so it can handle recordings of any
+// size
+func NewChunkedTranscriber(transcriber Transcriber, cfg ChunkConfig) *ChunkedTranscriber {
+	if cfg.MaxChunkBytes == 0 {
+		cfg.MaxChunkBytes = DefaultMaxChunkBytes
+	}
+	if cfg.Overlap == 0 {
+		cfg.Overlap = DefaultChunkOverlap
+	}
+	if cfg.SilenceSearch == 0 {
+		cfg.SilenceSearch = DefaultChunkSilenceSearch
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = DefaultChunkConcurrency
+	}
+
+	return &ChunkedTranscriber{transcriber: transcriber, config: cfg}
+}
+
+// audioChunk is one window of a recording's audio data
+type audioChunk struct {
+	start int64 // Offset of the first byte in the data chunk
+	end   int64 // Offset just past the last byte
+}
+
+// TranscribeFile transcribes a WAV or FLAC recording. Files within the size
+// limit are passed straight through; larger FLAC files are decoded to WAV
+// before they're split.
+func (c *ChunkedTranscriber) TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat audio file: %w", err)
+	}
+	if fileInfo.Size() <= c.config.MaxChunkBytes {
+		return c.transcriber.TranscribeFile(ctx, filePath)
+	}
+
+	tmpDir, err := os.MkdirTemp(c.config.TempDir, "transcribe-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filePath, err = wavInput(filePath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := wav.ReadInfo(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAV header: %w", err)
+	}
+	if err := info.Format.ValidateSamples(); err != nil {
+		return nil, err
+	}
+
+	chunks, err := c.planChunks(file, info)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := c.transcribeChunks(ctx, file, info, chunks, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeChunks(info.Format, chunks, results, info.Format.Duration(info.DataSize).Seconds()), nil
+}
+
+// TranscribeStream passes the stream to the wrapped transcriber
+func (c *ChunkedTranscriber) TranscribeStream(ctx context.Context, audioStream io.Reader) (*TranscriptionResult, error) {
+	return c.transcriber.TranscribeStream(ctx, audioStream)
+}
+
+// planChunks splits the audio data into chunks that fit the size limit once
+// written with a header of their own. Each chunk but the last ends at the
+// quietest moment of its final SilenceSearch, and the next one starts Overlap
+// before that.
+func (c *ChunkedTranscriber) planChunks(r io.ReaderAt, info *wav.Info) ([]audioChunk, error) {
+	format := info.Format
+	align := func(d int64) int64 { return d - d%int64(format.BlockAlign()) }
+	byteRate := float64(format.ByteRate())
+
+	maxData := align(c.config.MaxChunkBytes - format.HeaderSize())
+	if maxData <= 0 {
+		return nil, fmt.Errorf("chunk size limit of %d bytes is too small for any audio", c.config.MaxChunkBytes)
+	}
+
+	// Every chunk must move at least half its length forward
+	overlap := align(min(int64(c.config.Overlap.Seconds()*byteRate), maxData/4))
+	search := align(min(int64(c.config.SilenceSearch.Seconds()*byteRate), maxData/4))
+
+	var chunks []audioChunk
+	for start := int64(0); ; {
+		end := start + maxData
+		if end >= info.DataSize {
+			return append(chunks, audioChunk{start: start, end: info.DataSize}), nil
+		}
+
+		cut, err := quietestPoint(r, info, end-search, end)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, audioChunk{start: start, end: cut})
+		start = cut - overlap
+	}
+}
+
+// quietestPoint returns the middle of the quietest silenceWindow of audio
+// data between from and to, preferring later windows on a tie
+func quietestPoint(r io.ReaderAt, info *wav.Info, from, to int64) (int64, error) {
+	format := info.Format
+	blockAlign := int64(format.BlockAlign())
+	window := int64(silenceWindow.Seconds()*float64(format.SampleRate)) * blockAlign
+	size := format.BitDepth / 8
+
+	data := make([]byte, to-from)
+	if _, err := r.ReadAt(data, info.DataOffset+from); err != nil {
+		return 0, fmt.Errorf("failed to read audio: %w", err)
+	}
+
+	best, bestEnergy := to, math.Inf(1)
+	for offset := int64(0); offset+window <= int64(len(data)); offset += window {
+		var energy float64
+		for i := offset; i < offset+window; i += int64(size) {
+			sample := format.Sample(data[i:])
+			energy += sample * sample
+		}
+		if energy <= bestEnergy {
+			best, bestEnergy = from+offset+window/2, energy
+		}
+	}
+
+	return best - best%blockAlign, nil
+}
+
+// transcribeChunks writes each chunk to a WAV file of its own and transcribes
+// up to Concurrency of them at once. The first failure cancels the rest.
+func (c *ChunkedTranscriber) transcribeChunks(ctx context.Context, src io.ReaderAt, info *wav.Info, chunks []audioChunk, tmpDir string) ([]*TranscriptionResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*TranscriptionResult, len(chunks))
+	errs := make([]error, len(chunks))
+	slots := make(chan struct{}, c.config.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			path := filepath.Join(tmpDir, fmt.Sprintf("chunk%03d.wav", i))
+			defer os.Remove(path)
+
+			err := writeChunk(src, info, chunk, path)
+			if err == nil {
+				results[i], err = c.transcriber.TranscribeFile(ctx, path)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to transcribe chunk %d of %d: %w", i+1, len(chunks), err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// writeChunk copies a chunk of the audio data into a new WAV file at path
+func writeChunk(src io.ReaderAt, info *wav.Info, chunk audioChunk, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create chunk file: %w", err)
+	}
+	defer file.Close()
+
+	dataSize := chunk.end - chunk.start
+	if _, err := file.Write(wav.Header(info.Format, dataSize)); err != nil {
+		return fmt.Errorf("failed to write chunk file: %w", err)
+	}
+	if _, err := io.Copy(file, io.NewSectionReader(src, info.DataOffset+chunk.start, dataSize)); err != nil {
+		return fmt.Errorf("failed to write chunk file: %w", err)
+	}
+	return file.Close()
+}
+
+// mergeChunks joins the transcriptions of overlapping chunks. Segments are
+// moved to the recording's timeline, and each overlap is split at its middle:
+// segments centered before it come from the earlier chunk, the rest from the
+// later one. A segment repeating the text of the one before it across the
+// split is dropped too.
+func mergeChunks(format wav.Format, chunks []audioChunk, results []*TranscriptionResult, duration float64) *TranscriptionResult {
+	byteRate := float64(format.ByteRate())
+	merged := &TranscriptionResult{Duration: duration}
+	var texts []string
+
+	for i, chunk := range chunks {
+		result := results[i]
+		offset := float64(chunk.start) / byteRate
+		if merged.Language == "" {
+			merged.Language = result.Language
+		}
+
+		from, to := math.Inf(-1), math.Inf(1)
+		if i > 0 {
+			from = float64(chunk.start+chunks[i-1].end) / 2 / byteRate
+		}
+		if i < len(chunks)-1 {
+			to = float64(chunks[i+1].start+chunk.end) / 2 / byteRate
+		}
+
+		for _, segment := range result.Segments {
+			segment.Start += offset
+			segment.End += offset
+			if middle := (segment.Start + segment.End) / 2; middle < from || middle >= to {
+				continue
+			}
+			if n := len(merged.Segments); n > 0 && segment.Start < merged.Segments[n-1].End && sameText(segment.Text, merged.Segments[n-1].Text) {
+				continue
+			}
+
+			merged.Segments = append(merged.Segments, segment)
+			texts = append(texts, segment.Text)
+		}
+	}
+
+	merged.FullText = strings.Join(texts, " ")
+	return merged
+}
+
+// sameText reports whether two segments say the same thing, ignoring case,
+// spacing and punctuation at the ends
+func sameText(a, b string) bool {
+	normalize := func(s string) string {
+		return strings.Trim(strings.Join(strings.Fields(strings.ToLower(s)), " "), ".,!?;:")
+	}
+	return normalize(a) == normalize(b)
+}
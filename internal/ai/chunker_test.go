@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+var speech = wav.Format{SampleRate: 16000, Channels: 1, BitDepth: 16}
+
+// wordTranscriber "hears" runs of a constant non-zero sample value as words,
+// numbered by the value, so chunks can be checked against the source audio
+type wordTranscriber struct {
+	active, maxActive atomic.Int32
+	mu                sync.Mutex
+	chunks            []int64 // Sizes of the files transcribed
+}
+
+func (f *wordTranscriber) TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error) {
+	if n := f.active.Add(1); n > f.maxActive.Load() {
+		f.maxActive.Store(n)
+	}
+	defer f.active.Add(-1)
+	time.Sleep(10 * time.Millisecond)
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.chunks = append(f.chunks, int64(len(data)))
+	f.mu.Unlock()
+
+	pcm := data[speech.HeaderSize():]
+	result := &TranscriptionResult{Language: "english", Duration: speech.Duration(int64(len(pcm))).Seconds()}
+	var word int16
+	var start int
+	for i := 0; i <= len(pcm)/2; i++ {
+		var sample int16
+		if i < len(pcm)/2 {
+			sample = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+		}
+		if sample == word {
+			continue
+		}
+		if word != 0 {
+			result.Segments = append(result.Segments, TranscriptionSegment{
+				Text:  fmt.Sprintf("Word %d.", word/100),
+				Start: float64(start) / float64(speech.SampleRate),
+				End:   float64(i) / float64(speech.SampleRate),
+			})
+		}
+		word, start = sample, i
+	}
+	return result, nil
+}
+
+func (f *wordTranscriber) TranscribeStream(ctx context.Context, audioStream io.Reader) (*TranscriptionResult, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// writeWords writes a WAV file of n one-second words, each followed by half
+// a second of silence
+func writeWords(t *testing.T, n int) string {
+	t.Helper()
+
+	var pcm []byte
+	for word := 1; word <= n; word++ {
+		for i := 0; i < speech.SampleRate*3/2; i++ {
+			var sample int16
+			if i < speech.SampleRate {
+				sample = int16(word * 100)
+			}
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(sample))
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "session.wav")
+	if err := os.WriteFile(path, append(wav.Header(speech, int64(len(pcm))), pcm...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestChunkedTranscriber(t *testing.T) {
+	path := writeWords(t, 20) // 30 seconds
+	inner := &wordTranscriber{}
+	maxChunkBytes := speech.HeaderSize() + 10*int64(speech.ByteRate())
+	transcriber := NewChunkedTranscriber(inner, ChunkConfig{
+		MaxChunkBytes: maxChunkBytes,
+		Overlap:       2 * time.Second,
+		SilenceSearch: 2 * time.Second,
+		Concurrency:   2,
+	})
+
+	result, err := transcriber.TranscribeFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+
+	if len(inner.chunks) < 3 {
+		t.Errorf("split into %d chunks, want at least 3", len(inner.chunks))
+	}
+	for _, size := range inner.chunks {
+		if size > maxChunkBytes {
+			t.Errorf("chunk of %d bytes is over the %d byte limit", size, maxChunkBytes)
+		}
+	}
+	if n := inner.maxActive.Load(); n > 2 {
+		t.Errorf("%d chunks transcribed at once, want at most 2", n)
+	}
+
+	// Every word is heard once, whole and at its place in the recording
+	if len(result.Segments) != 20 {
+		t.Fatalf("got %d segments, want 20: %+v", len(result.Segments), result.Segments)
+	}
+	for i, segment := range result.Segments {
+		want := TranscriptionSegment{Text: fmt.Sprintf("Word %d.", i+1), Start: float64(i) * 1.5, End: float64(i)*1.5 + 1}
+		if segment.Text != want.Text || math.Abs(segment.Start-want.Start) > 0.001 || math.Abs(segment.End-want.End) > 0.001 {
+			t.Errorf("segment %d = %+v, want %+v", i, segment, want)
+		}
+	}
+	if result.Language != "english" || result.Duration != 30 {
+		t.Errorf("language %q, duration %v", result.Language, result.Duration)
+	}
+}
+
+func TestChunkedTranscriberSmallFile(t *testing.T) {
+	path := writeWords(t, 2)
+	inner := &wordTranscriber{}
+
+	result, err := NewChunkedTranscriber(inner, ChunkConfig{}).TranscribeFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+	if len(inner.chunks) != 1 || len(result.Segments) != 2 {
+		t.Errorf("transcribed %d chunks into %d segments, want 1 chunk and 2 segments", len(inner.chunks), len(result.Segments))
+	}
+}
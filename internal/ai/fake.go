@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"strings"
+)
+
+// fakeEmbeddingSize is the length of FakeService's embedding vectors
+const fakeEmbeddingSize = 32
+
+// fakeTranscript is what FakeService hears in every recording
+var fakeTranscript = []string{
+	"Welcome back, everyone. Last time you reached the gates of Phandalin.",
+	"I want to look around the town square.",
+	"Roll for perception.",
+	"Seventeen.",
+	"You spot a goblin watching you from the rooftops.",
+	"I draw my bow and roll for initiative.",
+}
+
+// FakeService is an AIService, and Diarizer, that needs no model or network
+// for development and tests. It returns a canned transcript five seconds per
+// line, alternates two speakers, summarizes by picking lines out of the text
+// and hashes words into embeddings, so texts sharing words come out similar.
+type FakeService struct{}
+
+// NewFakeService creates a fake AI service
+func NewFakeService() *FakeService {
+	return &FakeService{}
+}
+
+// TranscribeFile returns the canned transcript whatever the file holds
+func (f *FakeService) TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error) {
+	return fakeTranscription(), nil
+}
+
+// TranscribeStream reads the stream through and returns the canned transcript
+func (f *FakeService) TranscribeStream(ctx context.Context, audioStream io.Reader) (*TranscriptionResult, error) {
+	if _, err := io.Copy(io.Discard, audioStream); err != nil {
+		return nil, fmt.Errorf("failed to read audio stream: %w", err)
+	}
+	return fakeTranscription(), nil
+}
+
+// fakeTranscription builds the canned transcript
+func fakeTranscription() *TranscriptionResult {
+	result := &TranscriptionResult{Language: "english"}
+	for i, text := range fakeTranscript {
+		result.Segments = append(result.Segments, TranscriptionSegment{
+			Text:       text,
+			Start:      float64(i * 5),
+			End:        float64(i*5 + 4),
+			Confidence: 1,
+		})
+	}
+	result.Duration = float64(len(fakeTranscript) * 5)
+	result.FullText = strings.Join(fakeTranscript, " ")
+	return result
+}
+
+// Diarize labels the segments SPEAKER_00 and SPEAKER_01 in turn
+func (f *FakeService) Diarize(ctx context.Context, filePath string, transcription *TranscriptionResult) (*TranscriptionResult, error) {
+	for i := range transcription.Segments {
+		transcription.Segments[i].Speaker = fmt.Sprintf("SPEAKER_%02d", i%2)
+	}
+	return transcription, nil
+}
+
+// SummarizeSession summarizes the transcription's text
+func (f *FakeService) SummarizeSession(ctx context.Context, transcription *TranscriptionResult) (*SessionSummary, error) {
+	var lines []string
+	for _, segment := range transcription.Segments {
+		lines = append(lines, segment.Text)
+	}
+	if len(lines) == 0 {
+		lines = []string{transcription.FullText}
+	}
+	return f.SummarizeText(ctx, strings.Join(lines, "\n"))
+}
+
+// SummarizeText uses the first line as the overview and the next few as key
+// events
+func (f *FakeService) SummarizeText(ctx context.Context, text string) (*SessionSummary, error) {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	summary := &SessionSummary{Overview: "Nothing happened."}
+	if len(lines) > 0 {
+		summary.Overview = lines[0]
+		summary.KeyEvents = lines[1:min(len(lines), 4)]
+	}
+	return summary, nil
+}
+
+// GenerateEmbedding creates an embedding for the given text
+func (f *FakeService) GenerateEmbedding(ctx context.Context, text string) (*Embedding, error) {
+	vector := make([]float64, fakeEmbeddingSize)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		hash := fnv.New32a()
+		hash.Write([]byte(strings.Trim(word, ".,!?;:")))
+		vector[hash.Sum32()%fakeEmbeddingSize]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+	return &Embedding{Vector: vector, Model: ProviderFake}, nil
+}
+
+// GenerateBatchEmbeddings creates embeddings for multiple texts
+func (f *FakeService) GenerateBatchEmbeddings(ctx context.Context, texts []string) ([]*Embedding, error) {
+	embeddings := make([]*Embedding, 0, len(texts))
+	for _, text := range texts {
+		embedding, _ := f.GenerateEmbedding(ctx, text)
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
@@ -49,13 +49,22 @@ type Embedding struct {
 
 // Transcriber handles audio transcription with speaker diarization
 type Transcriber interface {
-	// TranscribeFile transcribes an audio file and performs speaker diarization
+	// TranscribeFile transcribes an audio file and performs speaker diarization.
+	// Recordings are WAV or FLAC; implementations that only accept WAV can
+	// convert FLAC with flac.Decode.
 	TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error)
 
 	// TranscribeStream transcribes an audio stream with real-time speaker diarization
 	TranscribeStream(ctx context.Context, audioStream io.Reader) (*TranscriptionResult, error)
 }
 
+// Diarizer labels who is speaking in a transcription
+type Diarizer interface {
+	// Diarize sets the Speaker of the transcription's segments from the
+	// audio file it was transcribed from
+	Diarize(ctx context.Context, filePath string, transcription *TranscriptionResult) (*TranscriptionResult, error)
+}
+
 // Summarizer generates summaries of D&D sessions
 type Summarizer interface {
 	// SummarizeSession generates a structured summary from a transcription
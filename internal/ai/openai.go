@@ -1,31 +1,253 @@
 package ai
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+const (
+	// DefaultOpenAIBaseURL is the root of the OpenAI API
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+	// DefaultTranscriptionModel is the speech-to-text model used unless
+	// configured otherwise
+	DefaultTranscriptionModel = "whisper-1"
+
+	// DefaultChatModel writes summaries unless configured otherwise
+	DefaultChatModel = "gpt-4"
+
+	// DefaultEmbeddingModel generates embeddings unless configured otherwise
+	DefaultEmbeddingModel = "text-embedding-3-small"
+
+	// DefaultSummaryChunkChars is the longest text summarized in one request
+	// unless configured otherwise: about 6,000 tokens, which leaves room for
+	// the prompt and reply in the 8,192-token context of gpt-4 and many local
+	// models
+	DefaultSummaryChunkChars = 24000
+)
+
+// OpenAIConfig configures an OpenAIService
+type OpenAIConfig struct {
+	// APIKey authenticates requests. Local servers usually don't need one.
+	APIKey string
+
+	// BaseURL is the root of the API. Any server with OpenAI-compatible
+	// endpoints works, e.g. Ollama (http://host:11434/v1) or the llama.cpp
+	// server (http://host:8080/v1). Empty uses DefaultOpenAIBaseURL.
+	BaseURL string
+
+	// ChatModel writes summaries. Empty uses DefaultChatModel.
+	ChatModel string
+
+	// EmbeddingModel generates embeddings. Empty uses DefaultEmbeddingModel.
+	EmbeddingModel string
+
+	// TranscriptionModel is the model audio is transcribed with. Empty uses
+	// DefaultTranscriptionModel.
+	TranscriptionModel string
+
+	// SummaryChunkChars is the longest text summarized in one request. Longer
+	// transcripts are split at line breaks, each part is summarized, and the
+	// partial summaries are merged. Zero uses DefaultSummaryChunkChars.
+	SummaryChunkChars int
+
+	// HTTPClient sends the requests. Nil uses a client with a generous
+	// timeout, since transcribing a long file takes a while.
+	HTTPClient *http.Client
+}
+
 // OpenAIService implements AIService using OpenAI's APIs
 type OpenAIService struct {
-	apiKey string
-	model  string // Default model for text generation
+	apiKey             string
+	baseURL            string
+	model              string // Default model for text generation
+	transcriptionModel string
+	embeddingModel     string
+	summaryChunkChars  int
+	client             *http.Client
 }
 
 // NewOpenAIService creates a new OpenAI service
-func NewOpenAIService(apiKey string) *OpenAIService {
+func NewOpenAIService(cfg OpenAIConfig) *OpenAIService {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultOpenAIBaseURL
+	}
+	if cfg.TranscriptionModel == "" {
+		cfg.TranscriptionModel = DefaultTranscriptionModel
+	}
+	if cfg.ChatModel == "" {
+		cfg.ChatModel = DefaultChatModel
+	}
+	if cfg.EmbeddingModel == "" {
+		cfg.EmbeddingModel = DefaultEmbeddingModel
+	}
+	if cfg.SummaryChunkChars <= 0 {
+		cfg.SummaryChunkChars = DefaultSummaryChunkChars
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Minute}
+	}
+
 	return &OpenAIService{
-		apiKey: apiKey,
-		model:  "gpt-4",
+		apiKey:             cfg.APIKey,
+		baseURL:            strings.TrimSuffix(cfg.BaseURL, "/"),
+		model:              cfg.ChatModel,
+		transcriptionModel: cfg.TranscriptionModel,
+		embeddingModel:     cfg.EmbeddingModel,
+		summaryChunkChars:  cfg.SummaryChunkChars,
+		client:             cfg.HTTPClient,
 	}
 }
 
-// TranscribeFile transcribes an audio file using Whisper API
+// openAISegment is one segment of a verbose_json transcription
+type openAISegment struct {
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Text       string  `json:"text"`
+	AvgLogprob float64 `json:"avg_logprob"`
+}
+
+// openAITranscription is the verbose_json response of the transcription
+// endpoint
+type openAITranscription struct {
+	Language string          `json:"language"`
+	Duration float64         `json:"duration"`
+	Text     string          `json:"text"`
+	Segments []openAISegment `json:"segments"`
+}
+
+// openAIError is the body of a failed request
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// TranscribeFile transcribes a WAV or FLAC file with the audio transcription
+// endpoint. The API has no speaker diarization, so Speaker is left empty and
+// segments carry a confidence derived from the model's average log
+// probability.
 func (s *OpenAIService) TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error) {
-	// TODO: Implement using OpenAI Whisper API
-	// Note: OpenAI's Whisper API doesn't natively support speaker diarization
-	// You may need to use additional services like Pyannote or AssemblyAI for diarization
-	return nil, fmt.Errorf("not implemented")
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	// The endpoint only takes files of up to 25 MB, so buffering is fine
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, fmt.Errorf("failed to read audio file: %w", err)
+	}
+	fields := [][2]string{
+		{"model", s.transcriptionModel},
+		{"response_format", "verbose_json"},
+		{"timestamp_granularities[]", "segment"},
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return nil, fmt.Errorf("failed to build request: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var transcription openAITranscription
+	if err := s.do(req, &transcription); err != nil {
+		return nil, fmt.Errorf("failed to transcribe %s: %w", filepath.Base(filePath), err)
+	}
+
+	result := &TranscriptionResult{
+		Segments: make([]TranscriptionSegment, len(transcription.Segments)),
+		Language: transcription.Language,
+		Duration: transcription.Duration,
+		FullText: strings.TrimSpace(transcription.Text),
+	}
+	for i, segment := range transcription.Segments {
+		result.Segments[i] = TranscriptionSegment{
+			Text:       strings.TrimSpace(segment.Text),
+			Start:      segment.Start,
+			End:        segment.End,
+			Confidence: logprobConfidence(segment.AvgLogprob),
+		}
+	}
+
+	return result, nil
+}
+
+// postJSON sends body as JSON to an endpoint under the base URL and decodes
+// the JSON response into dest
+func (s *OpenAIService) postJSON(ctx context.Context, path string, body, dest interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return s.do(req, dest)
+}
+
+// do sends a request, authenticated if there's an API key, and decodes the
+// JSON response into dest
+func (s *OpenAIService) do(req *http.Request, dest interface{}) error {
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr openAIError
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("API returned %s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return fmt.Errorf("API returned %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// logprobConfidence turns the average log probability of a segment's tokens
+// into a confidence from 0 to 1: the geometric mean of the token
+// probabilities
+func logprobConfidence(avgLogprob float64) float64 {
+	return math.Max(0, math.Min(math.Exp(avgLogprob), 1))
 }
 
 // TranscribeStream transcribes an audio stream
@@ -34,35 +256,281 @@ func (s *OpenAIService) TranscribeStream(ctx context.Context, audioStream io.Rea
 	return nil, fmt.Errorf("not implemented")
 }
 
-// SummarizeSession generates a structured summary from a transcription
+// summaryPrompt asks for a summary in the JSON shape of openAISummary
+const summaryPrompt = `You summarize transcripts of Dungeons & Dragons sessions for the players.
+The transcript is table talk: in-character dialogue, rules discussion and chatter mixed together.
+Reply with a single JSON object with these keys and nothing else:
+"overview": a few paragraphs on what happened in the story,
+"key_events", "npcs", "locations", "items", "combat", "decisions", "cliffhangers": arrays of short strings.
+Leave out out-of-game chatter. Use empty arrays where nothing fits.`
+
+// mergePrompt asks for one summary of a session from the summaries of its
+// consecutive parts
+const mergePrompt = `You combine summaries of consecutive parts of one Dungeons & Dragons session into a summary of the whole session.
+The summaries are given in order as a JSON array of objects.
+Reply with a single JSON object with the same keys and nothing else:
+"overview": a few paragraphs telling the story of the whole session,
+"key_events", "npcs", "locations", "items", "combat", "decisions", "cliffhangers": the arrays of the parts merged, without repeats.
+Only keep cliffhangers that the later parts leave unresolved.`
+
+// openAISummary is the JSON object the model is asked to reply with
+type openAISummary struct {
+	Overview     string   `json:"overview"`
+	KeyEvents    []string `json:"key_events"`
+	NPCs         []string `json:"npcs"`
+	Locations    []string `json:"locations"`
+	Items        []string `json:"items"`
+	Combat       []string `json:"combat"`
+	Decisions    []string `json:"decisions"`
+	Cliffhangers []string `json:"cliffhangers"`
+}
+
+// chatMessage is one message of a chat completion
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest is the body of a chat completion request
+type chatRequest struct {
+	Model          string            `json:"model"`
+	Messages       []chatMessage     `json:"messages"`
+	Temperature    float64           `json:"temperature"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+// chatResponse is the part of a chat completion response we use
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// SummarizeSession generates a structured summary from a transcription. Each
+// segment is given to the model with its time and speaker.
 func (s *OpenAIService) SummarizeSession(ctx context.Context, transcription *TranscriptionResult) (*SessionSummary, error) {
-	// TODO: Implement using GPT-4 to analyze the transcription
-	// Use structured prompts to extract key events, NPCs, locations, etc.
-	return nil, fmt.Errorf("not implemented")
+	var transcript strings.Builder
+	for _, segment := range transcription.Segments {
+		offset := time.Duration(segment.Start) * time.Second
+		fmt.Fprintf(&transcript, "[%02d:%02d:%02d] ", int(offset.Hours()), int(offset.Minutes())%60, int(offset.Seconds())%60)
+		if segment.Speaker != "" {
+			fmt.Fprintf(&transcript, "%s: ", segment.Speaker)
+		}
+		transcript.WriteString(segment.Text)
+		transcript.WriteString("\n")
+	}
+	if len(transcription.Segments) == 0 {
+		transcript.WriteString(transcription.FullText)
+	}
+
+	return s.SummarizeText(ctx, transcript.String())
 }
 
-// SummarizeText generates a summary from raw text
+// SummarizeText generates a summary from raw text with the chat completions
+// endpoint. Text longer than the chunk limit is split at line breaks and
+// summarized part by part, and the partial summaries are merged, so long
+// sessions fit in the context of small local models.
 func (s *OpenAIService) SummarizeText(ctx context.Context, text string) (*SessionSummary, error) {
-	// TODO: Implement using GPT-4
-	return nil, fmt.Errorf("not implemented")
+	chunks := splitText(text, s.summaryChunkChars)
+	if len(chunks) == 1 {
+		summary, err := s.chatSummary(ctx, summaryPrompt, text)
+		if err != nil {
+			return nil, err
+		}
+		return summary.sessionSummary(), nil
+	}
+
+	parts := make([]openAISummary, len(chunks))
+	for i, chunk := range chunks {
+		summary, err := s.chatSummary(ctx, summaryPrompt, chunk)
+		if err != nil {
+			return nil, fmt.Errorf("part %d of %d: %w", i+1, len(chunks), err)
+		}
+		parts[i] = *summary
+	}
+
+	summary, err := s.mergeSummaries(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+	return summary.sessionSummary(), nil
+}
+
+// mergeSummaries merges the summaries of consecutive parts of a session.
+// Parts that don't fit in one request are merged in batches, and the batches
+// merged in turn.
+func (s *OpenAIService) mergeSummaries(ctx context.Context, parts []openAISummary) (*openAISummary, error) {
+	for len(parts) > 1 {
+		var merged []openAISummary
+		for len(parts) > 0 {
+			// At least two parts per request, so every round shrinks the list
+			n := 2
+			for n < len(parts) {
+				if encoded, _ := json.Marshal(parts[:n+1]); len(encoded) > s.summaryChunkChars {
+					break
+				}
+				n++
+			}
+			if n > len(parts) {
+				n = len(parts)
+			}
+			if n == 1 {
+				merged = append(merged, parts[0])
+				break
+			}
+
+			input, err := json.Marshal(parts[:n])
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode partial summaries: %w", err)
+			}
+			summary, err := s.chatSummary(ctx, mergePrompt, string(input))
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge partial summaries: %w", err)
+			}
+			merged = append(merged, *summary)
+			parts = parts[n:]
+		}
+		parts = merged
+	}
+	return &parts[0], nil
+}
+
+// chatSummary sends content to the chat completions endpoint with a prompt
+// asking for a JSON summary and parses the reply
+func (s *OpenAIService) chatSummary(ctx context.Context, prompt, content string) (*openAISummary, error) {
+	req := chatRequest{
+		Model: s.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: content},
+		},
+		Temperature:    0.2,
+		ResponseFormat: map[string]string{"type": "json_object"},
+	}
+
+	var resp chatResponse
+	if err := s.postJSON(ctx, "/chat/completions", req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to summarize session: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to summarize session: the response has no choices")
+	}
+
+	// Some local models wrap the JSON in a Markdown code block anyway
+	reply := strings.TrimSpace(resp.Choices[0].Message.Content)
+	reply = strings.TrimPrefix(reply, "```json")
+	reply = strings.Trim(reply, "`\n ")
+
+	var summary openAISummary
+	if err := json.Unmarshal([]byte(reply), &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse summary: %w", err)
+	}
+	return &summary, nil
+}
+
+// sessionSummary converts the model's reply into a SessionSummary
+func (summary *openAISummary) sessionSummary() *SessionSummary {
+	return &SessionSummary{
+		Overview:     summary.Overview,
+		KeyEvents:    summary.KeyEvents,
+		NPCs:         summary.NPCs,
+		Locations:    summary.Locations,
+		Items:        summary.Items,
+		Combat:       summary.Combat,
+		Decisions:    summary.Decisions,
+		Cliffhangers: summary.Cliffhangers,
+	}
+}
+
+// splitText splits text into chunks of at most limit bytes, breaking at line
+// ends where it can. A single line longer than the limit is cut at rune
+// boundaries.
+func splitText(text string, limit int) []string {
+	if len(text) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	var chunk strings.Builder
+	flush := func() {
+		if chunk.Len() > 0 {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if chunk.Len()+len(line) > limit {
+			flush()
+		}
+		for len(line) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = limit
+			}
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+		chunk.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// embeddingRequest is the body of an embeddings request
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingResponse is the part of an embeddings response we use
+type embeddingResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
 }
 
 // GenerateEmbedding creates an embedding for the given text
 func (s *OpenAIService) GenerateEmbedding(ctx context.Context, text string) (*Embedding, error) {
-	// TODO: Implement using OpenAI embeddings API (text-embedding-ada-002 or newer)
-	return nil, fmt.Errorf("not implemented")
+	embeddings, err := s.GenerateBatchEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
 }
 
-// GenerateBatchEmbeddings creates embeddings for multiple texts
+// GenerateBatchEmbeddings creates embeddings for multiple texts in one
+// request to the embeddings endpoint, in the order of texts
 func (s *OpenAIService) GenerateBatchEmbeddings(ctx context.Context, texts []string) ([]*Embedding, error) {
-	// TODO: Implement batch embedding generation
-	embeddings := make([]*Embedding, 0, len(texts))
-	for _, text := range texts {
-		embedding, err := s.GenerateEmbedding(ctx, text)
-		if err != nil {
-			return nil, err
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	var resp embeddingResponse
+	if err := s.postJSON(ctx, "/embeddings", embeddingRequest{Model: s.embeddingModel, Input: texts}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = s.embeddingModel
+	}
+	embeddings := make([]*Embedding, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("failed to generate embeddings: unexpected index %d", data.Index)
+		}
+		embeddings[data.Index] = &Embedding{Vector: data.Embedding, Model: model}
+	}
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			return nil, fmt.Errorf("failed to generate embeddings: none returned for text %d", i)
 		}
-		embeddings = append(embeddings, embedding)
 	}
+
 	return embeddings, nil
 }
@@ -0,0 +1,304 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
+)
+
+func TestOpenAITranscribeFile(t *testing.T) {
+	audio := []byte("RIFF....WAVEfmt fake audio")
+	path := filepath.Join(t.TempDir(), "session.wav")
+	if err := os.WriteFile(path, audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Method != http.MethodPost {
+			t.Errorf("request to %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for field, want := range map[string]string{
+			"model":                     "whisper-1",
+			"response_format":           "verbose_json",
+			"timestamp_granularities[]": "segment",
+		} {
+			if got := r.FormValue(field); got != want {
+				t.Errorf("%s = %q, want %q", field, got, want)
+			}
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("no file in form: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "session.wav" || string(data) != string(audio) {
+			t.Errorf("uploaded %q with %d bytes", header.Filename, len(data))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"task": "transcribe",
+			"language": "english",
+			"duration": 7.5,
+			"text": " Roll for initiative. The goblin attacks!",
+			"segments": [
+				{"id": 0, "start": 0.0, "end": 3.2, "text": " Roll for initiative.", "avg_logprob": -0.1, "no_speech_prob": 0.01},
+				{"id": 1, "start": 3.2, "end": 7.5, "text": " The goblin attacks!", "avg_logprob": -0.7, "no_speech_prob": 0.02}
+			]
+		}`)
+	}))
+	defer server.Close()
+
+	service := NewOpenAIService(OpenAIConfig{APIKey: "test-key", BaseURL: server.URL + "/v1/"})
+	result, err := service.TranscribeFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+
+	if result.Language != "english" || result.Duration != 7.5 || result.FullText != "Roll for initiative. The goblin attacks!" {
+		t.Errorf("result = %+v", result)
+	}
+	want := []TranscriptionSegment{
+		{Text: "Roll for initiative.", Start: 0, End: 3.2, Confidence: math.Exp(-0.1)},
+		{Text: "The goblin attacks!", Start: 3.2, End: 7.5, Confidence: math.Exp(-0.7)},
+	}
+	if len(result.Segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(result.Segments), len(want))
+	}
+	for i, segment := range result.Segments {
+		if segment != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, segment, want[i])
+		}
+	}
+}
+
+func TestOpenAITranscribeFileError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.wav")
+	if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		io.WriteString(w, `{"error": {"message": "Maximum content size limit exceeded"}}`)
+	}))
+	defer server.Close()
+
+	service := NewOpenAIService(OpenAIConfig{APIKey: "test-key", BaseURL: server.URL})
+	_, err := service.TranscribeFile(context.Background(), path)
+	if err == nil || !strings.Contains(err.Error(), "Maximum content size limit exceeded") {
+		t.Errorf("TranscribeFile error = %v, want the API's message", err)
+	}
+}
+
+func TestOpenAISummarizeSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request to %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization = %q, want none without an API key", got)
+		}
+
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Model != "llama3.1" || len(req.Messages) != 2 || req.Messages[0].Role != "system" {
+			t.Errorf("request = %+v", req)
+		}
+		if want := "[00:01:05] SPEAKER_00: We open the crypt."; !strings.Contains(req.Messages[1].Content, want) {
+			t.Errorf("transcript %q doesn't include %q", req.Messages[1].Content, want)
+		}
+
+		// Local models like to fence their JSON
+		content := "```json\n" + `{"overview": "The party entered the crypt.", "npcs": ["Strahd"], "cliffhangers": []}` + "\n```"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+	defer server.Close()
+
+	service := NewOpenAIService(OpenAIConfig{BaseURL: server.URL + "/v1", ChatModel: "llama3.1"})
+	summary, err := service.SummarizeSession(context.Background(), &TranscriptionResult{
+		Segments: []TranscriptionSegment{{Speaker: "SPEAKER_00", Text: "We open the crypt.", Start: 65.4, End: 67}},
+	})
+	if err != nil {
+		t.Fatalf("SummarizeSession: %v", err)
+	}
+	if summary.Overview != "The party entered the crypt." || len(summary.NPCs) != 1 || summary.NPCs[0] != "Strahd" {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestOpenAISummarizeLongTranscript(t *testing.T) {
+	const limit = 200
+	var mu sync.Mutex
+	var parts, merges int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		content := req.Messages[1].Content
+
+		var reply openAISummary
+		mu.Lock()
+		switch req.Messages[0].Content {
+		case summaryPrompt:
+			parts++
+			if len(content) > limit {
+				t.Errorf("part of %d characters, want at most %d", len(content), limit)
+			}
+			// Every line names an NPC, which the part summary lists
+			for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+				reply.NPCs = append(reply.NPCs, line[strings.LastIndex(line, " ")+1:])
+			}
+			reply.Overview = "A part of the session."
+		case mergePrompt:
+			merges++
+			var summaries []openAISummary
+			if err := json.Unmarshal([]byte(content), &summaries); err != nil || len(summaries) < 2 {
+				t.Errorf("merge of %q: %v", content, err)
+			}
+			for _, summary := range summaries {
+				reply.NPCs = append(reply.NPCs, summary.NPCs...)
+			}
+			reply.Overview = "The whole session."
+		default:
+			t.Errorf("unexpected prompt %q", req.Messages[0].Content)
+		}
+		mu.Unlock()
+
+		encoded, _ := json.Marshal(reply)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": string(encoded)}}},
+		})
+	}))
+	defer server.Close()
+
+	var segments []TranscriptionSegment
+	for i := 0; i < 20; i++ {
+		segments = append(segments, TranscriptionSegment{Speaker: "DM", Text: fmt.Sprintf("The party meets NPC%02d", i), Start: float64(i * 60)})
+	}
+
+	service := NewOpenAIService(OpenAIConfig{BaseURL: server.URL, ChatModel: "llama3.1", SummaryChunkChars: limit})
+	summary, err := service.SummarizeSession(context.Background(), &TranscriptionResult{Segments: segments})
+	if err != nil {
+		t.Fatalf("SummarizeSession: %v", err)
+	}
+	if parts < 2 || merges == 0 {
+		t.Errorf("%d part summaries and %d merges, want the transcript summarized in parts", parts, merges)
+	}
+	if summary.Overview != "The whole session." || len(summary.NPCs) != len(segments) {
+		t.Fatalf("summary = %+v", summary)
+	}
+	for i, npc := range summary.NPCs {
+		if want := fmt.Sprintf("NPC%02d", i); npc != want {
+			t.Errorf("NPCs[%d] = %q, want %q in order", i, npc, want)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	for _, tt := range []struct {
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short\n", 10, []string{"short\n"}},
+		{"one\ntwo\nthree\n", 8, []string{"one\ntwo\n", "three\n"}},
+		{"a very long line\nend", 6, []string{"a very", " long ", "line\n", "end"}},
+		{"héllo", 2, []string{"h", "é", "ll", "o"}},
+	} {
+		got := splitText(tt.text, tt.limit)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("splitText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAIGenerateBatchEmbeddings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if r.URL.Path != "/embeddings" || req.Model != "nomic-embed-text" || len(req.Input) != 2 {
+			t.Errorf("request to %s: %+v", r.URL.Path, req)
+		}
+
+		// Out of order, as the API allows
+		io.WriteString(w, `{"model": "nomic-embed-text", "data": [
+			{"index": 1, "embedding": [0.3, 0.4]},
+			{"index": 0, "embedding": [0.1, 0.2]}
+		]}`)
+	}))
+	defer server.Close()
+
+	service := NewOpenAIService(OpenAIConfig{BaseURL: server.URL, EmbeddingModel: "nomic-embed-text"})
+	embeddings, err := service.GenerateBatchEmbeddings(context.Background(), []string{"goblin", "dragon"})
+	if err != nil {
+		t.Fatalf("GenerateBatchEmbeddings: %v", err)
+	}
+	if len(embeddings) != 2 || embeddings[0].Vector[0] != 0.1 || embeddings[1].Vector[0] != 0.3 || embeddings[1].Model != "nomic-embed-text" {
+		t.Errorf("embeddings = %+v, %+v", embeddings[0], embeddings[1])
+	}
+}
+
+func TestProviderSelection(t *testing.T) {
+	cfg := &config.Config{
+		OpenAIAPIKey:      "sk-test",
+		SummaryProvider:   ProviderOpenAI,
+		EmbeddingProvider: ProviderLocal,
+		EmbeddingModel:    "nomic-embed-text",
+		LocalLLMURL:       "http://localhost:11434/v1",
+	}
+
+	summarizer, err := NewSummarizer(cfg)
+	if err != nil {
+		t.Fatalf("NewSummarizer: %v", err)
+	}
+	if s := summarizer.(*OpenAIService); s.baseURL != DefaultOpenAIBaseURL || s.apiKey != "sk-test" {
+		t.Errorf("summarizer uses %s with key %q, want OpenAI", s.baseURL, s.apiKey)
+	}
+
+	embedder, err := NewEmbeddingGenerator(cfg)
+	if err != nil {
+		t.Fatalf("NewEmbeddingGenerator: %v", err)
+	}
+	if e := embedder.(*OpenAIService); e.baseURL != cfg.LocalLLMURL || e.apiKey != "" || e.embeddingModel != "nomic-embed-text" {
+		t.Errorf("embedder uses %s with key %q and model %s, want the local server", e.baseURL, e.apiKey, e.embeddingModel)
+	}
+
+	cfg.SummaryProvider = "anthropic"
+	if _, err := NewSummarizer(cfg); err == nil {
+		t.Error("NewSummarizer accepted an unknown provider")
+	}
+	cfg.EmbeddingModel = ""
+	if _, err := NewEmbeddingGenerator(cfg); err == nil {
+		t.Error("NewEmbeddingGenerator accepted a local provider without a model")
+	}
+}
@@ -0,0 +1,314 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
+)
+
+// Providers selectable per capability in config.Config
+const (
+	ProviderOpenAI     = "openai"     // The OpenAI API
+	ProviderLocal      = "local"      // An OpenAI-compatible server such as Ollama or llama.cpp
+	ProviderWhisperCpp = "whispercpp" // whisper.cpp run locally, for transcription
+	ProviderFake       = "fake"       // Canned results for development, see FakeService
+	ProviderNone       = "none"       // No provider, for diarization
+)
+
+// Factories build a capability's provider from the configuration
+type (
+	TranscriberFactory        func(cfg *config.Config) (Transcriber, error)
+	DiarizerFactory           func(cfg *config.Config) (Diarizer, error)
+	SummarizerFactory         func(cfg *config.Config) (Summarizer, error)
+	EmbeddingGeneratorFactory func(cfg *config.Config) (EmbeddingGenerator, error)
+)
+
+// Registry maps provider names to the factories for each capability, so
+// every capability's provider can be chosen independently in config.Config
+type Registry struct {
+	transcribers map[string]TranscriberFactory
+	diarizers    map[string]DiarizerFactory
+	summarizers  map[string]SummarizerFactory
+	embedders    map[string]EmbeddingGeneratorFactory
+}
+
+// NewRegistry creates a registry of the built-in providers
+func NewRegistry() *Registry {
+	r := &Registry{
+		transcribers: make(map[string]TranscriberFactory),
+		diarizers:    make(map[string]DiarizerFactory),
+		summarizers:  make(map[string]SummarizerFactory),
+		embedders:    make(map[string]EmbeddingGeneratorFactory),
+	}
+
+	r.RegisterTranscriber(ProviderOpenAI, newOpenAITranscriber)
+	r.RegisterTranscriber(ProviderWhisperCpp, newWhisperCppTranscriber)
+	r.RegisterDiarizer(ProviderNone, func(*config.Config) (Diarizer, error) { return nil, nil })
+	for _, provider := range []string{ProviderOpenAI, ProviderLocal} {
+		r.RegisterSummarizer(provider, chatSummarizer(provider))
+		r.RegisterEmbeddingGenerator(provider, embeddingGenerator(provider))
+	}
+
+	r.RegisterTranscriber(ProviderFake, func(*config.Config) (Transcriber, error) { return NewFakeService(), nil })
+	r.RegisterDiarizer(ProviderFake, func(*config.Config) (Diarizer, error) { return NewFakeService(), nil })
+	r.RegisterSummarizer(ProviderFake, func(*config.Config) (Summarizer, error) { return NewFakeService(), nil })
+	r.RegisterEmbeddingGenerator(ProviderFake, func(*config.Config) (EmbeddingGenerator, error) { return NewFakeService(), nil })
+
+	return r
+}
+
+// RegisterTranscriber adds or replaces a transcription provider
+func (r *Registry) RegisterTranscriber(name string, factory TranscriberFactory) {
+	r.transcribers[name] = factory
+}
+
+// RegisterDiarizer adds or replaces a diarization provider
+func (r *Registry) RegisterDiarizer(name string, factory DiarizerFactory) {
+	r.diarizers[name] = factory
+}
+
+// RegisterSummarizer adds or replaces a summarization provider
+func (r *Registry) RegisterSummarizer(name string, factory SummarizerFactory) {
+	r.summarizers[name] = factory
+}
+
+// RegisterEmbeddingGenerator adds or replaces an embedding provider
+func (r *Registry) RegisterEmbeddingGenerator(name string, factory EmbeddingGeneratorFactory) {
+	r.embedders[name] = factory
+}
+
+// Transcriber builds the transcriber selected by TranscriptionProvider
+func (r *Registry) Transcriber(cfg *config.Config) (Transcriber, error) {
+	factory, err := lookup(r.transcribers, "transcription", cfg.TranscriptionProvider, ProviderOpenAI)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cfg)
+}
+
+// Diarizer builds the diarizer selected by DiarizationProvider. It returns
+// nil when diarization is off.
+func (r *Registry) Diarizer(cfg *config.Config) (Diarizer, error) {
+	factory, err := lookup(r.diarizers, "diarization", cfg.DiarizationProvider, ProviderNone)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cfg)
+}
+
+// Summarizer builds the summarizer selected by SummaryProvider
+func (r *Registry) Summarizer(cfg *config.Config) (Summarizer, error) {
+	factory, err := lookup(r.summarizers, "summary", cfg.SummaryProvider, ProviderOpenAI)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cfg)
+}
+
+// EmbeddingGenerator builds the embedding generator selected by
+// EmbeddingProvider
+func (r *Registry) EmbeddingGenerator(cfg *config.Config) (EmbeddingGenerator, error) {
+	factory, err := lookup(r.embedders, "embedding", cfg.EmbeddingProvider, ProviderOpenAI)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cfg)
+}
+
+// Build assembles the providers selected in cfg into one service. Every
+// capability is set up before it returns, so the error lists everything
+// that is misconfigured rather than just the first problem.
+func (r *Registry) Build(cfg *config.Config) (*Services, error) {
+	services := &Services{}
+	var errs []error
+	var err error
+
+	if services.Transcriber, err = r.Transcriber(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("transcription: %w", err))
+	}
+	if services.Diarizer, err = r.Diarizer(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("diarization: %w", err))
+	}
+	if services.Summarizer, err = r.Summarizer(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("summaries: %w", err))
+	}
+	if services.Embeddings, err = r.EmbeddingGenerator(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("embeddings: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to set up AI services: %w", errors.Join(errs...))
+	}
+	return services, nil
+}
+
+// lookup finds the factory of the named provider, or of fallback when no
+// provider is named
+func lookup[F any](factories map[string]F, capability, name, fallback string) (F, error) {
+	if name == "" {
+		name = fallback
+	}
+	factory, ok := factories[name]
+	if !ok {
+		known := slices.Sorted(maps.Keys(factories))
+		return factory, fmt.Errorf("unknown %s provider %q (want %s)", capability, name, strings.Join(known, ", "))
+	}
+	return factory, nil
+}
+
+// NewAIService builds the AI service configured in cfg from the built-in
+// providers
+func NewAIService(cfg *config.Config) (*Services, error) {
+	return NewRegistry().Build(cfg)
+}
+
+// NewSummarizer returns the summarizer selected by SummaryProvider
+func NewSummarizer(cfg *config.Config) (Summarizer, error) {
+	return NewRegistry().Summarizer(cfg)
+}
+
+// NewEmbeddingGenerator returns the embedding generator selected by
+// EmbeddingProvider
+func NewEmbeddingGenerator(cfg *config.Config) (EmbeddingGenerator, error) {
+	return NewRegistry().EmbeddingGenerator(cfg)
+}
+
+// openAIConfigFor returns the connection settings of an OpenAI-compatible
+// provider
+func openAIConfigFor(cfg *config.Config, provider string) (OpenAIConfig, error) {
+	switch provider {
+	case ProviderOpenAI:
+		// Without a key only a server of our own can be talked to
+		if cfg.OpenAIAPIKey == "" && cfg.OpenAIBaseURL == "" {
+			return OpenAIConfig{}, fmt.Errorf("OPENAI_API_KEY is not set")
+		}
+		return OpenAIConfig{
+			APIKey:             cfg.OpenAIAPIKey,
+			BaseURL:            cfg.OpenAIBaseURL,
+			TranscriptionModel: cfg.OpenAITranscriptionModel,
+		}, nil
+	case ProviderLocal:
+		if cfg.LocalLLMURL == "" {
+			return OpenAIConfig{}, fmt.Errorf("LOCAL_LLM_URL is not set")
+		}
+		return OpenAIConfig{
+			APIKey:  cfg.LocalLLMAPIKey,
+			BaseURL: cfg.LocalLLMURL,
+		}, nil
+	default:
+		return OpenAIConfig{}, fmt.Errorf("unknown OpenAI-compatible provider %q", provider)
+	}
+}
+
+// newOpenAITranscriber transcribes with the OpenAI API, in chunks when a
+// recording is over its upload limit
+func newOpenAITranscriber(cfg *config.Config) (Transcriber, error) {
+	openAIConfig, err := openAIConfigFor(cfg, ProviderOpenAI)
+	if err != nil {
+		return nil, err
+	}
+	return NewChunkedTranscriber(NewOpenAIService(openAIConfig), ChunkConfig{}), nil
+}
+
+// newWhisperCppTranscriber transcribes with the configured whisper.cpp binary
+// and model
+func newWhisperCppTranscriber(cfg *config.Config) (Transcriber, error) {
+	if cfg.WhisperCppModel == "" {
+		return nil, fmt.Errorf("WHISPER_CPP_MODEL is not set")
+	}
+	return NewWhisperCppTranscriber(WhisperCppConfig{
+		BinaryPath: cfg.WhisperCppBinary,
+		ModelPath:  cfg.WhisperCppModel,
+	})
+}
+
+// chatSummarizer returns the factory of summaries from an OpenAI-compatible
+// provider
+func chatSummarizer(provider string) SummarizerFactory {
+	return func(cfg *config.Config) (Summarizer, error) {
+		openAIConfig, err := openAIConfigFor(cfg, provider)
+		if err != nil {
+			return nil, err
+		}
+		if provider == ProviderLocal && cfg.SummaryModel == "" {
+			return nil, fmt.Errorf("SUMMARY_MODEL must name a model on the local server")
+		}
+		openAIConfig.ChatModel = cfg.SummaryModel
+		openAIConfig.SummaryChunkChars = cfg.SummaryChunkChars
+		return NewOpenAIService(openAIConfig), nil
+	}
+}
+
+// embeddingGenerator returns the factory of embeddings from an
+// OpenAI-compatible provider
+func embeddingGenerator(provider string) EmbeddingGeneratorFactory {
+	return func(cfg *config.Config) (EmbeddingGenerator, error) {
+		openAIConfig, err := openAIConfigFor(cfg, provider)
+		if err != nil {
+			return nil, err
+		}
+		if provider == ProviderLocal && cfg.EmbeddingModel == "" {
+			return nil, fmt.Errorf("EMBEDDING_MODEL must name a model on the local server")
+		}
+		openAIConfig.EmbeddingModel = cfg.EmbeddingModel
+		return NewOpenAIService(openAIConfig), nil
+	}
+}
+
+// Services is an AIService assembled from one provider per capability
+type Services struct {
+	Transcriber Transcriber
+	Diarizer    Diarizer // Nil when diarization is off
+	Summarizer  Summarizer
+	Embeddings  EmbeddingGenerator
+}
+
+// TranscribeFile transcribes a recording, then labels its speakers if
+// diarization is on
+func (s *Services) TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error) {
+	result, err := s.Transcriber.TranscribeFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if s.Diarizer == nil {
+		return result, nil
+	}
+
+	result, err = s.Diarizer.Diarize(ctx, filePath, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diarize transcription: %w", err)
+	}
+	return result, nil
+}
+
+// TranscribeStream transcribes an audio stream. Diarization needs the
+// recording's file, so streams aren't diarized.
+func (s *Services) TranscribeStream(ctx context.Context, audioStream io.Reader) (*TranscriptionResult, error) {
+	return s.Transcriber.TranscribeStream(ctx, audioStream)
+}
+
+// SummarizeSession generates a structured summary from a transcription
+func (s *Services) SummarizeSession(ctx context.Context, transcription *TranscriptionResult) (*SessionSummary, error) {
+	return s.Summarizer.SummarizeSession(ctx, transcription)
+}
+
+// SummarizeText generates a summary from raw text
+func (s *Services) SummarizeText(ctx context.Context, text string) (*SessionSummary, error) {
+	return s.Summarizer.SummarizeText(ctx, text)
+}
+
+// GenerateEmbedding creates an embedding for the given text
+func (s *Services) GenerateEmbedding(ctx context.Context, text string) (*Embedding, error) {
+	return s.Embeddings.GenerateEmbedding(ctx, text)
+}
+
+// GenerateBatchEmbeddings creates embeddings for multiple texts
+func (s *Services) GenerateBatchEmbeddings(ctx context.Context, texts []string) ([]*Embedding, error) {
+	return s.Embeddings.GenerateBatchEmbeddings(ctx, texts)
+}
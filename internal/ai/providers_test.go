@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
+)
+
+func TestRegistryBuild(t *testing.T) {
+	services, err := NewAIService(&config.Config{
+		TranscriptionProvider: ProviderFake,
+		DiarizationProvider:   ProviderFake,
+		SummaryProvider:       ProviderFake,
+		EmbeddingProvider:     ProviderFake,
+	})
+	if err != nil {
+		t.Fatalf("NewAIService: %v", err)
+	}
+	var _ AIService = services
+
+	ctx := context.Background()
+	result, err := services.TranscribeFile(ctx, "session.wav")
+	if err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+	if len(result.Segments) < 2 || result.Segments[0].Speaker != "SPEAKER_00" || result.Segments[1].Speaker != "SPEAKER_01" {
+		t.Errorf("segments weren't diarized: %+v", result.Segments)
+	}
+
+	summary, err := services.SummarizeSession(ctx, result)
+	if err != nil || summary.Overview != result.Segments[0].Text {
+		t.Errorf("SummarizeSession = %+v, %v", summary, err)
+	}
+
+	embeddings, err := services.GenerateBatchEmbeddings(ctx, []string{"The goblin attacks", "the goblin attacks!", "I cast fireball"})
+	if err != nil {
+		t.Fatalf("GenerateBatchEmbeddings: %v", err)
+	}
+	similarity := func(a, b *Embedding) (dot float64) {
+		for i := range a.Vector {
+			dot += a.Vector[i] * b.Vector[i]
+		}
+		return dot
+	}
+	if same, different := similarity(embeddings[0], embeddings[1]), similarity(embeddings[0], embeddings[2]); same < 0.999 || different >= same {
+		t.Errorf("similarity of the same text %v, of different texts %v", same, different)
+	}
+}
+
+func TestRegistryBuildDiarizationOff(t *testing.T) {
+	services, err := NewAIService(&config.Config{
+		TranscriptionProvider: ProviderFake,
+		SummaryProvider:       ProviderFake,
+		EmbeddingProvider:     ProviderFake,
+	})
+	if err != nil {
+		t.Fatalf("NewAIService: %v", err)
+	}
+	if services.Diarizer != nil {
+		t.Errorf("diarizer = %T, want none by default", services.Diarizer)
+	}
+
+	result, err := services.TranscribeFile(context.Background(), "session.wav")
+	if err != nil || result.Segments[0].Speaker != "" {
+		t.Errorf("TranscribeFile = %+v, %v", result, err)
+	}
+}
+
+func TestRegistryBuildErrors(t *testing.T) {
+	_, err := NewAIService(&config.Config{
+		TranscriptionProvider: ProviderWhisperCpp,
+		DiarizationProvider:   "pyannote",
+		SummaryProvider:       ProviderOpenAI,
+		EmbeddingProvider:     ProviderFake,
+	})
+	if err == nil {
+		t.Fatal("NewAIService accepted a misconfigured service")
+	}
+
+	// Every problem is reported at once
+	for _, want := range []string{
+		"transcription: WHISPER_CPP_MODEL is not set",
+		`diarization: unknown diarization provider "pyannote" (want fake, none)`,
+		"summaries: OPENAI_API_KEY is not set",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't include %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "embeddings") {
+		t.Errorf("error %q blames the working embedding provider", err)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterDiarizer("pyannote", func(*config.Config) (Diarizer, error) { return NewFakeService(), nil })
+
+	services, err := registry.Build(&config.Config{
+		TranscriptionProvider: ProviderFake,
+		DiarizationProvider:   "pyannote",
+		SummaryProvider:       ProviderFake,
+		EmbeddingProvider:     ProviderFake,
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if services.Diarizer == nil {
+		t.Error("the registered diarizer wasn't used")
+	}
+}
@@ -0,0 +1,330 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats whisper.cpp can be asked for
+const (
+	WhisperOutputJSON = "json" // Full JSON, with token probabilities for confidence
+	WhisperOutputSRT  = "srt"  // Subtitles, for builds without full JSON output
+)
+
+// WhisperCppConfig configures a WhisperCppTranscriber
+type WhisperCppConfig struct {
+	// BinaryPath is the whisper.cpp command line program, e.g. whisper-cli
+	BinaryPath string
+
+	// ModelPath is the ggml model file to transcribe with
+	ModelPath string
+
+	// Language is the spoken language, e.g. "en". Empty detects it.
+	Language string
+
+	// Threads is how many CPU threads whisper.cpp uses. Zero leaves it to
+	// whisper.cpp.
+	Threads int
+
+	// OutputFormat selects the output parsed, WhisperOutputJSON (the
+	// default) or WhisperOutputSRT
+	OutputFormat string
+
+	// Timeout stops a transcription that takes longer than this. Zero only
+	// stops it when the context is done.
+	Timeout time.Duration
+
+	// Progress, if set, is called with the percentage of the file
+	// transcribed as whisper.cpp reports it
+	Progress func(percent int)
+}
+
+// WhisperCppTranscriber transcribes recordings locally by running whisper.cpp
+// as a subprocess, so no audio leaves the machine
+type WhisperCppTranscriber struct {
+	config WhisperCppConfig
+}
+
+// NewWhisperCppTranscriber creates a transcriber running the configured
+// whisper.cpp binary. It fails if the binary or model can't be found.
+func NewWhisperCppTranscriber(cfg WhisperCppConfig) (*WhisperCppTranscriber, error) {
+	if cfg.OutputFormat == "" {
+		cfg.OutputFormat = WhisperOutputJSON
+	}
+	if cfg.OutputFormat != WhisperOutputJSON && cfg.OutputFormat != WhisperOutputSRT {
+		return nil, fmt.Errorf("unknown whisper.cpp output format %q (want json or srt)", cfg.OutputFormat)
+	}
+
+	binary, err := exec.LookPath(cfg.BinaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find whisper.cpp binary: %w", err)
+	}
+	cfg.BinaryPath = binary
+	if _, err := os.Stat(cfg.ModelPath); err != nil {
+		return nil, fmt.Errorf("failed to find whisper.cpp model: %w", err)
+	}
+
+	return &WhisperCppTranscriber{config: cfg}, nil
+}
+
+// progressPattern matches the progress lines whisper.cpp prints with -pp
+var progressPattern = regexp.MustCompile(`progress\s*=\s*(\d+)%`)
+
+// TranscribeFile transcribes a WAV or FLAC recording. FLAC recordings are
+// decoded to WAV first, which whisper.cpp reads natively. whisper.cpp has no
+// speaker diarization, so Speaker is left empty.
+func (t *WhisperCppTranscriber) TranscribeFile(ctx context.Context, filePath string) (*TranscriptionResult, error) {
+	if t.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.config.Timeout)
+		defer cancel()
+	}
+
+	tmpDir, err := os.MkdirTemp("", "whisper-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filePath, err = wavInput(filePath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	outputPrefix := filepath.Join(tmpDir, "transcript")
+	args := []string{"-m", t.config.ModelPath, "-f", filePath, "-of", outputPrefix, "-pp"}
+	if t.config.OutputFormat == WhisperOutputSRT {
+		args = append(args, "-osrt")
+	} else {
+		args = append(args, "-ojf")
+	}
+	language := t.config.Language
+	if language == "" {
+		language = "auto"
+	}
+	args = append(args, "-l", language)
+	if t.config.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(t.config.Threads))
+	}
+
+	if err := t.run(ctx, args); err != nil {
+		return nil, err
+	}
+
+	output, err := os.ReadFile(outputPrefix + "." + t.config.OutputFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read whisper.cpp output: %w", err)
+	}
+
+	var result *TranscriptionResult
+	if t.config.OutputFormat == WhisperOutputSRT {
+		result, err = parseSRT(output)
+	} else {
+		result, err = parseWhisperJSON(output)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse whisper.cpp output: %w", err)
+	}
+	if result.Language == "" && t.config.Language != "" {
+		result.Language = t.config.Language
+	}
+	return result, nil
+}
+
+// run runs whisper.cpp, reporting its progress as it goes. The process is
+// killed when ctx is done.
+func (t *WhisperCppTranscriber) run(ctx context.Context, args []string) error {
+	log := &whisperLog{progress: t.config.Progress}
+	cmd := exec.CommandContext(ctx, t.config.BinaryPath, args...)
+	cmd.Stderr = log
+	// Don't wait for children that kept stderr open after a kill
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("whisper.cpp was stopped: %w", ctxErr)
+	}
+	if err != nil {
+		return fmt.Errorf("whisper.cpp failed: %w: %s", err, strings.Join(log.tail, "\n"))
+	}
+	return nil
+}
+
+// whisperLog reads whisper.cpp's log line by line, passing on progress and
+// keeping the last few lines for error messages
+type whisperLog struct {
+	progress func(percent int)
+	partial  []byte
+	tail     []string
+}
+
+func (l *whisperLog) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		line, rest, found := bytes.Cut(l.partial, []byte("\n"))
+		if !found {
+			break
+		}
+		l.partial = rest
+		l.line(strings.TrimSpace(string(line)))
+	}
+	return len(p), nil
+}
+
+// line handles one complete line of the log
+func (l *whisperLog) line(line string) {
+	if match := progressPattern.FindStringSubmatch(line); match != nil {
+		if l.progress != nil {
+			percent, _ := strconv.Atoi(match[1])
+			l.progress(percent)
+		}
+		return
+	}
+	if line == "" {
+		return
+	}
+	if l.tail = append(l.tail, line); len(l.tail) > 5 {
+		l.tail = l.tail[1:]
+	}
+}
+
+// TranscribeStream saves the stream, which must hold a WAV file, and
+// transcribes it
+func (t *WhisperCppTranscriber) TranscribeStream(ctx context.Context, audioStream io.Reader) (*TranscriptionResult, error) {
+	file, err := os.CreateTemp("", "whisper-*.wav")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audio file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, audioStream); err != nil {
+		return nil, fmt.Errorf("failed to save audio stream: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to save audio stream: %w", err)
+	}
+
+	return t.TranscribeFile(ctx, file.Name())
+}
+
+// whisperJSON is the part of whisper.cpp's full JSON output we use
+type whisperJSON struct {
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"` // Milliseconds
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text   string `json:"text"`
+		Tokens []struct {
+			Text string  `json:"text"`
+			P    float64 `json:"p"`
+		} `json:"tokens"`
+	} `json:"transcription"`
+}
+
+// parseWhisperJSON converts whisper.cpp's JSON output. A segment's confidence
+// is the mean probability of its text tokens.
+func parseWhisperJSON(data []byte) (*TranscriptionResult, error) {
+	var output whisperJSON
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+
+	result := &TranscriptionResult{Language: output.Result.Language}
+	var texts []string
+	for _, entry := range output.Transcription {
+		segment := TranscriptionSegment{
+			Text:  strings.TrimSpace(entry.Text),
+			Start: float64(entry.Offsets.From) / 1000,
+			End:   float64(entry.Offsets.To) / 1000,
+		}
+
+		var sum float64
+		var tokens int
+		for _, token := range entry.Tokens {
+			// Skip special tokens such as [_BEG_] and timestamps
+			if strings.HasPrefix(token.Text, "[_") {
+				continue
+			}
+			sum += token.P
+			tokens++
+		}
+		if tokens > 0 {
+			segment.Confidence = sum / float64(tokens)
+		}
+
+		result.Segments = append(result.Segments, segment)
+		texts = append(texts, segment.Text)
+		result.Duration = segment.End
+	}
+
+	result.FullText = strings.Join(texts, " ")
+	return result, nil
+}
+
+// parseSRT converts subtitles as written by whisper.cpp. SRT has no
+// confidence, so it is left 0.
+func parseSRT(data []byte) (*TranscriptionResult, error) {
+	result := &TranscriptionResult{}
+	var texts []string
+
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	for _, block := range strings.Split(strings.TrimSpace(string(data)), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if len(lines) < 2 {
+			continue
+		}
+
+		// The index line is optional in practice
+		if !strings.Contains(lines[0], "-->") {
+			lines = lines[1:]
+		}
+		from, to, found := strings.Cut(lines[0], "-->")
+		if !found {
+			return nil, fmt.Errorf("invalid subtitle timing %q", lines[0])
+		}
+		start, err := parseSRTTime(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseSRTTime(to)
+		if err != nil {
+			return nil, err
+		}
+
+		segment := TranscriptionSegment{
+			Text:  strings.TrimSpace(strings.Join(lines[1:], " ")),
+			Start: start,
+			End:   end,
+		}
+		result.Segments = append(result.Segments, segment)
+		texts = append(texts, segment.Text)
+		result.Duration = end
+	}
+
+	result.FullText = strings.Join(texts, " ")
+	return result, nil
+}
+
+// parseSRTTime parses an SRT timestamp such as 00:01:02,345 into seconds
+func parseSRTTime(s string) (float64, error) {
+	var hours, minutes, seconds, millis int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d:%d,%d", &hours, &minutes, &seconds, &millis); err != nil {
+		return 0, fmt.Errorf("invalid subtitle timestamp %q", s)
+	}
+	return float64(hours*3600+minutes*60+seconds) + float64(millis)/1000, nil
+}
@@ -0,0 +1,218 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/flac"
+)
+
+// fakeWhisper writes a shell script standing in for whisper.cpp. It reports
+// progress on stderr, keeps a copy of its input, runs body and then writes output to the file named by
+// -of plus the extension for the requested format.
+func fakeWhisper(t *testing.T, body, output string) WhisperCppConfig {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake whisper.cpp binary is a shell script")
+	}
+
+	dir := t.TempDir()
+	model := filepath.Join(dir, "ggml-base.en.bin")
+	if err := os.WriteFile(model, []byte("model"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "output"), []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `#!/bin/sh
+echo "$@" > "` + dir + `/args"
+prefix= ext=json
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-f) cp "$2" "` + dir + `/input" ;;
+		-of) prefix="$2"; shift ;;
+		-osrt) ext=srt ;;
+	esac
+	shift
+done
+echo "whisper_init_from_file: loading model" >&2
+echo "whisper_print_progress_callback: progress =  50%" >&2
+` + body + `
+echo "whisper_print_progress_callback: progress = 100%" >&2
+cp "` + dir + `/output" "$prefix.$ext"
+`
+	binary := filepath.Join(dir, "whisper-cli")
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return WhisperCppConfig{BinaryPath: binary, ModelPath: model}
+}
+
+func TestWhisperCppTranscribeFile(t *testing.T) {
+	cfg := fakeWhisper(t, "", `{
+		"result": {"language": "en"},
+		"transcription": [
+			{
+				"timestamps": {"from": "00:00:00,000", "to": "00:00:03,200"},
+				"offsets": {"from": 0, "to": 3200},
+				"text": " Roll for initiative.",
+				"tokens": [
+					{"text": "[_BEG_]", "p": 0.1},
+					{"text": " Roll", "p": 0.9},
+					{"text": " for initiative.", "p": 0.7}
+				]
+			},
+			{
+				"timestamps": {"from": "00:00:03,200", "to": "00:00:07,500"},
+				"offsets": {"from": 3200, "to": 7500},
+				"text": " The goblin attacks!",
+				"tokens": [{"text": " The goblin attacks!", "p": 0.6}]
+			}
+		]
+	}`)
+	cfg.Threads = 4
+	var progress []int
+	cfg.Progress = func(percent int) { progress = append(progress, percent) }
+
+	transcriber, err := NewWhisperCppTranscriber(cfg)
+	if err != nil {
+		t.Fatalf("NewWhisperCppTranscriber: %v", err)
+	}
+	audio := writeWords(t, 2)
+	result, err := transcriber.TranscribeFile(context.Background(), audio)
+	if err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(filepath.Dir(cfg.BinaryPath), "args"))
+	for _, want := range []string{"-m " + cfg.ModelPath, "-f " + audio, "-ojf", "-l auto", "-t 4"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("arguments %q don't include %q", args, want)
+		}
+	}
+	if len(progress) != 2 || progress[0] != 50 || progress[1] != 100 {
+		t.Errorf("progress = %v, want [50 100]", progress)
+	}
+
+	if result.Language != "en" || result.Duration != 7.5 || result.FullText != "Roll for initiative. The goblin attacks!" {
+		t.Errorf("result = %+v", result)
+	}
+	want := []TranscriptionSegment{
+		{Text: "Roll for initiative.", Start: 0, End: 3.2, Confidence: 0.8},
+		{Text: "The goblin attacks!", Start: 3.2, End: 7.5, Confidence: 0.6},
+	}
+	if len(result.Segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(result.Segments), len(want))
+	}
+	for i, segment := range result.Segments {
+		if segment.Text != want[i].Text || segment.Start != want[i].Start || segment.End != want[i].End || math.Abs(segment.Confidence-want[i].Confidence) > 1e-9 {
+			t.Errorf("segment %d = %+v, want %+v", i, segment, want[i])
+		}
+	}
+}
+
+func TestWhisperCppSRT(t *testing.T) {
+	cfg := fakeWhisper(t, "", "1\r\n00:00:00,000 --> 00:00:02,500\r\nI cast fireball.\r\n\r\n2\r\n00:00:02,500 --> 00:01:04,250\r\nAt the dragon?\r\n")
+	cfg.OutputFormat = WhisperOutputSRT
+	cfg.Language = "en"
+
+	transcriber, err := NewWhisperCppTranscriber(cfg)
+	if err != nil {
+		t.Fatalf("NewWhisperCppTranscriber: %v", err)
+	}
+	result, err := transcriber.TranscribeFile(context.Background(), writeWords(t, 1))
+	if err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+
+	if len(result.Segments) != 2 || result.Segments[1].Text != "At the dragon?" || result.Segments[1].Start != 2.5 || result.Segments[1].End != 64.25 {
+		t.Errorf("segments = %+v", result.Segments)
+	}
+	if result.Language != "en" || result.FullText != "I cast fireball. At the dragon?" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestWhisperCppFLAC(t *testing.T) {
+	cfg := fakeWhisper(t, "", `{"transcription": []}`)
+	transcriber, err := NewWhisperCppTranscriber(cfg)
+	if err != nil {
+		t.Fatalf("NewWhisperCppTranscriber: %v", err)
+	}
+
+	source := writeWords(t, 3)
+	data, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "session.flac")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	enc, err := flac.NewEncoder(file, speech)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	if err := enc.Write(data[speech.HeaderSize():]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := transcriber.TranscribeFile(context.Background(), path); err != nil {
+		t.Fatalf("TranscribeFile: %v", err)
+	}
+
+	// whisper.cpp is given the recording decoded to WAV
+	input, err := os.ReadFile(filepath.Join(filepath.Dir(cfg.BinaryPath), "input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(input) != string(data) {
+		t.Errorf("whisper.cpp got %d bytes, want the %d byte WAV the FLAC file was encoded from", len(input), len(data))
+	}
+}
+
+func TestWhisperCppTimeout(t *testing.T) {
+	cfg := fakeWhisper(t, "sleep 10", "{}")
+	cfg.Timeout = 200 * time.Millisecond
+
+	transcriber, err := NewWhisperCppTranscriber(cfg)
+	if err != nil {
+		t.Fatalf("NewWhisperCppTranscriber: %v", err)
+	}
+
+	start := time.Now()
+	_, err = transcriber.TranscribeFile(context.Background(), writeWords(t, 1))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TranscribeFile error = %v, want a deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("TranscribeFile took %v after the timeout", elapsed)
+	}
+}
+
+func TestWhisperCppFailure(t *testing.T) {
+	cfg := fakeWhisper(t, `echo "error: failed to read WAV file" >&2; exit 1`, "")
+
+	transcriber, err := NewWhisperCppTranscriber(cfg)
+	if err != nil {
+		t.Fatalf("NewWhisperCppTranscriber: %v", err)
+	}
+	_, err = transcriber.TranscribeFile(context.Background(), writeWords(t, 1))
+	if err == nil || !strings.Contains(err.Error(), "failed to read WAV file") {
+		t.Errorf("TranscribeFile error = %v, want whisper.cpp's message", err)
+	}
+}
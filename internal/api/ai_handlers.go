@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/ai"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// TranscriptionJob is the state of a transcription that runs in the
+// background
+type TranscriptionJob struct {
+	RecordingID         int64  `json:"recording_id"`
+	TranscriptionStatus string `json:"transcription_status"`
+}
+
+// SetAIService lets the API transcribe and summarize recordings. Without one
+// the AI endpoints respond 503.
+func (a *API) SetAIService(service ai.AIService) {
+	a.ai = service
+}
+
+// registerAIRoutes registers the transcription and summary endpoints
+func (a *API) registerAIRoutes(api *mux.Router) {
+	api.HandleFunc("/recordings/{id}/transcribe", requireJSON(a.transcribeRecording(false))).Methods("POST")
+	api.HandleFunc("/recordings/{id}/summarize", requireJSON(a.transcribeRecording(true))).Methods("POST")
+	api.HandleFunc("/recordings/{id}/transcript", a.getTranscript).Methods("GET")
+}
+
+// transcribeRecording returns a handler that starts transcribing a completed
+// recording in the background and, if summarize is set, summarizing the
+// transcript. It responds 202 while the job runs; once the transcript is
+// stored, it responds with that instead of transcribing again.
+func (a *API) transcribeRecording(summarize bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.ai == nil {
+			respondError(w, http.StatusServiceUnavailable, "AI services are not enabled on this server; set AI_ENABLED=true")
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid recording ID")
+			return
+		}
+
+		recording, err := a.recordingRepo.GetByID(id)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "Recording not found")
+			return
+		}
+		if recording.Status != models.RecordingStatusCompleted {
+			respondError(w, http.StatusConflict, fmt.Sprintf("Recording is %s; only completed recordings can be transcribed", recording.Status))
+			return
+		}
+
+		transcript, err := a.recordingRepo.GetTranscript(id)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get transcript: %v", err))
+			return
+		}
+		if transcript != nil && (!summarize || transcript.Summary != nil) {
+			respondJSON(w, http.StatusOK, transcript)
+			return
+		}
+
+		// A job already running for the recording is left to finish
+		started, err := a.recordingRepo.StartTranscription(id)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to start transcription: %v", err))
+			return
+		}
+		if started {
+			go a.runTranscription(recording, transcript, summarize)
+		}
+
+		respondJSON(w, http.StatusAccepted, TranscriptionJob{
+			RecordingID:         id,
+			TranscriptionStatus: models.TranscriptionStatusProcessing,
+		})
+	}
+}
+
+// getTranscript returns the stored transcript of a recording
+func (a *API) getTranscript(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	recording, err := a.recordingRepo.GetByID(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Recording not found")
+		return
+	}
+
+	transcript, err := a.recordingRepo.GetTranscript(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get transcript: %v", err))
+		return
+	}
+	if transcript == nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Recording has no transcript; transcription is %s", recording.TranscriptionStatus))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, transcript)
+}
+
+// runTranscription transcribes a recording unless transcript already holds
+// its transcription, summarizes it if asked to and stores the result. The
+// recording's transcription is marked failed if any of it fails.
+func (a *API) runTranscription(recording *models.Recording, transcript *models.RecordingTranscript, summarize bool) {
+	ctx := context.Background()
+
+	err := func() error {
+		if transcript == nil {
+			path, cleanup, err := a.audioFile(recording)
+			if err != nil {
+				return fmt.Errorf("failed to read recording audio: %w", err)
+			}
+			defer cleanup()
+
+			result, err := a.ai.TranscribeFile(ctx, path)
+			if err != nil {
+				return fmt.Errorf("failed to transcribe recording: %w", err)
+			}
+			transcript = newTranscript(recording.ID, result)
+		}
+
+		if summarize {
+			summary, err := a.ai.SummarizeSession(ctx, transcriptionResult(transcript))
+			if err != nil {
+				return fmt.Errorf("failed to summarize recording: %w", err)
+			}
+			transcript.Summary = &models.TranscriptSummary{
+				Overview:     summary.Overview,
+				KeyEvents:    summary.KeyEvents,
+				NPCs:         summary.NPCs,
+				Locations:    summary.Locations,
+				Items:        summary.Items,
+				Combat:       summary.Combat,
+				Decisions:    summary.Decisions,
+				Cliffhangers: summary.Cliffhangers,
+			}
+		}
+
+		return a.recordingRepo.SaveTranscript(transcript)
+	}()
+	if err != nil {
+		log.Printf("Transcription of recording %d failed: %v", recording.ID, err)
+		if err := a.recordingRepo.MarkTranscriptionFailed(recording.ID); err != nil {
+			log.Printf("Failed to mark transcription of recording %d failed: %v", recording.ID, err)
+		}
+	}
+}
+
+// newTranscript converts the result of a transcription into a transcript
+// to store
+func newTranscript(recordingID int64, result *ai.TranscriptionResult) *models.RecordingTranscript {
+	transcript := &models.RecordingTranscript{
+		RecordingID:     recordingID,
+		Language:        result.Language,
+		DurationSeconds: result.Duration,
+		Text:            result.FullText,
+		Segments:        make([]models.TranscriptSegment, len(result.Segments)),
+	}
+	for i, segment := range result.Segments {
+		transcript.Segments[i] = models.TranscriptSegment{
+			Speaker: segment.Speaker,
+			Text:    segment.Text,
+			Start:   segment.Start,
+			End:     segment.End,
+		}
+	}
+	return transcript
+}
+
+// transcriptionResult converts a stored transcript back into the result of
+// a transcription, to summarize it
+func transcriptionResult(transcript *models.RecordingTranscript) *ai.TranscriptionResult {
+	result := &ai.TranscriptionResult{
+		FullText: transcript.Text,
+		Language: transcript.Language,
+		Duration: transcript.DurationSeconds,
+		Segments: make([]ai.TranscriptionSegment, len(transcript.Segments)),
+	}
+	for i, segment := range transcript.Segments {
+		result.Segments[i] = ai.TranscriptionSegment{
+			Speaker: segment.Speaker,
+			Text:    segment.Text,
+			Start:   segment.Start,
+			End:     segment.End,
+		}
+	}
+	return result
+}
+
+// audioFile returns the path of a single file holding the recording's audio.
+// Segmented recordings are joined into a temporary WAV file, which cleanup
+// removes.
+func (a *API) audioFile(recording *models.Recording) (path string, cleanup func(), err error) {
+	segments, err := a.recordingRepo.ListSegments(recording.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(segments) <= 1 {
+		return recording.FilePath, func() {}, nil
+	}
+
+	paths := make([]string, len(segments))
+	for i, segment := range segments {
+		paths[i] = segment.FilePath
+	}
+	audio, err := wav.OpenConcat(paths)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open recording segments: %w", err)
+	}
+	defer audio.Close()
+
+	dir, err := os.MkdirTemp("", "recording-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	path = filepath.Join(dir, recording.Filename)
+	file, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to join recording segments: %w", err)
+	}
+	_, err = io.Copy(file, io.NewSectionReader(audio, 0, audio.Size()))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to join recording segments: %w", err)
+	}
+	return path, cleanup, nil
+}
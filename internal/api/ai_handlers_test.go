@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/ai"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// checkedFakeService is the fake AI service, but it fails unless it's given
+// a single readable WAV file. It counts the transcriptions it runs.
+type checkedFakeService struct {
+	*ai.FakeService
+
+	mu             sync.Mutex
+	dataSize       int64
+	transcriptions int
+}
+
+func (s *checkedFakeService) TranscribeFile(ctx context.Context, filePath string) (*ai.TranscriptionResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := wav.ReadInfo(file)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.dataSize = info.DataSize
+	s.transcriptions++
+	s.mu.Unlock()
+	return s.FakeService.TranscribeFile(ctx, filePath)
+}
+
+func TestTranscribeRecording(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.New(db.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	repo := db.NewRecordingRepository(database)
+
+	// A segmented recording, which is joined into one file to transcribe
+	rec, err := recorder.New(recorder.Config{
+		DataDir:         dir,
+		DB:              repo,
+		Source:          recorder.NewToneSource(440, 0.5),
+		SegmentDuration: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	id := rec.GetRecordingID()
+	segments, _ := repo.ListSegments(id)
+	if len(segments) < 2 {
+		t.Fatalf("got %d segments, want several", len(segments))
+	}
+	live, err := repo.Create(models.CreateRecordingParams{FileID: "live", Filename: "live.wav", FilePath: filepath.Join(dir, "live.wav")})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	missing, err := repo.Create(models.CreateRecordingParams{FileID: "missing", Filename: "missing.wav", FilePath: filepath.Join(dir, "missing.wav")})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.MarkCompleted(missing.ID, 60, 1000, models.StopReasonUser); err != nil {
+		t.Fatalf("MarkCompleted: %v", err)
+	}
+
+	a := NewAPI(repo, dir)
+	router := mux.NewRouter()
+	a.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	post := func(path, contentType string) int {
+		t.Helper()
+		resp, err := http.Post(server.URL+path, contentType, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	path := func(id int64, action string) string {
+		return "/api/recordings/" + strconv.FormatInt(id, 10) + "/" + action
+	}
+	// waitForTranscript polls until the background job has stored a
+	// transcript that satisfies done
+	waitForTranscript := func(done func(*models.RecordingTranscript) bool) *models.RecordingTranscript {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			resp, err := http.Get(server.URL + path(id, "transcript"))
+			if err != nil {
+				t.Fatalf("GET transcript: %v", err)
+			}
+			var transcript models.RecordingTranscript
+			if resp.StatusCode == http.StatusOK {
+				if err := json.NewDecoder(resp.Body).Decode(&transcript); err != nil {
+					t.Fatalf("failed to decode transcript: %v", err)
+				}
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && done(&transcript) {
+				return &transcript
+			}
+		}
+		t.Fatal("the transcript wasn't stored in time")
+		return nil
+	}
+
+	if code := post(path(id, "transcribe"), "application/json"); code != http.StatusServiceUnavailable {
+		t.Errorf("transcribe without AI services = %d, want 503", code)
+	}
+
+	service := &checkedFakeService{FakeService: ai.NewFakeService()}
+	a.SetAIService(service)
+
+	if code := post(path(id, "transcribe"), "application/json"); code != http.StatusAccepted {
+		t.Fatalf("transcribe = %d, want 202", code)
+	}
+	transcript := waitForTranscript(func(*models.RecordingTranscript) bool { return true })
+	if transcript.RecordingID != id || len(transcript.Segments) == 0 || transcript.Summary != nil {
+		t.Fatalf("transcript = %+v", transcript)
+	}
+	if recording, _ := repo.GetByID(id); recording.TranscriptionStatus != models.TranscriptionStatusCompleted {
+		t.Errorf("transcription status = %q, want completed", recording.TranscriptionStatus)
+	}
+
+	var want int64
+	for _, segment := range segments {
+		file, _ := os.Open(segment.FilePath)
+		info, err := wav.ReadInfo(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += info.DataSize
+	}
+	service.mu.Lock()
+	if service.dataSize != want {
+		t.Errorf("transcriber got %d bytes of audio, want all %d of the segments", service.dataSize, want)
+	}
+	service.mu.Unlock()
+
+	// The stored transcript is returned rather than transcribed again, and
+	// a summary is added to it
+	if code := post(path(id, "transcribe"), "application/json"); code != http.StatusOK {
+		t.Errorf("transcribe of a transcribed recording = %d, want 200", code)
+	}
+	if code := post(path(id, "summarize"), "application/json"); code != http.StatusAccepted {
+		t.Errorf("summarize = %d, want 202", code)
+	}
+	transcript = waitForTranscript(func(transcript *models.RecordingTranscript) bool { return transcript.Summary != nil })
+	if transcript.Summary.Overview != transcript.Segments[0].Text {
+		t.Errorf("summary = %+v", transcript.Summary)
+	}
+	if code := post(path(id, "summarize"), "application/json"); code != http.StatusOK {
+		t.Errorf("summarize of a summarized recording = %d, want 200", code)
+	}
+	service.mu.Lock()
+	if service.transcriptions != 1 {
+		t.Errorf("recording transcribed %d times, want once", service.transcriptions)
+	}
+	service.mu.Unlock()
+
+	// A job that fails marks the transcription failed
+	if code := post(path(missing.ID, "transcribe"), "application/json"); code != http.StatusAccepted {
+		t.Errorf("transcribe of a recording without audio = %d, want 202", code)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		recording, _ := repo.GetByID(missing.ID)
+		if recording.TranscriptionStatus == models.TranscriptionStatusFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transcription status = %q, want failed", recording.TranscriptionStatus)
+		}
+	}
+
+	if code := post(path(id, "transcribe"), "text/plain"); code != http.StatusUnsupportedMediaType {
+		t.Errorf("transcribe without JSON = %d, want 415", code)
+	}
+	if code := post(path(live.ID, "transcribe"), "application/json"); code != http.StatusConflict {
+		t.Errorf("transcribe of an unfinished recording = %d, want 409", code)
+	}
+	if code := post(path(id+100, "transcribe"), "application/json"); code != http.StatusNotFound {
+		t.Errorf("transcribe of a missing recording = %d, want 404", code)
+	}
+}
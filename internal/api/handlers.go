@@ -3,16 +3,24 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/ai"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
 )
 
 type API struct {
 	recordingRepo *db.RecordingRepository
 	dataDir       string
+	recorder      *recorder.Recorder // Optional, see SetRecorder
+	ai            ai.AIService       // Optional, see SetAIService
 }
 
 func NewAPI(recordingRepo *db.RecordingRepository, dataDir string) *API {
@@ -31,6 +39,15 @@ func (a *API) RegisterRoutes(r *mux.Router) {
 	api.HandleFunc("/recordings/{id}", a.getRecording).Methods("GET")
 	api.HandleFunc("/recordings/{id}", a.deleteRecording).Methods("DELETE")
 	api.HandleFunc("/recordings/{id}/audio", a.streamAudio).Methods("GET")
+	api.HandleFunc("/recordings/{id}/silences", a.listSilences).Methods("GET")
+	api.HandleFunc("/recordings/{id}/markers", a.listMarkers).Methods("GET")
+	api.HandleFunc("/recordings/{id}/tracks", a.listTracks).Methods("GET")
+
+	// Remote control of a recorder hosted by this server
+	a.registerRecorderRoutes(api)
+
+	// Transcripts and summaries from the AI services
+	a.registerAIRoutes(api)
 
 	// Health check
 	api.HandleFunc("/health", a.healthCheck).Methods("GET")
@@ -74,6 +91,12 @@ func (a *API) deleteRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The recorder still writes to a recording it is making
+	if a.isRecording(id) {
+		respondError(w, http.StatusConflict, "Recording is still in progress; stop it first")
+		return
+	}
+
 	if err := a.recordingRepo.Delete(id); err != nil {
 		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete recording: %v", err))
 		return
@@ -82,7 +105,8 @@ func (a *API) deleteRecording(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Recording deleted"})
 }
 
-// streamAudio streams the audio file for a recording
+// streamAudio streams the audio file for a recording. For multi-track
+// recordings that's the mixdown; ?track=N streams the track with index N.
 func (a *API) streamAudio(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -97,10 +121,131 @@ func (a *API) streamAudio(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Serve the audio file
-	w.Header().Set("Content-Type", "audio/wav")
+	if track := r.URL.Query().Get("track"); track != "" {
+		a.streamTrack(w, r, id, track)
+		return
+	}
+
+	segments, err := a.recordingRepo.ListSegments(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list recording segments: %v", err))
+		return
+	}
+
+	// Serve the audio file. Segmented recordings are always WAV.
+	w.Header().Set("Content-Type", recorder.Codec(recording.Codec).ContentType())
 	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%s", recording.Filename))
-	http.ServeFile(w, r, recording.FilePath)
+
+	if len(segments) <= 1 {
+		http.ServeFile(w, r, recording.FilePath)
+		return
+	}
+
+	// Stitch the segment files back into a single WAV stream
+	paths := make([]string, len(segments))
+	for i, segment := range segments {
+		paths[i] = segment.FilePath
+	}
+
+	audio, err := wav.OpenConcat(paths)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to open recording segments: %v", err))
+		return
+	}
+	defer audio.Close()
+
+	modTime := recording.CreatedAt
+	if recording.CompletedAt != nil {
+		modTime = *recording.CompletedAt
+	}
+	http.ServeContent(w, r, recording.Filename, modTime, io.NewSectionReader(audio, 0, audio.Size()))
+}
+
+// streamTrack streams one per-channel track of a multi-track recording
+func (a *API) streamTrack(w http.ResponseWriter, r *http.Request, recordingID int64, trackParam string) {
+	index, err := strconv.Atoi(trackParam)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid track index")
+		return
+	}
+
+	tracks, err := a.recordingRepo.ListTracks(recordingID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list recording tracks: %v", err))
+		return
+	}
+
+	for _, track := range tracks {
+		if track.Index != index {
+			continue
+		}
+
+		// Tracks keep their codec when the mixdown is archived, so go by
+		// the file rather than the recording
+		codec := recorder.Codec(strings.TrimPrefix(filepath.Ext(track.FilePath), "."))
+		w.Header().Set("Content-Type", codec.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%s", filepath.Base(track.FilePath)))
+		http.ServeFile(w, r, track.FilePath)
+		return
+	}
+
+	respondError(w, http.StatusNotFound, "Track not found")
+}
+
+// listTracks returns the per-channel tracks of a multi-track recording
+func (a *API) listTracks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	tracks, err := a.recordingRepo.ListTracks(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list tracks: %v", err))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tracks)
+}
+
+// listSilences returns the long silences detected in a recording. Trimmed
+// silences are missing from the audio and map transcript timestamps back to
+// wall-clock time.
+func (a *API) listSilences(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	silences, err := a.recordingRepo.ListSilences(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list silences: %v", err))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, silences)
+}
+
+// listMarkers returns the bookmarks dropped during a recording
+func (a *API) listMarkers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	markers, err := a.recordingRepo.ListMarkers(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list markers: %v", err))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, markers)
 }
 
 // healthCheck returns the API health status
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+func TestStreamSegmentedAudio(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.New(db.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	repo := db.NewRecordingRepository(database)
+
+	rec, err := recorder.New(recorder.Config{
+		DataDir:         dir,
+		DB:              repo,
+		Source:          recorder.NewToneSource(440, 0.5),
+		SegmentDuration: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	id := rec.GetRecordingID()
+
+	// The audio of every segment, in order
+	segments, err := repo.ListSegments(id)
+	if err != nil || len(segments) < 2 {
+		t.Fatalf("got %d segments (%v), want several", len(segments), err)
+	}
+	var want []byte
+	var firstSize int64
+	for i, segment := range segments {
+		file, err := os.Open(segment.FilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := wav.ReadInfo(file)
+		if err != nil {
+			file.Close()
+			t.Fatalf("segment %d: %v", i, err)
+		}
+		data, err := io.ReadAll(io.NewSectionReader(file, info.DataOffset, info.DataSize))
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, data...)
+		if i == 0 {
+			firstSize = info.DataSize
+		}
+	}
+
+	a := NewAPI(repo, dir)
+	router := mux.NewRouter()
+	a.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	get := func(rangeHeader string) (int, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/recordings/%d/audio", server.URL, id), nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET audio: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read audio: %v", err)
+		}
+		return resp.StatusCode, body
+	}
+
+	// The whole stream is one WAV file holding all of the segments' audio
+	code, audio := get("")
+	if code != http.StatusOK {
+		t.Fatalf("GET audio = %d, want 200", code)
+	}
+	info, err := wav.ReadInfo(bytes.NewReader(audio))
+	if err != nil {
+		t.Fatalf("streamed audio isn't a WAV file: %v", err)
+	}
+	if info.DataSize != int64(len(want)) || info.DataOffset+info.DataSize != int64(len(audio)) {
+		t.Fatalf("streamed WAV declares %d data bytes at %d in %d bytes, want the %d of the segments", info.DataSize, info.DataOffset, len(audio), len(want))
+	}
+	if !bytes.Equal(audio[info.DataOffset:], want) {
+		t.Error("streamed audio differs from the segments'")
+	}
+
+	// A range across the end of the first segment is served from both
+	boundary := info.DataOffset + firstSize
+	code, part := get(fmt.Sprintf("bytes=%d-%d", boundary-100, boundary+99))
+	if code != http.StatusPartialContent {
+		t.Fatalf("GET audio range = %d, want 206", code)
+	}
+	if !bytes.Equal(part, audio[boundary-100:boundary+100]) {
+		t.Errorf("range across the segment boundary = %d bytes that differ from the full stream", len(part))
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// RecorderStatus is the state of the recorder hosted by the web server
+type RecorderStatus struct {
+	State            string         `json:"state"`
+	RecordingID      int64          `json:"recording_id,omitempty"`
+	DurationSeconds  float64        `json:"duration_seconds"`
+	FileSizeBytes    int64          `json:"file_size_bytes"`
+	Levels           RecorderLevels `json:"levels"`
+	SkippingSilence  bool           `json:"skipping_silence"`
+	LastCheckpointAt *time.Time     `json:"last_checkpoint_at,omitempty"`
+	DiskFreeBytes    int64          `json:"disk_free_bytes"`
+	DiskLow          bool           `json:"disk_low"`
+	StopReason       string         `json:"stop_reason,omitempty"` // Why the last recording stopped
+	Error            string         `json:"error,omitempty"`       // Why the last recording failed
+}
+
+// RecorderLevels is the input level of the hosted recorder in dBFS
+type RecorderLevels struct {
+	RMS              float64 `json:"rms"`
+	Peak             float64 `json:"peak"`
+	Clipping         bool    `json:"clipping"`
+	SilentForSeconds float64 `json:"silent_for_seconds"`
+	DroppedBuffers   int64   `json:"dropped_buffers"` // Audio lost because the recorder fell behind
+}
+
+// startRecorderRequest is the optional body of POST /api/recorder/start
+type startRecorderRequest struct {
+	SessionID int64 `json:"session_id"`
+
+	// Processing sets the gain, AGC and noise gate of this recording alone.
+	// Without it the recorder's configured processing is used.
+	Processing *models.AudioProcessing `json:"processing"`
+}
+
+// SetRecorder lets the API control a recorder running in the same process.
+// Without one the /api/recorder endpoints respond 503.
+func (a *API) SetRecorder(rec *recorder.Recorder) {
+	a.recorder = rec
+}
+
+// isRecording reports whether the hosted recorder is making the recording
+// with the given ID
+func (a *API) isRecording(id int64) bool {
+	return a.recorder != nil && a.recorder.GetActiveRecordingID() == id
+}
+
+// registerRecorderRoutes registers the remote control endpoints
+func (a *API) registerRecorderRoutes(api *mux.Router) {
+	api.HandleFunc("/recorder/status", a.recorderStatus).Methods("GET")
+	api.HandleFunc("/recorder/start", requireJSON(a.startRecorder)).Methods("POST")
+	api.HandleFunc("/recorder/pause", requireJSON(a.recorderAction(func(rec *recorder.Recorder) error { return rec.Pause() }))).Methods("POST")
+	api.HandleFunc("/recorder/resume", requireJSON(a.recorderAction(func(rec *recorder.Recorder) error { return rec.Resume() }))).Methods("POST")
+	api.HandleFunc("/recorder/stop", requireJSON(a.recorderAction(func(rec *recorder.Recorder) error { return rec.Stop() }))).Methods("POST")
+}
+
+// requireJSON rejects requests that aren't sent as application/json. Browsers
+// only send that cross-origin after a CORS preflight, so another website
+// can't use a plain form or text POST to switch on the microphone.
+func requireJSON(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			respondError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// recorderStatus returns the state of the hosted recorder
+func (a *API) recorderStatus(w http.ResponseWriter, r *http.Request) {
+	if a.recorder == nil {
+		respondError(w, http.StatusServiceUnavailable, "Recorder is not enabled on this server")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, a.currentRecorderStatus())
+}
+
+// startRecorder starts a new recording, optionally linked to a session
+func (a *API) startRecorder(w http.ResponseWriter, r *http.Request) {
+	if a.recorder == nil {
+		respondError(w, http.StatusServiceUnavailable, "Recorder is not enabled on this server")
+		return
+	}
+
+	var req startRecorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var opts recorder.StartOptions
+	if req.SessionID > 0 {
+		opts.SessionID = &req.SessionID
+	}
+	if req.Processing != nil {
+		opts.DSP = &recorder.DSPConfig{
+			GainDB:       req.Processing.GainDB,
+			AGC:          req.Processing.AGC,
+			AGCTargetDB:  req.Processing.AGCTargetDB,
+			AGCMaxGainDB: req.Processing.AGCMaxGainDB,
+			NoiseGateDB:  req.Processing.NoiseGateDB,
+		}
+	}
+
+	if err := a.recorder.StartWith(opts); err != nil {
+		// Starting over a running recording is a conflict and unusable
+		// processing a bad request; anything else, like a missing
+		// microphone, is a server problem
+		status := http.StatusInternalServerError
+		if errors.Is(err, recorder.ErrInvalidDSP) {
+			status = http.StatusBadRequest
+		} else if state := a.recorder.GetState(); state == recorder.StateRecording || state == recorder.StatePaused {
+			status = http.StatusConflict
+		}
+		respondError(w, status, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, a.currentRecorderStatus())
+}
+
+// recorderAction wraps a state transition of the hosted recorder as a
+// handler. The recorder serializes transitions itself, so a request that
+// loses a race (e.g. two phones pressing Stop) gets a 409.
+func (a *API) recorderAction(action func(rec *recorder.Recorder) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.recorder == nil {
+			respondError(w, http.StatusServiceUnavailable, "Recorder is not enabled on this server")
+			return
+		}
+
+		if err := action(a.recorder); err != nil {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		respondJSON(w, http.StatusOK, a.currentRecorderStatus())
+	}
+}
+
+// currentRecorderStatus snapshots the hosted recorder
+func (a *API) currentRecorderStatus() RecorderStatus {
+	rec := a.recorder
+	levels := rec.GetLevels()
+	disk := rec.GetDiskStatus()
+
+	status := RecorderStatus{
+		State:           rec.GetState().String(),
+		RecordingID:     rec.GetRecordingID(),
+		DurationSeconds: rec.GetDuration().Seconds(),
+		FileSizeBytes:   rec.GetFileSize(),
+		Levels: RecorderLevels{
+			RMS:              levels.RMS,
+			Peak:             levels.Peak,
+			Clipping:         levels.Clipping,
+			SilentForSeconds: levels.SilentFor.Seconds(),
+			DroppedBuffers:   levels.DroppedBuffers,
+		},
+		SkippingSilence: rec.IsSkippingSilence(),
+		DiskFreeBytes:   disk.FreeBytes,
+		DiskLow:         disk.Low,
+		StopReason:      rec.GetStopReason(),
+	}
+	if err := rec.GetError(); err != nil {
+		status.Error = err.Error()
+	}
+	if checkpoint := rec.GetLastCheckpoint(); !checkpoint.IsZero() {
+		status.LastCheckpointAt = &checkpoint
+	}
+
+	return status
+}
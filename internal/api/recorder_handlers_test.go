@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/recorder"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// newRecorderServer serves the API with a recorder fed by a tone generator
+func newRecorderServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	database, err := db.New(db.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	repo := db.NewRecordingRepository(database)
+	a := NewAPI(repo, dir)
+	rec, err := recorder.New(recorder.Config{
+		DataDir: dir,
+		DB:      repo,
+		Source:  recorder.NewToneSource(440, 0.5),
+	})
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	a.SetRecorder(rec)
+
+	router := mux.NewRouter()
+	a.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// postRecorder sends a control request and decodes the returned status
+func postRecorder(t *testing.T, server *httptest.Server, action, body string) (int, RecorderStatus) {
+	t.Helper()
+
+	resp, err := http.Post(server.URL+"/api/recorder/"+action, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", action, err)
+	}
+	defer resp.Body.Close()
+
+	var status RecorderStatus
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("failed to decode %s response: %v", action, err)
+		}
+	}
+	return resp.StatusCode, status
+}
+
+func TestRecorderRemoteControl(t *testing.T) {
+	server := newRecorderServer(t)
+
+	if code, _ := postRecorder(t, server, "pause", ""); code != http.StatusConflict {
+		t.Errorf("pause while idle = %d, want 409", code)
+	}
+
+	code, status := postRecorder(t, server, "start", "")
+	if code != http.StatusOK || status.State != "recording" || status.RecordingID == 0 {
+		t.Fatalf("start = %d %+v, want 200 recording", code, status)
+	}
+	if code, _ := postRecorder(t, server, "start", "{}"); code != http.StatusConflict {
+		t.Errorf("second start = %d, want 409", code)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	resp, err := http.Get(server.URL + "/api/recorder/status")
+	if err != nil {
+		t.Fatalf("GET status: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if status.FileSizeBytes == 0 || status.Levels.Peak < -7 {
+		t.Errorf("status while recording = %+v, want audio and levels", status)
+	}
+
+	if code, status := postRecorder(t, server, "pause", ""); code != http.StatusOK || status.State != "paused" {
+		t.Errorf("pause = %d %+v, want 200 paused", code, status)
+	}
+	if code, status := postRecorder(t, server, "resume", ""); code != http.StatusOK || status.State != "recording" {
+		t.Errorf("resume = %d %+v, want 200 recording", code, status)
+	}
+
+	// Several phones pressing Stop at once: one wins, the rest conflict
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i], _ = postRecorder(t, server, "stop", "")
+		}(i)
+	}
+	wg.Wait()
+
+	stopped := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			stopped++
+		case http.StatusConflict:
+		default:
+			t.Errorf("concurrent stop = %d, want 200 or 409", code)
+		}
+	}
+	if stopped != 1 {
+		t.Errorf("%d stops succeeded, want 1", stopped)
+	}
+}
+
+func TestRecorderStartProcessing(t *testing.T) {
+	server := newRecorderServer(t)
+
+	if code, _ := postRecorder(t, server, "start", `{"processing": {"gain_db": 100}}`); code != http.StatusBadRequest {
+		t.Errorf("start with a 100 dB gain = %d, want 400", code)
+	}
+
+	// Processing sent with a start applies to that recording only
+	for _, body := range []string{`{"processing": {"gain_db": 6}}`, "{}"} {
+		code, status := postRecorder(t, server, "start", body)
+		if code != http.StatusOK {
+			t.Fatalf("start %s = %d, want 200", body, code)
+		}
+		if code, _ := postRecorder(t, server, "stop", ""); code != http.StatusOK {
+			t.Fatalf("stop = %d, want 200", code)
+		}
+
+		resp, err := http.Get(fmt.Sprintf("%s/api/recordings/%d", server.URL, status.RecordingID))
+		if err != nil {
+			t.Fatalf("GET recording: %v", err)
+		}
+		var recording models.Recording
+		json.NewDecoder(resp.Body).Decode(&recording)
+		resp.Body.Close()
+
+		if body == "{}" {
+			if recording.Processing != nil {
+				t.Errorf("processing without a request = %+v, want the configured none", recording.Processing)
+			}
+		} else if recording.Processing == nil || recording.Processing.GainDB != 6 {
+			t.Errorf("processing = %+v, want a 6 dB gain", recording.Processing)
+		}
+	}
+}
+
+func TestRecorderRequiresJSON(t *testing.T) {
+	server := newRecorderServer(t)
+
+	// A "simple" cross-site POST, which browsers send without a preflight
+	resp, err := http.Post(server.URL+"/api/recorder/start", "text/plain", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("POST start: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain start = %d, want 415", resp.StatusCode)
+	}
+
+	code, status := postRecorder(t, server, "start", "")
+	if code != http.StatusOK || status.State != "recording" {
+		t.Fatalf("JSON start = %d %+v, want 200 recording", code, status)
+	}
+	if code, _ := postRecorder(t, server, "stop", ""); code != http.StatusOK {
+		t.Errorf("stop = %d, want 200", code)
+	}
+}
+
+func TestRecorderRemoteControlDisabled(t *testing.T) {
+	router := mux.NewRouter()
+	NewAPI(nil, t.TempDir()).RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/api/recorder/status", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status without a recorder = %d, want 503", rec.Code)
+	}
+}
+
+func TestDeleteActiveRecording(t *testing.T) {
+	server := newRecorderServer(t)
+
+	_, status := postRecorder(t, server, "start", "")
+	deleteRecording := func() int {
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/recordings/%d", server.URL, status.RecordingID), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("DELETE: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := deleteRecording(); code != http.StatusConflict {
+		t.Errorf("delete while recording = %d, want 409", code)
+	}
+	if code, _ := postRecorder(t, server, "stop", ""); code != http.StatusOK {
+		t.Fatalf("stop = %d, want 200", code)
+	}
+	if code := deleteRecording(); code != http.StatusOK {
+		t.Errorf("delete after stop = %d, want 200", code)
+	}
+}
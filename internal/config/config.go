@@ -1,9 +1,10 @@
 package config
 
 import (
+	"log"
 	"os"
-	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // Config holds application configuration
@@ -13,45 +14,111 @@ type Config struct {
 	DBName  string
 
 	// Web server configuration
-	WebPort string
-	APIHost string
+	WebPort          string
+	APIHost          string
+	RecorderEnabled  bool // Host a recorder the frontend can remote-control
+	AIEnabled        bool // Build the AI services at startup
+	ArchiveAfterDays int  // Archive recordings older than this daily; 0 disables
 
 	// AI services configuration
-	OpenAIAPIKey string
+	OpenAIAPIKey             string
+	OpenAIBaseURL            string // Empty uses the OpenAI API itself
+	OpenAITranscriptionModel string // Empty uses whisper-1
+	WhisperCppBinary         string // whisper.cpp program for local transcription
+	WhisperCppModel          string // ggml model file whisper.cpp transcribes with
+
+	// Provider per capability: "openai" for the OpenAI API, "local" for an
+	// OpenAI-compatible server such as Ollama at LocalLLMURL, "whispercpp"
+	// for transcription with whisper.cpp, "fake" for development, or "none"
+	// to leave diarization off. Empty model names use OpenAI's defaults, so
+	// local providers need them set.
+	TranscriptionProvider string
+	DiarizationProvider   string
+	SummaryProvider       string
+	SummaryModel          string
+	SummaryChunkChars     int // Longest transcript summarized in one request; 0 uses the default
+	EmbeddingProvider     string
+	EmbeddingModel        string
+	LocalLLMURL           string
+	LocalLLMAPIKey        string // Only needed if the local server checks keys
 
 	// Recorder configuration
 	AudioSampleRate int
 	AudioChannels   int
 	AudioBitDepth   int
+	AudioFloat      bool   // 32-bit float samples (AUDIO_SAMPLE_FORMAT=float)
+	AudioCodec      string // wav or flac
+	AudioDeviceID   string // Empty uses the system default capture device; comma-separated for one track each
+
+	RecorderSplitTracks        bool
+	RecorderCheckpointInterval time.Duration // Negative disables checkpoints
+	RecorderSegmentDuration    time.Duration // Zero records to a single file
+	RecorderPreRoll            time.Duration // Zero disables the pre-roll
+	RecorderGainDB             float64
+	RecorderAGC                bool
+	RecorderAGCTarget          float64
+	RecorderNoiseGate          float64 // Zero disables the gate
+	RecorderDiskWarnMB         int     // -1 disables the warning
+	RecorderDiskStopMB         int     // -1 disables the auto-stop
+	RecorderVAD                string  // off, mark or pause
+	RecorderVADThreshold       float64
+	RecorderVADMinSilence      time.Duration
 }
 
-// Load loads configuration from environment variables with defaults
+// Load loads configuration from environment variables with defaults. It
+// only reads the environment; callers create DataDir when they need it.
+// Invalid numbers and durations are logged and replaced by their default.
 func Load() *Config {
-	homeDir, _ := os.UserHomeDir()
-	defaultDataDir := filepath.Join(homeDir, ".dnd-assistant", "data")
-
-	cfg := &Config{
+	return &Config{
 		// Database defaults
-		DataDir: getEnvOrDefault("DATA_DIR", defaultDataDir),
+		DataDir: getEnvOrDefault("DATA_DIR", "./data"),
 		DBName:  getEnvOrDefault("DB_NAME", "dnd_assistant.db"),
 
 		// Web server defaults
-		WebPort: getEnvOrDefault("PORT", "8080"),
-		APIHost: getEnvOrDefault("API_HOST", "http://localhost:8080"),
+		WebPort:          getEnvOrDefault("PORT", "8080"),
+		APIHost:          getEnvOrDefault("API_HOST", "http://localhost:8080"),
+		RecorderEnabled:  os.Getenv("RECORDER_ENABLED") == "true",
+		AIEnabled:        os.Getenv("AI_ENABLED") == "true",
+		ArchiveAfterDays: getEnvIntOrDefault("ARCHIVE_AFTER_DAYS", 0),
 
 		// AI services
-		OpenAIAPIKey: os.Getenv("OPENAI_API_KEY"),
+		OpenAIAPIKey:             os.Getenv("OPENAI_API_KEY"),
+		OpenAIBaseURL:            os.Getenv("OPENAI_BASE_URL"),
+		OpenAITranscriptionModel: os.Getenv("OPENAI_TRANSCRIPTION_MODEL"),
+		WhisperCppBinary:         getEnvOrDefault("WHISPER_CPP_BINARY", "whisper-cli"),
+		WhisperCppModel:          os.Getenv("WHISPER_CPP_MODEL"),
+		TranscriptionProvider:    getEnvOrDefault("TRANSCRIPTION_PROVIDER", "openai"),
+		DiarizationProvider:      getEnvOrDefault("DIARIZATION_PROVIDER", "none"),
+		SummaryProvider:          getEnvOrDefault("SUMMARY_PROVIDER", "openai"),
+		SummaryModel:             os.Getenv("SUMMARY_MODEL"),
+		SummaryChunkChars:        getEnvIntOrDefault("SUMMARY_CHUNK_CHARS", 0),
+		EmbeddingProvider:        getEnvOrDefault("EMBEDDING_PROVIDER", "openai"),
+		EmbeddingModel:           os.Getenv("EMBEDDING_MODEL"),
+		LocalLLMURL:              getEnvOrDefault("LOCAL_LLM_URL", "http://localhost:11434/v1"),
+		LocalLLMAPIKey:           os.Getenv("LOCAL_LLM_API_KEY"),
 
 		// Recorder defaults (optimized for long recordings)
 		AudioSampleRate: getEnvIntOrDefault("AUDIO_SAMPLE_RATE", 16000),
 		AudioChannels:   getEnvIntOrDefault("AUDIO_CHANNELS", 1),
 		AudioBitDepth:   getEnvIntOrDefault("AUDIO_BIT_DEPTH", 16),
-	}
-
-	// Ensure data directory exists
-	os.MkdirAll(cfg.DataDir, 0755)
+		AudioFloat:      os.Getenv("AUDIO_SAMPLE_FORMAT") == "float",
+		AudioCodec:      getEnvOrDefault("AUDIO_CODEC", "wav"),
+		AudioDeviceID:   os.Getenv("AUDIO_DEVICE_ID"),
 
-	return cfg
+		RecorderSplitTracks:        os.Getenv("RECORDER_SPLIT_TRACKS") == "true",
+		RecorderCheckpointInterval: getEnvDurationOrDefault("RECORDER_CHECKPOINT_INTERVAL", 30*time.Second),
+		RecorderSegmentDuration:    getEnvDurationOrDefault("RECORDER_SEGMENT_DURATION", 0),
+		RecorderPreRoll:            getEnvDurationOrDefault("RECORDER_PRE_ROLL", 3*time.Second),
+		RecorderGainDB:             getEnvFloatOrDefault("RECORDER_GAIN_DB", 0),
+		RecorderAGC:                os.Getenv("RECORDER_AGC") == "true",
+		RecorderAGCTarget:          getEnvFloatOrDefault("RECORDER_AGC_TARGET", -20),
+		RecorderNoiseGate:          getEnvFloatOrDefault("RECORDER_NOISE_GATE", 0),
+		RecorderDiskWarnMB:         getEnvIntOrDefault("RECORDER_DISK_WARN_MB", 1024),
+		RecorderDiskStopMB:         getEnvIntOrDefault("RECORDER_DISK_STOP_MB", 100),
+		RecorderVAD:                getEnvOrDefault("RECORDER_VAD", "off"),
+		RecorderVADThreshold:       getEnvFloatOrDefault("RECORDER_VAD_THRESHOLD", -50),
+		RecorderVADMinSilence:      getEnvDurationOrDefault("RECORDER_VAD_MIN_SILENCE", 30*time.Second),
+	}
 }
 
 // getEnvOrDefault gets an environment variable or returns the default
@@ -68,6 +135,31 @@ func getEnvIntOrDefault(key string, defaultValue int) int {
 		if intVal, err := strconv.Atoi(value); err == nil {
 			return intVal
 		}
+		log.Printf("Ignoring invalid %s=%q", key, value)
+	}
+	return defaultValue
+}
+
+// getEnvFloatOrDefault gets a decimal environment variable or returns the
+// default
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		log.Printf("Ignoring invalid %s=%q", key, value)
+	}
+	return defaultValue
+}
+
+// getEnvDurationOrDefault gets a duration environment variable, e.g. "30s",
+// or returns the default
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("Ignoring invalid %s=%q", key, value)
 	}
 	return defaultValue
 }
@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	. "github.com/go-jet/jet/v2/sqlite"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db/gen/model"
@@ -220,6 +221,101 @@ func (r *CampaignRepository) GetWithPlayers(campaignID int64) (*models.CampaignW
 	return result, nil
 }
 
+// SetSchedule creates or replaces the weekly game time of a campaign
+func (r *CampaignRepository) SetSchedule(params models.SetCampaignScheduleParams) (*models.CampaignSchedule, error) {
+	jetModel := model.CampaignSchedules{
+		CampaignID:            int32(params.CampaignID),
+		Weekday:               int32(params.Weekday),
+		StartTime:             params.StartTime,
+		MaxDurationSeconds:    int32(params.MaxDurationSeconds),
+		SilenceTimeoutSeconds: int32(params.SilenceTimeoutSeconds),
+		Enabled:               params.Enabled,
+	}
+
+	stmt := CampaignSchedules.
+		INSERT(CampaignSchedules.CampaignID, CampaignSchedules.Weekday, CampaignSchedules.StartTime, CampaignSchedules.MaxDurationSeconds, CampaignSchedules.SilenceTimeoutSeconds, CampaignSchedules.Enabled).
+		MODEL(jetModel).
+		ON_CONFLICT(CampaignSchedules.CampaignID).
+		DO_UPDATE(
+			SET(
+				CampaignSchedules.Weekday.SET(Int32(jetModel.Weekday)),
+				CampaignSchedules.StartTime.SET(String(jetModel.StartTime)),
+				CampaignSchedules.MaxDurationSeconds.SET(Int32(jetModel.MaxDurationSeconds)),
+				CampaignSchedules.SilenceTimeoutSeconds.SET(Int32(jetModel.SilenceTimeoutSeconds)),
+				CampaignSchedules.Enabled.SET(Bool(jetModel.Enabled)),
+				CampaignSchedules.UpdatedAt.SET(CURRENT_TIMESTAMP()),
+			),
+		).
+		RETURNING(CampaignSchedules.AllColumns)
+
+	var dest model.CampaignSchedules
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set campaign schedule: %w", err)
+	}
+
+	return jetModelToCampaignSchedule(&dest), nil
+}
+
+// ListSchedules retrieves the schedules of all campaigns
+func (r *CampaignRepository) ListSchedules() ([]*models.CampaignSchedule, error) {
+	stmt := SELECT(CampaignSchedules.AllColumns).
+		FROM(CampaignSchedules).
+		ORDER_BY(CampaignSchedules.Weekday.ASC(), CampaignSchedules.StartTime.ASC())
+
+	var dest []model.CampaignSchedules
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaign schedules: %w", err)
+	}
+
+	schedules := make([]*models.CampaignSchedule, len(dest))
+	for i, d := range dest {
+		schedules[i] = jetModelToCampaignSchedule(&d)
+	}
+
+	return schedules, nil
+}
+
+// DeleteSchedule removes the schedule of a campaign
+func (r *CampaignRepository) DeleteSchedule(campaignID int64) error {
+	stmt := CampaignSchedules.
+		DELETE().
+		WHERE(CampaignSchedules.CampaignID.EQ(Int32(int32(campaignID))))
+
+	result, err := stmt.Exec(r.db.DB)
+	if err != nil {
+		return fmt.Errorf("failed to delete campaign schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("campaign schedule not found")
+	}
+
+	return nil
+}
+
+// MarkScheduleRun records when a schedule last fired, so it isn't fired
+// again for the same game
+func (r *CampaignRepository) MarkScheduleRun(id int64, at time.Time) error {
+	// Stored in UTC like CURRENT_TIMESTAMP
+	timeStr := at.UTC().Format("2006-01-02 15:04:05")
+	stmt := CampaignSchedules.UPDATE().
+		SET(CampaignSchedules.LastRunAt.SET(RawTimestamp(":time", map[string]interface{}{":time": timeStr}))).
+		WHERE(CampaignSchedules.ID.EQ(Int32(int32(id))))
+
+	if _, err := stmt.Exec(r.db.DB); err != nil {
+		return fmt.Errorf("failed to update campaign schedule: %w", err)
+	}
+
+	return nil
+}
+
 // Helper function to convert Jet model to our domain model
 func jetModelToCampaign(m *model.Campaigns) *models.Campaign {
 	campaign := &models.Campaign{
@@ -253,3 +349,19 @@ func jetModelToPlayer(m *model.Players) *models.Player {
 
 	return player
 }
+
+// Helper function to convert Jet model to our domain model
+func jetModelToCampaignSchedule(m *model.CampaignSchedules) *models.CampaignSchedule {
+	return &models.CampaignSchedule{
+		ID:                    int64(*m.ID),
+		CampaignID:            int64(m.CampaignID),
+		Weekday:               time.Weekday(m.Weekday),
+		StartTime:             m.StartTime,
+		MaxDurationSeconds:    int(m.MaxDurationSeconds),
+		SilenceTimeoutSeconds: int(m.SilenceTimeoutSeconds),
+		Enabled:               m.Enabled,
+		LastRunAt:             m.LastRunAt,
+		CreatedAt:             m.CreatedAt,
+		UpdatedAt:             m.UpdatedAt,
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -21,19 +22,33 @@ func NewRecordingRepository(db *DB) *RecordingRepository {
 // Create creates a new recording
 func (r *RecordingRepository) Create(params models.CreateRecordingParams) (*models.Recording, error) {
 	jetModel := model.Recordings{
-		FileID:   params.FileID,
-		Filename: params.Filename,
-		FilePath: params.FilePath,
-		Status:   "recording",
+		FileID:     params.FileID,
+		Filename:   params.Filename,
+		FilePath:   params.FilePath,
+		Status:     models.RecordingStatusRecording,
+		DeviceName: params.DeviceName,
+		Codec:      params.Codec,
+	}
+	if jetModel.Codec == "" {
+		jetModel.Codec = "wav"
 	}
 
 	if params.SessionID != nil {
 		sessionID := int32(*params.SessionID)
 		jetModel.SessionID = &sessionID
 	}
+	if params.Processing != nil {
+		processing, err := json.Marshal(params.Processing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode audio processing: %w", err)
+		}
+		encoded := string(processing)
+		jetModel.Processing = &encoded
+	}
 
+	// Leave the remaining columns to their database defaults
 	stmt := Recordings.
-		INSERT(Recordings.MutableColumns).
+		INSERT(Recordings.FileID, Recordings.Filename, Recordings.FilePath, Recordings.Status, Recordings.SessionID, Recordings.DeviceName, Recordings.Codec, Recordings.Processing).
 		MODEL(jetModel).
 		RETURNING(Recordings.AllColumns)
 
@@ -96,38 +111,68 @@ func (r *RecordingRepository) List() ([]*models.Recording, error) {
 	return recordings, nil
 }
 
+// ListByStatus retrieves all recordings with the given status
+func (r *RecordingRepository) ListByStatus(status string) ([]*models.Recording, error) {
+	stmt := SELECT(Recordings.AllColumns).
+		FROM(Recordings).
+		WHERE(Recordings.Status.EQ(String(status))).
+		ORDER_BY(Recordings.CreatedAt.ASC())
+
+	var dest []model.Recordings
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	recordings := make([]*models.Recording, len(dest))
+	for i, d := range dest {
+		recordings[i] = jetModelToRecording(&d)
+	}
+
+	return recordings, nil
+}
+
 // Update updates a recording
 func (r *RecordingRepository) Update(id int64, params models.UpdateRecordingParams) error {
-	stmt := Recordings.UPDATE()
+	// Jet replaces the assignments on every SET() call, so collect them first
+	var sets []interface{}
 
 	if params.SessionID != nil {
 		sessionID := int32(*params.SessionID)
-		stmt = stmt.SET(Recordings.SessionID.SET(Int32(sessionID)))
+		sets = append(sets, Recordings.SessionID.SET(Int32(sessionID)))
 	}
 	if params.DurationSeconds != nil {
 		duration := int32(*params.DurationSeconds)
-		stmt = stmt.SET(Recordings.DurationSeconds.SET(Int32(duration)))
+		sets = append(sets, Recordings.DurationSeconds.SET(Int32(duration)))
 	}
 	if params.FileSizeBytes != nil {
-		fileSize := int32(*params.FileSizeBytes)
-		stmt = stmt.SET(Recordings.FileSizeBytes.SET(Int32(fileSize)))
+		sets = append(sets, Recordings.FileSizeBytes.SET(Int(*params.FileSizeBytes)))
 	}
 	if params.Status != nil {
-		stmt = stmt.SET(Recordings.Status.SET(String(*params.Status)))
+		sets = append(sets, Recordings.Status.SET(String(*params.Status)))
 	}
 	if params.CompletedAt != nil {
 		// Format time as SQLite expects it
 		timeStr := params.CompletedAt.Format("2006-01-02 15:04:05")
-		stmt = stmt.SET(Recordings.CompletedAt.SET(RawTimestamp(":time", map[string]interface{}{"time": timeStr})))
+		sets = append(sets, Recordings.CompletedAt.SET(RawTimestamp(":time", map[string]interface{}{":time": timeStr})))
 	}
 	if params.TranscriptionStatus != nil {
-		stmt = stmt.SET(Recordings.TranscriptionStatus.SET(String(*params.TranscriptionStatus)))
+		sets = append(sets, Recordings.TranscriptionStatus.SET(String(*params.TranscriptionStatus)))
 	}
 	if params.Notes != nil {
-		stmt = stmt.SET(Recordings.Notes.SET(String(*params.Notes)))
+		sets = append(sets, Recordings.Notes.SET(String(*params.Notes)))
+	}
+	if params.StopReason != nil {
+		sets = append(sets, Recordings.StopReason.SET(String(*params.StopReason)))
 	}
 
-	stmt = stmt.WHERE(Recordings.ID.EQ(Int32(int32(id))))
+	if len(sets) == 0 {
+		return nil
+	}
+
+	stmt := Recordings.UPDATE().
+		SET(sets[0], sets[1:]...).
+		WHERE(Recordings.ID.EQ(Int32(int32(id))))
 
 	result, err := stmt.Exec(r.db.DB)
 	if err != nil {
@@ -169,18 +214,505 @@ func (r *RecordingRepository) Delete(id int64) error {
 	return nil
 }
 
-// MarkCompleted marks a recording as completed
-func (r *RecordingRepository) MarkCompleted(id int64, duration int, fileSize int64) error {
+// MarkCompleted marks a recording as completed and records why it stopped
+func (r *RecordingRepository) MarkCompleted(id int64, duration int, fileSize int64, stopReason string) error {
 	now := time.Now()
-	status := "completed"
+	status := models.RecordingStatusCompleted
 	return r.Update(id, models.UpdateRecordingParams{
 		DurationSeconds: &duration,
 		FileSizeBytes:   &fileSize,
 		Status:          &status,
 		CompletedAt:     &now,
+		StopReason:      &stopReason,
+	})
+}
+
+// MarkRecovered marks an interrupted recording as completed and records why
+func (r *RecordingRepository) MarkRecovered(id int64, duration int, fileSize int64, note string) error {
+	now := time.Now()
+	status := models.RecordingStatusCompleted
+	return r.Update(id, models.UpdateRecordingParams{
+		DurationSeconds: &duration,
+		FileSizeBytes:   &fileSize,
+		Status:          &status,
+		CompletedAt:     &now,
+		Notes:           &note,
+	})
+}
+
+// MarkFailed marks a recording as failed and records why
+func (r *RecordingRepository) MarkFailed(id int64, note string) error {
+	status := models.RecordingStatusFailed
+	return r.Update(id, models.UpdateRecordingParams{
+		Status: &status,
+		Notes:  &note,
 	})
 }
 
+// MarkFailedWithAudio marks a recording as failed and records why, along
+// with the duration and size of the audio that was saved before it failed
+func (r *RecordingRepository) MarkFailedWithAudio(id int64, duration int, fileSize int64, note string) error {
+	status := models.RecordingStatusFailed
+	return r.Update(id, models.UpdateRecordingParams{
+		DurationSeconds: &duration,
+		FileSizeBytes:   &fileSize,
+		Status:          &status,
+		Notes:           &note,
+	})
+}
+
+// ReplaceAudioFile points a recording at a new audio file, e.g. after it has
+// been transcoded, and drops its segments, which the new file replaces.
+// Tracks are pointed at the FilePath and FileSizeBytes given for them. It all
+// happens in one transaction.
+func (r *RecordingRepository) ReplaceAudioFile(id int64, filename, filePath, codec string, fileSize int64, tracks []*models.RecordingTrack) error {
+	tx, err := r.db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	update := Recordings.UPDATE().
+		SET(
+			Recordings.Filename.SET(String(filename)),
+			Recordings.FilePath.SET(String(filePath)),
+			Recordings.Codec.SET(String(codec)),
+			Recordings.FileSizeBytes.SET(Int(fileSize)),
+		).
+		WHERE(Recordings.ID.EQ(Int32(int32(id))))
+
+	result, err := update.Exec(tx)
+	if err != nil {
+		return fmt.Errorf("failed to update recording: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("recording not found")
+	}
+
+	deleteSegments := RecordingSegments.
+		DELETE().
+		WHERE(RecordingSegments.RecordingID.EQ(Int32(int32(id))))
+
+	if _, err := deleteSegments.Exec(tx); err != nil {
+		return fmt.Errorf("failed to delete recording segments: %w", err)
+	}
+
+	for _, track := range tracks {
+		updateTrack := RecordingTracks.UPDATE().
+			SET(
+				RecordingTracks.FilePath.SET(String(track.FilePath)),
+				RecordingTracks.FileSizeBytes.SET(Int(track.FileSizeBytes)),
+			).
+			WHERE(RecordingTracks.ID.EQ(Int32(int32(track.ID))).
+				AND(RecordingTracks.RecordingID.EQ(Int32(int32(id)))))
+
+		result, err := updateTrack.Exec(tx)
+		if err != nil {
+			return fmt.Errorf("failed to update recording track: %w", err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if rowsAffected == 0 {
+			return fmt.Errorf("recording track not found")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// StartTranscription marks a recording's transcription as processing, unless
+// it already is. It reports whether this call claimed the transcription, so
+// only one job runs per recording.
+func (r *RecordingRepository) StartTranscription(id int64) (bool, error) {
+	stmt := Recordings.UPDATE().
+		SET(Recordings.TranscriptionStatus.SET(String(models.TranscriptionStatusProcessing))).
+		WHERE(Recordings.ID.EQ(Int32(int32(id))).
+			AND(Recordings.TranscriptionStatus.IS_NULL().
+				OR(Recordings.TranscriptionStatus.NOT_EQ(String(models.TranscriptionStatusProcessing)))))
+
+	result, err := stmt.Exec(r.db.DB)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transcription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// MarkTranscriptionFailed marks a recording's transcription as failed
+func (r *RecordingRepository) MarkTranscriptionFailed(id int64) error {
+	status := models.TranscriptionStatusFailed
+	return r.Update(id, models.UpdateRecordingParams{
+		TranscriptionStatus: &status,
+	})
+}
+
+// FailInterruptedTranscriptions marks transcriptions left processing, e.g. by
+// a restart while they ran, as failed so they can be started again. It
+// returns how many there were.
+func (r *RecordingRepository) FailInterruptedTranscriptions() (int64, error) {
+	stmt := Recordings.UPDATE().
+		SET(Recordings.TranscriptionStatus.SET(String(models.TranscriptionStatusFailed))).
+		WHERE(Recordings.TranscriptionStatus.EQ(String(models.TranscriptionStatusProcessing)))
+
+	result, err := stmt.Exec(r.db.DB)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update interrupted transcriptions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// SaveTranscript stores a recording's transcript, replacing any earlier one,
+// and marks its transcription as completed. It all happens in one
+// transaction.
+func (r *RecordingRepository) SaveTranscript(transcript *models.RecordingTranscript) error {
+	segments, err := json.Marshal(transcript.Segments)
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript segments: %w", err)
+	}
+	jetModel := model.RecordingTranscripts{
+		RecordingID:     int32(transcript.RecordingID),
+		Language:        transcript.Language,
+		DurationSeconds: float32(transcript.DurationSeconds),
+		FullText:        transcript.Text,
+		Segments:        string(segments),
+	}
+	if transcript.Summary != nil {
+		summary, err := json.Marshal(transcript.Summary)
+		if err != nil {
+			return fmt.Errorf("failed to encode transcript summary: %w", err)
+		}
+		encoded := string(summary)
+		jetModel.Summary = &encoded
+	}
+
+	tx, err := r.db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleteTranscript := RecordingTranscripts.
+		DELETE().
+		WHERE(RecordingTranscripts.RecordingID.EQ(Int32(int32(transcript.RecordingID))))
+
+	if _, err := deleteTranscript.Exec(tx); err != nil {
+		return fmt.Errorf("failed to delete recording transcript: %w", err)
+	}
+
+	insert := RecordingTranscripts.
+		INSERT(RecordingTranscripts.RecordingID, RecordingTranscripts.Language, RecordingTranscripts.DurationSeconds, RecordingTranscripts.FullText, RecordingTranscripts.Segments, RecordingTranscripts.Summary).
+		MODEL(jetModel)
+
+	if _, err := insert.Exec(tx); err != nil {
+		return fmt.Errorf("failed to save recording transcript: %w", err)
+	}
+
+	update := Recordings.UPDATE().
+		SET(Recordings.TranscriptionStatus.SET(String(models.TranscriptionStatusCompleted))).
+		WHERE(Recordings.ID.EQ(Int32(int32(transcript.RecordingID))))
+
+	if _, err := update.Exec(tx); err != nil {
+		return fmt.Errorf("failed to update recording: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetTranscript retrieves a recording's transcript, or nil if it hasn't been
+// transcribed
+func (r *RecordingRepository) GetTranscript(recordingID int64) (*models.RecordingTranscript, error) {
+	stmt := SELECT(RecordingTranscripts.AllColumns).
+		FROM(RecordingTranscripts).
+		WHERE(RecordingTranscripts.RecordingID.EQ(Int32(int32(recordingID))))
+
+	var dest []model.RecordingTranscripts
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recording transcript: %w", err)
+	}
+	if len(dest) == 0 {
+		return nil, nil
+	}
+
+	return jetModelToRecordingTranscript(&dest[0])
+}
+
+// CreateSegment adds a chunk file to a segmented recording
+func (r *RecordingRepository) CreateSegment(params models.CreateRecordingSegmentParams) (*models.RecordingSegment, error) {
+	jetModel := model.RecordingSegments{
+		RecordingID:        int32(params.RecordingID),
+		SegmentIndex:       int32(params.Index),
+		FilePath:           params.FilePath,
+		StartOffsetSeconds: float32(params.StartOffsetSeconds),
+	}
+
+	stmt := RecordingSegments.
+		INSERT(RecordingSegments.RecordingID, RecordingSegments.SegmentIndex, RecordingSegments.FilePath, RecordingSegments.StartOffsetSeconds).
+		MODEL(jetModel).
+		RETURNING(RecordingSegments.AllColumns)
+
+	var dest model.RecordingSegments
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording segment: %w", err)
+	}
+
+	return jetModelToRecordingSegment(&dest), nil
+}
+
+// UpdateSegment records the final duration and size of a segment
+func (r *RecordingRepository) UpdateSegment(id int64, durationSeconds float64, fileSize int64) error {
+	stmt := RecordingSegments.UPDATE().
+		SET(
+			RecordingSegments.DurationSeconds.SET(Float(durationSeconds)),
+			RecordingSegments.FileSizeBytes.SET(Int(fileSize)),
+		).
+		WHERE(RecordingSegments.ID.EQ(Int32(int32(id))))
+
+	result, err := stmt.Exec(r.db.DB)
+	if err != nil {
+		return fmt.Errorf("failed to update recording segment: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("recording segment not found")
+	}
+
+	return nil
+}
+
+// ListSegments retrieves the segments of a recording in playback order.
+// Recordings made without segmenting have none.
+func (r *RecordingRepository) ListSegments(recordingID int64) ([]*models.RecordingSegment, error) {
+	stmt := SELECT(RecordingSegments.AllColumns).
+		FROM(RecordingSegments).
+		WHERE(RecordingSegments.RecordingID.EQ(Int32(int32(recordingID)))).
+		ORDER_BY(RecordingSegments.SegmentIndex.ASC())
+
+	var dest []model.RecordingSegments
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording segments: %w", err)
+	}
+
+	segments := make([]*models.RecordingSegment, len(dest))
+	for i, d := range dest {
+		segments[i] = jetModelToRecordingSegment(&d)
+	}
+
+	return segments, nil
+}
+
+// CreateTrack adds a per-channel track file to a multi-track recording
+func (r *RecordingRepository) CreateTrack(params models.CreateRecordingTrackParams) (*models.RecordingTrack, error) {
+	jetModel := model.RecordingTracks{
+		RecordingID: int32(params.RecordingID),
+		TrackIndex:  int32(params.Index),
+		Label:       params.Label,
+		FilePath:    params.FilePath,
+	}
+
+	stmt := RecordingTracks.
+		INSERT(RecordingTracks.RecordingID, RecordingTracks.TrackIndex, RecordingTracks.Label, RecordingTracks.FilePath).
+		MODEL(jetModel).
+		RETURNING(RecordingTracks.AllColumns)
+
+	var dest model.RecordingTracks
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording track: %w", err)
+	}
+
+	return jetModelToRecordingTrack(&dest), nil
+}
+
+// UpdateTrackSize records the final size of a track file
+func (r *RecordingRepository) UpdateTrackSize(id int64, fileSize int64) error {
+	stmt := RecordingTracks.UPDATE().
+		SET(RecordingTracks.FileSizeBytes.SET(Int(fileSize))).
+		WHERE(RecordingTracks.ID.EQ(Int32(int32(id))))
+
+	result, err := stmt.Exec(r.db.DB)
+	if err != nil {
+		return fmt.Errorf("failed to update recording track: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("recording track not found")
+	}
+
+	return nil
+}
+
+// ListTracks retrieves the per-channel tracks of a recording in channel
+// order. Single-track recordings have none.
+func (r *RecordingRepository) ListTracks(recordingID int64) ([]*models.RecordingTrack, error) {
+	stmt := SELECT(RecordingTracks.AllColumns).
+		FROM(RecordingTracks).
+		WHERE(RecordingTracks.RecordingID.EQ(Int32(int32(recordingID)))).
+		ORDER_BY(RecordingTracks.TrackIndex.ASC())
+
+	var dest []model.RecordingTracks
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording tracks: %w", err)
+	}
+
+	tracks := make([]*models.RecordingTrack, len(dest))
+	for i, d := range dest {
+		tracks[i] = jetModelToRecordingTrack(&d)
+	}
+
+	return tracks, nil
+}
+
+// CreateSilence records a stretch of silence detected while recording
+func (r *RecordingRepository) CreateSilence(params models.CreateRecordingSilenceParams) (*models.RecordingSilence, error) {
+	jetModel := model.RecordingSilences{
+		RecordingID:     int32(params.RecordingID),
+		OffsetSeconds:   float32(params.OffsetSeconds),
+		StartedAt:       params.StartedAt.UTC(),
+		DurationSeconds: float32(params.DurationSeconds),
+		Trimmed:         params.Trimmed,
+	}
+
+	stmt := RecordingSilences.
+		INSERT(RecordingSilences.RecordingID, RecordingSilences.OffsetSeconds, RecordingSilences.StartedAt, RecordingSilences.DurationSeconds, RecordingSilences.Trimmed).
+		MODEL(jetModel).
+		RETURNING(RecordingSilences.AllColumns)
+
+	var dest model.RecordingSilences
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording silence: %w", err)
+	}
+
+	return jetModelToRecordingSilence(&dest), nil
+}
+
+// ListSilences retrieves the silences detected in a recording in the order
+// they occurred
+func (r *RecordingRepository) ListSilences(recordingID int64) ([]*models.RecordingSilence, error) {
+	stmt := SELECT(RecordingSilences.AllColumns).
+		FROM(RecordingSilences).
+		WHERE(RecordingSilences.RecordingID.EQ(Int32(int32(recordingID)))).
+		ORDER_BY(RecordingSilences.StartedAt.ASC())
+
+	var dest []model.RecordingSilences
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording silences: %w", err)
+	}
+
+	silences := make([]*models.RecordingSilence, len(dest))
+	for i, d := range dest {
+		silences[i] = jetModelToRecordingSilence(&d)
+	}
+
+	return silences, nil
+}
+
+// CreateMarker adds a bookmark to a recording
+func (r *RecordingRepository) CreateMarker(params models.CreateRecordingMarkerParams) (*models.RecordingMarker, error) {
+	jetModel := model.RecordingMarkers{
+		RecordingID:   int32(params.RecordingID),
+		OffsetSeconds: float32(params.OffsetSeconds),
+		Label:         params.Label,
+	}
+
+	stmt := RecordingMarkers.
+		INSERT(RecordingMarkers.RecordingID, RecordingMarkers.OffsetSeconds, RecordingMarkers.Label).
+		MODEL(jetModel).
+		RETURNING(RecordingMarkers.AllColumns)
+
+	var dest model.RecordingMarkers
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording marker: %w", err)
+	}
+
+	return jetModelToRecordingMarker(&dest), nil
+}
+
+// UpdateMarkerLabel changes the label of a bookmark
+func (r *RecordingRepository) UpdateMarkerLabel(id int64, label string) error {
+	stmt := RecordingMarkers.UPDATE().
+		SET(RecordingMarkers.Label.SET(String(label))).
+		WHERE(RecordingMarkers.ID.EQ(Int32(int32(id))))
+
+	result, err := stmt.Exec(r.db.DB)
+	if err != nil {
+		return fmt.Errorf("failed to update recording marker: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("recording marker not found")
+	}
+
+	return nil
+}
+
+// ListMarkers retrieves the bookmarks of a recording in playback order
+func (r *RecordingRepository) ListMarkers(recordingID int64) ([]*models.RecordingMarker, error) {
+	stmt := SELECT(RecordingMarkers.AllColumns).
+		FROM(RecordingMarkers).
+		WHERE(RecordingMarkers.RecordingID.EQ(Int32(int32(recordingID)))).
+		ORDER_BY(RecordingMarkers.OffsetSeconds.ASC())
+
+	var dest []model.RecordingMarkers
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording markers: %w", err)
+	}
+
+	markers := make([]*models.RecordingMarker, len(dest))
+	for i, d := range dest {
+		markers[i] = jetModelToRecordingMarker(&d)
+	}
+
+	return markers, nil
+}
+
 // Helper function to convert Jet model to our domain model
 func jetModelToRecording(m *model.Recordings) *models.Recording {
 	rec := &models.Recording{
@@ -192,7 +724,9 @@ func jetModelToRecording(m *model.Recordings) *models.Recording {
 		FileSizeBytes:       0,
 		Status:              m.Status,
 		CreatedAt:           m.CreatedAt,
-		TranscriptionStatus: "pending",
+		TranscriptionStatus: models.TranscriptionStatusPending,
+		Codec:               m.Codec,
+		StopReason:          m.StopReason,
 	}
 
 	if m.SessionID != nil {
@@ -203,7 +737,7 @@ func jetModelToRecording(m *model.Recordings) *models.Recording {
 		rec.DurationSeconds = int(*m.DurationSeconds)
 	}
 	if m.FileSizeBytes != nil {
-		rec.FileSizeBytes = int64(*m.FileSizeBytes)
+		rec.FileSizeBytes = *m.FileSizeBytes
 	}
 	if m.CompletedAt != nil {
 		rec.CompletedAt = m.CompletedAt
@@ -214,6 +748,84 @@ func jetModelToRecording(m *model.Recordings) *models.Recording {
 	if m.Notes != nil {
 		rec.Notes = m.Notes
 	}
+	if m.DeviceName != nil {
+		rec.DeviceName = m.DeviceName
+	}
+	if m.Processing != nil {
+		// Unreadable settings are left out rather than hiding the recording
+		var processing models.AudioProcessing
+		if err := json.Unmarshal([]byte(*m.Processing), &processing); err == nil {
+			rec.Processing = &processing
+		}
+	}
 
 	return rec
 }
+
+// Helper function to convert Jet model to our domain model
+func jetModelToRecordingSegment(m *model.RecordingSegments) *models.RecordingSegment {
+	return &models.RecordingSegment{
+		ID:                 int64(*m.ID),
+		RecordingID:        int64(m.RecordingID),
+		Index:              int(m.SegmentIndex),
+		FilePath:           m.FilePath,
+		StartOffsetSeconds: float64(m.StartOffsetSeconds),
+		DurationSeconds:    float64(m.DurationSeconds),
+		FileSizeBytes:      m.FileSizeBytes,
+		CreatedAt:          m.CreatedAt,
+	}
+}
+
+func jetModelToRecordingSilence(m *model.RecordingSilences) *models.RecordingSilence {
+	return &models.RecordingSilence{
+		ID:              int64(*m.ID),
+		RecordingID:     int64(m.RecordingID),
+		OffsetSeconds:   float64(m.OffsetSeconds),
+		StartedAt:       m.StartedAt,
+		DurationSeconds: float64(m.DurationSeconds),
+		Trimmed:         m.Trimmed,
+		CreatedAt:       m.CreatedAt,
+	}
+}
+
+func jetModelToRecordingMarker(m *model.RecordingMarkers) *models.RecordingMarker {
+	return &models.RecordingMarker{
+		ID:            int64(*m.ID),
+		RecordingID:   int64(m.RecordingID),
+		OffsetSeconds: float64(m.OffsetSeconds),
+		Label:         m.Label,
+		CreatedAt:     m.CreatedAt,
+	}
+}
+
+func jetModelToRecordingTranscript(m *model.RecordingTranscripts) (*models.RecordingTranscript, error) {
+	transcript := &models.RecordingTranscript{
+		RecordingID:     int64(m.RecordingID),
+		Language:        m.Language,
+		DurationSeconds: float64(m.DurationSeconds),
+		Text:            m.FullText,
+		CreatedAt:       m.CreatedAt,
+	}
+	if err := json.Unmarshal([]byte(m.Segments), &transcript.Segments); err != nil {
+		return nil, fmt.Errorf("failed to decode transcript segments: %w", err)
+	}
+	if m.Summary != nil {
+		transcript.Summary = &models.TranscriptSummary{}
+		if err := json.Unmarshal([]byte(*m.Summary), transcript.Summary); err != nil {
+			return nil, fmt.Errorf("failed to decode transcript summary: %w", err)
+		}
+	}
+	return transcript, nil
+}
+
+func jetModelToRecordingTrack(m *model.RecordingTracks) *models.RecordingTrack {
+	return &models.RecordingTrack{
+		ID:            int64(*m.ID),
+		RecordingID:   int64(m.RecordingID),
+		Index:         int(m.TrackIndex),
+		Label:         m.Label,
+		FilePath:      m.FilePath,
+		FileSizeBytes: m.FileSizeBytes,
+		CreatedAt:     m.CreatedAt,
+	}
+}
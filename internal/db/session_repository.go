@@ -77,6 +77,27 @@ func (r *SessionRepository) ListByCampaign(campaignID int64) ([]*models.Session,
 	return sessions, nil
 }
 
+// NextSessionNumber returns the number the next session of a campaign gets,
+// one past the highest so far
+func (r *SessionRepository) NextSessionNumber(campaignID int64) (int, error) {
+	stmt := SELECT(MAXi(Sessions.SessionNumber).AS("max")).
+		FROM(Sessions).
+		WHERE(Sessions.CampaignID.EQ(Int32(int32(campaignID))))
+
+	var dest struct {
+		Max *int32 `alias:"max"`
+	}
+	err := stmt.Query(r.db.DB, &dest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last session number: %w", err)
+	}
+
+	if dest.Max == nil {
+		return 1, nil
+	}
+	return int(*dest.Max) + 1, nil
+}
+
 // List retrieves all sessions
 func (r *SessionRepository) List() ([]*models.Session, error) {
 	stmt := SELECT(Sessions.AllColumns).
@@ -0,0 +1,260 @@
+// Package flac encodes and decodes the FLAC files used for compressed
+// recordings.
+package flac
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	flaclib "github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+// BlockSize is the number of samples per channel in each FLAC frame, the
+// libFLAC default. Checkpoints only cover whole frames, about a quarter of a
+// second at 16 kHz.
+const BlockSize = 4096
+
+// Encoder compresses PCM into a FLAC stream
+type Encoder struct {
+	file    *os.File
+	out     *output
+	enc     *flaclib.Encoder
+	format  wav.Format
+	pending [][]int32 // Samples per channel waiting for a full frame
+}
+
+// output buffers the many small writes of the encoder. It deliberately has
+// no Close method: flaclib.Encoder closes writers that do.
+type output struct {
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+// Seek flushes before seeking; the encoder seeks back to the start to fill
+// in the stream info when it's closed
+func (o *output) Seek(offset int64, whence int) (int64, error) {
+	if err := o.buf.Flush(); err != nil {
+		return 0, err
+	}
+	return o.file.Seek(offset, whence)
+}
+
+// NewEncoder writes the FLAC signature and stream info for PCM in format,
+// which must have 16- or 24-bit integer samples. The sample count stays 0
+// ("unknown") until the stream is closed, which decoders accept, so an
+// interrupted recording is still playable.
+func NewEncoder(file *os.File, format wav.Format) (*Encoder, error) {
+	if format.Float || (format.BitDepth != 16 && format.BitDepth != 24) {
+		return nil, fmt.Errorf("FLAC recordings need 16- or 24-bit integer samples")
+	}
+
+	out := &output{file: file, buf: bufio.NewWriterSize(file, 64*1024)}
+	info := &meta.StreamInfo{
+		BlockSizeMin:  BlockSize,
+		BlockSizeMax:  BlockSize,
+		SampleRate:    uint32(format.SampleRate),
+		NChannels:     uint8(format.Channels),
+		BitsPerSample: uint8(format.BitDepth),
+	}
+
+	enc, err := flaclib.NewEncoder(out, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write FLAC header: %w", err)
+	}
+	if err := out.buf.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write FLAC header: %w", err)
+	}
+
+	return &Encoder{
+		file:    file,
+		out:     out,
+		enc:     enc,
+		format:  format,
+		pending: make([][]int32, format.Channels),
+	}, nil
+}
+
+// Write splits PCM into channels and encodes every full frame
+func (e *Encoder) Write(pcm []byte) error {
+	size := e.format.BitDepth / 8
+	frameSize := e.format.BlockAlign()
+
+	for i := 0; i+frameSize <= len(pcm); i += frameSize {
+		for ch := range e.pending {
+			e.pending[ch] = append(e.pending[ch], wav.SampleInt(pcm[i+ch*size:], e.format.BitDepth))
+		}
+		if len(e.pending[0]) == BlockSize {
+			if err := e.writeFrame(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFrame encodes the pending samples as one frame
+func (e *Encoder) writeFrame() error {
+	n := len(e.pending[0])
+	f := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(n),
+			SampleRate:        uint32(e.format.SampleRate),
+			Channels:          frame.Channels(e.format.Channels - 1), // Independent channels
+			BitsPerSample:     uint8(e.format.BitDepth),
+		},
+		Subframes: make([]*frame.Subframe, len(e.pending)),
+	}
+	for ch, samples := range e.pending {
+		// Verbatim subframes are analyzed and compressed by the encoder
+		f.Subframes[ch] = &frame.Subframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+			Samples:   samples,
+			NSamples:  n,
+		}
+	}
+
+	if err := e.enc.WriteFrame(f); err != nil {
+		return fmt.Errorf("failed to encode FLAC frame: %w", err)
+	}
+
+	for ch := range e.pending {
+		e.pending[ch] = make([]int32, 0, BlockSize)
+	}
+	return nil
+}
+
+// Checkpoint writes the frames encoded so far out to the file without
+// syncing it. Samples waiting for a full frame are not included.
+func (e *Encoder) Checkpoint() error {
+	return e.out.buf.Flush()
+}
+
+// Close encodes the remaining samples as a short final frame, fills in the
+// sample count and checksum and syncs the file. It does not close the file.
+func (e *Encoder) Close() error {
+	if len(e.pending[0]) > 0 {
+		if err := e.writeFrame(); err != nil {
+			return err
+		}
+	}
+	if err := e.enc.Close(); err != nil {
+		return fmt.Errorf("failed to finish FLAC stream: %w", err)
+	}
+	if err := e.Checkpoint(); err != nil {
+		return err
+	}
+	return e.file.Sync()
+}
+
+// Duration returns how much audio the FLAC file at path holds by decoding it.
+// A truncated final frame, as left by a crash, is ignored; a corrupt frame
+// anywhere is an error.
+func Duration(path string) (time.Duration, error) {
+	stream, err := flaclib.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open FLAC file: %w", err)
+	}
+	defer stream.Close()
+
+	var samples int64
+	for {
+		f, err := nextFrame(stream)
+		if err != nil {
+			return 0, err
+		}
+		if f == nil {
+			break
+		}
+		samples += int64(f.BlockSize)
+	}
+
+	return time.Duration(samples) * time.Second / time.Duration(stream.Info.SampleRate), nil
+}
+
+// Decode converts the FLAC file at src to a WAV file at dst, for consumers
+// that only accept PCM. A truncated final frame is dropped; a corrupt frame
+// anywhere is an error.
+func Decode(src, dst string) error {
+	stream, err := flaclib.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open FLAC file: %w", err)
+	}
+	defer stream.Close()
+
+	format := wav.Format{
+		SampleRate: int(stream.Info.SampleRate),
+		Channels:   int(stream.Info.NChannels),
+		BitDepth:   int(stream.Info.BitsPerSample),
+	}
+	if format.BitDepth != 16 && format.BitDepth != 24 {
+		return fmt.Errorf("unsupported FLAC file: %d-bit samples (want 16 or 24)", format.BitDepth)
+	}
+
+	file, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create WAV file: %w", err)
+	}
+	defer file.Close()
+
+	out := bufio.NewWriterSize(file, 64*1024)
+	if _, err := out.Write(wav.Header(format, 0)); err != nil {
+		return fmt.Errorf("failed to write WAV file: %w", err)
+	}
+
+	size := format.BitDepth / 8
+	var dataSize int64
+	for {
+		f, err := nextFrame(stream)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			break
+		}
+
+		pcm := make([]byte, int(f.BlockSize)*format.BlockAlign())
+		for i := 0; i < int(f.BlockSize); i++ {
+			for ch, subframe := range f.Subframes {
+				wav.PutSampleInt(pcm[(i*format.Channels+ch)*size:], subframe.Samples[i], format.BitDepth)
+			}
+		}
+		if _, err := out.Write(pcm); err != nil {
+			return fmt.Errorf("failed to write WAV file: %w", err)
+		}
+		dataSize += int64(len(pcm))
+	}
+
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write WAV file: %w", err)
+	}
+	if err := wav.WriteHeader(file, format, dataSize); err != nil {
+		return fmt.Errorf("failed to finish WAV file: %w", err)
+	}
+	return file.Close()
+}
+
+// nextFrame returns the next frame of the stream, or nil at the end of the
+// stream or at a final frame cut short by a crash
+func nextFrame(stream *flaclib.Stream) (*frame.Frame, error) {
+	f, err := stream.ParseNext()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode FLAC frame: %w", err)
+	}
+	return f, nil
+}
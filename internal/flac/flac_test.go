@@ -0,0 +1,136 @@
+package flac
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+// encodeTone writes seconds of a 440 Hz tone in format to a FLAC file and
+// returns its path and the PCM encoded
+func encodeTone(t *testing.T, format wav.Format, seconds int) (string, []byte) {
+	t.Helper()
+
+	size := format.BitDepth / 8
+	pcm := make([]byte, seconds*format.SampleRate*format.BlockAlign())
+	for i := 0; i < len(pcm)/format.BlockAlign(); i++ {
+		value := math.Sin(2 * math.Pi * 440 * float64(i) / float64(format.SampleRate))
+		sample := int32(value * float64(int32(1)<<(format.BitDepth-2)))
+		for ch := 0; ch < format.Channels; ch++ {
+			wav.PutSampleInt(pcm[(i*format.Channels+ch)*size:], sample>>ch, format.BitDepth)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "tone.flac")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	enc, err := NewEncoder(file, format)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	// Writes that don't line up with frames, as captured buffers don't
+	for rest := pcm; len(rest) > 0; {
+		n := min(len(rest), 1000*format.BlockAlign())
+		if err := enc.Write(rest[:n]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return path, pcm
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []wav.Format{
+		{SampleRate: 16000, Channels: 1, BitDepth: 16},
+		{SampleRate: 48000, Channels: 2, BitDepth: 24},
+	} {
+		path, pcm := encodeTone(t, format, 2)
+
+		duration, err := Duration(path)
+		if err != nil || duration != 2*time.Second {
+			t.Errorf("%+v: Duration = %v, %v, want 2s", format, duration, err)
+		}
+
+		decoded := filepath.Join(t.TempDir(), "decoded.wav")
+		if err := Decode(path, decoded); err != nil {
+			t.Fatalf("%+v: Decode: %v", format, err)
+		}
+		data, err := os.ReadFile(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := wav.ReadInfo(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%+v: decoded file: %v", format, err)
+		}
+		if info.Format != format || string(data[info.DataOffset:]) != string(pcm) {
+			t.Errorf("%+v: decoded %+v with %d bytes of audio, want the %d bytes encoded", format, info.Format, len(data)-int(info.DataOffset), len(pcm))
+		}
+	}
+}
+
+func TestTruncatedAndCorrupt(t *testing.T) {
+	path, _ := encodeTone(t, wav.Format{SampleRate: 16000, Channels: 1, BitDepth: 16}, 3)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	// A crash mid-frame leaves a file that still decodes up to the last
+	// whole frame
+	truncated := filepath.Join(dir, "truncated.flac")
+	if err := os.WriteFile(truncated, data[:len(data)*2/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	duration, err := Duration(truncated)
+	if err != nil {
+		t.Fatalf("Duration of truncated file: %v", err)
+	}
+	if duration < time.Second || duration >= 3*time.Second {
+		t.Errorf("truncated file holds %v, want part of 3s", duration)
+	}
+	if err := Decode(truncated, filepath.Join(dir, "truncated.wav")); err != nil {
+		t.Errorf("Decode of truncated file: %v", err)
+	}
+
+	// Damage in the middle must not pass for a shorter recording
+	corrupt := filepath.Join(dir, "corrupt.flac")
+	damaged := append([]byte{}, data...)
+	for i := len(damaged) / 2; i < len(damaged)/2+64; i++ {
+		damaged[i] ^= 0x5A
+	}
+	if err := os.WriteFile(corrupt, damaged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if duration, err := Duration(corrupt); err == nil {
+		t.Errorf("Duration of corrupt file = %v, want an error", duration)
+	}
+	if err := Decode(corrupt, filepath.Join(dir, "corrupt.wav")); err == nil {
+		t.Error("Decode of corrupt file succeeded")
+	}
+}
+
+func TestNewEncoderRejectsFloat(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "float.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := NewEncoder(file, wav.Format{SampleRate: 16000, Channels: 1, BitDepth: 32, Float: true}); err == nil {
+		t.Error("NewEncoder accepted float samples")
+	}
+}
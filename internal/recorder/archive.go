@@ -0,0 +1,266 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/flac"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// Archive result statuses
+const (
+	ArchiveArchived = "archived"
+	ArchiveSkipped  = "skipped"
+	ArchiveFailed   = "failed"
+)
+
+// ArchiveResult describes what happened to one recording during archival
+type ArchiveResult struct {
+	RecordingID int64
+	FilePath    string // The FLAC file once archived, the original otherwise
+	Status      string // archived, skipped or failed
+	SavedBytes  int64
+	Err         error // Why the recording was skipped or failed
+}
+
+// ArchiveRecordings transcodes completed WAV recordings that finished more
+// than minAge ago to FLAC. Segmented recordings are joined into a single
+// file, and the track files of multi-track recordings are archived along with
+// the mixdown. Each FLAC file is decoded and checked against the original's
+// duration before the rows are switched over, and the original files are only
+// deleted after that, so an interrupted run never loses audio.
+func ArchiveRecordings(repo *db.RecordingRepository, minAge time.Duration) ([]ArchiveResult, error) {
+	recordings, err := repo.ListByStatus(models.RecordingStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-minAge)
+	var results []ArchiveResult
+	for _, rec := range recordings {
+		finished := rec.CreatedAt
+		if rec.CompletedAt != nil {
+			finished = *rec.CompletedAt
+		}
+		if Codec(rec.Codec) != CodecWAV || finished.After(cutoff) {
+			continue
+		}
+
+		results = append(results, archiveRecording(repo, rec))
+	}
+
+	return results, nil
+}
+
+// archiveRecording transcodes a single recording, and its tracks, to FLAC
+func archiveRecording(repo *db.RecordingRepository, rec *models.Recording) ArchiveResult {
+	result := ArchiveResult{
+		RecordingID: rec.ID,
+		FilePath:    rec.FilePath,
+	}
+	fail := func(err error) ArchiveResult {
+		result.Status = ArchiveFailed
+		if errors.Is(err, errUnsupportedArchiveFormat) {
+			result.Status = ArchiveSkipped
+		}
+		result.Err = err
+		return result
+	}
+
+	segments, err := repo.ListSegments(rec.ID)
+	if err != nil {
+		return fail(err)
+	}
+	tracks, err := repo.ListTracks(rec.ID)
+	if err != nil {
+		return fail(err)
+	}
+	paths := []string{rec.FilePath}
+	if len(segments) > 0 {
+		paths = make([]string, len(segments))
+		for i, segment := range segments {
+			paths[i] = segment.FilePath
+		}
+	}
+
+	originals := slices.Clone(paths)
+	for _, track := range tracks {
+		originals = append(originals, track.FilePath)
+	}
+	var originalSize int64
+	for _, path := range originals {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return fail(fmt.Errorf("failed to stat audio file: %w", err))
+		}
+		originalSize += fileInfo.Size()
+	}
+
+	// Every FLAC file is written before any row is switched over; if one
+	// fails, the ones already written are removed again
+	var created []string
+	var archivedSize int64
+	transcode := func(paths []string, dst string) (int64, error) {
+		if err := transcodeToFLAC(paths, dst); err != nil {
+			return 0, err
+		}
+		created = append(created, dst)
+		fileInfo, err := os.Stat(dst)
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat FLAC file: %w", err)
+		}
+		archivedSize += fileInfo.Size()
+		return fileInfo.Size(), nil
+	}
+	removeCreated := func() {
+		for _, path := range created {
+			os.Remove(path)
+		}
+	}
+
+	dst := flacPath(rec.FilePath)
+	fileSize, err := transcode(paths, dst)
+	if err != nil {
+		removeCreated()
+		return fail(err)
+	}
+	archivedTracks := make([]*models.RecordingTrack, len(tracks))
+	for i, track := range tracks {
+		archived := *track
+		archived.FilePath = flacPath(track.FilePath)
+		archived.FileSizeBytes, err = transcode([]string{track.FilePath}, archived.FilePath)
+		if err != nil {
+			removeCreated()
+			return fail(fmt.Errorf("track %d: %w", track.Index+1, err))
+		}
+		archivedTracks[i] = &archived
+	}
+
+	if err := repo.ReplaceAudioFile(rec.ID, filepath.Base(dst), dst, string(CodecFLAC), fileSize, archivedTracks); err != nil {
+		removeCreated()
+		return fail(err)
+	}
+
+	// The rows now point at the FLAC files, so the originals can go
+	var errs []error
+	for _, path := range originals {
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete original: %w", err))
+		}
+	}
+
+	result.Status = ArchiveArchived
+	result.FilePath = dst
+	result.SavedBytes = originalSize - archivedSize
+	result.Err = errors.Join(errs...)
+	return result
+}
+
+// flacPath returns the path of the FLAC file archiving the WAV file at path
+func flacPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + CodecFLAC.Extension()
+}
+
+// errUnsupportedArchiveFormat is returned for recordings FLAC can't hold
+var errUnsupportedArchiveFormat = errors.New("recording format can't be stored as FLAC")
+
+// transcodeToFLAC encodes the audio of the WAV files at paths, in order, into
+// a single FLAC file at dst. The file is written under a temporary name and
+// only renamed into place once it decodes to the same duration as the input.
+// An existing file at dst is never replaced.
+func transcodeToFLAC(paths []string, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("FLAC file %s already exists", dst)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to stat FLAC file: %w", err)
+	}
+
+	audio, err := wav.OpenConcat(paths)
+	if err != nil {
+		return err
+	}
+	defer audio.Close()
+
+	info, err := wav.ReadInfo(audio)
+	if err != nil {
+		return fmt.Errorf("failed to read WAV header: %w", err)
+	}
+	format := AudioFormat{
+		SampleRate: info.Format.SampleRate,
+		Channels:   info.Format.Channels,
+		BitDepth:   info.Format.BitDepth,
+		Float:      info.Format.Float,
+		Codec:      CodecFLAC,
+	}
+	if err := format.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errUnsupportedArchiveFormat, err)
+	}
+
+	tmp := dst + ".tmp"
+	if err := encodeFLACFile(io.NewSectionReader(audio, info.DataOffset, info.DataSize), tmp, format); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	duration, err := flac.Duration(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to verify FLAC file: %w", err)
+	}
+	if want := info.Format.Duration(info.DataSize); duration != want {
+		os.Remove(tmp)
+		return fmt.Errorf("FLAC file holds %v of audio, want %v", duration, want)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename FLAC file: %w", err)
+	}
+	return nil
+}
+
+// encodeFLACFile encodes PCM from r into a new FLAC file at path
+func encodeFLACFile(r io.Reader, path string, format AudioFormat) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create FLAC file: %w", err)
+	}
+	defer file.Close()
+
+	enc, err := NewEncoder(file, format)
+	if err != nil {
+		return err
+	}
+
+	// One second of audio at a time
+	buf := make([]byte, format.SampleRate*format.wavFormat().BlockAlign())
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := enc.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read audio: %w", err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
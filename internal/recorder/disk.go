@@ -0,0 +1,100 @@
+package recorder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+const (
+	// DefaultDiskWarnBytes is the free space below which the recorder warns
+	// that the disk is running low
+	DefaultDiskWarnBytes = 1 << 30
+
+	// DefaultDiskStopBytes is the free space below which a recording is
+	// stopped, leaving room to finalize the file and update the database
+	DefaultDiskStopBytes = 100 << 20
+
+	// DefaultDiskCheckInterval is how often free space is checked while
+	// recording. At 16 kHz mono a recording uses about 2 MB a minute.
+	DefaultDiskCheckInterval = 5 * time.Second
+)
+
+// DiskStatus describes the free space where recordings are saved
+type DiskStatus struct {
+	FreeBytes  int64
+	TotalBytes int64
+	Low        bool  // Free space is below the warning threshold
+	Err        error // Why free space couldn't be checked
+}
+
+// GetDiskStatus checks the free space in the data directory
+func (r *Recorder) GetDiskStatus() DiskStatus {
+	free, total, err := r.diskSpace(r.dataDir)
+	if err != nil {
+		return DiskStatus{Err: fmt.Errorf("failed to check free disk space: %w", err)}
+	}
+
+	return DiskStatus{
+		FreeBytes:  free,
+		TotalBytes: total,
+		Low:        r.diskWarn > 0 && free < r.diskWarn,
+	}
+}
+
+// GetStopReason returns why the current or most recent recording stopped,
+// e.g. models.StopReasonLowDisk, or "" while it's still running
+func (r *Recorder) GetStopReason() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.stopReason
+}
+
+// checkDiskSpace fails if there's too little free space to start recording
+func (r *Recorder) checkDiskSpace() error {
+	if r.diskStop <= 0 {
+		return nil
+	}
+
+	free, _, err := r.diskSpace(r.dataDir)
+	if err != nil {
+		// Not knowing is no reason to refuse to record
+		fmt.Printf("Failed to check free disk space: %v\n", err)
+		return nil
+	}
+	if free < r.diskStop {
+		return fmt.Errorf("not enough free disk space to record (%d MB free)", free>>20)
+	}
+	return nil
+}
+
+// diskLoop checks free space until stop is closed and stops the recording
+// cleanly once it falls below the stop threshold, before writes start
+// failing
+func (r *Recorder) diskLoop(stop <-chan struct{}, recordingID int64) {
+	ticker := time.NewTicker(r.diskInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			free, _, err := r.diskSpace(r.dataDir)
+			if err != nil || free >= r.diskStop {
+				continue
+			}
+
+			fmt.Printf("Only %d MB of disk space left, stopping recording\n", free>>20)
+			// stop waits for this goroutine, so it has to be called from
+			// another one
+			go func() {
+				if err := r.stop(recordingID, models.StopReasonLowDisk); err != nil {
+					fmt.Printf("Failed to stop recording: %v\n", err)
+				}
+			}()
+			return
+		}
+	}
+}
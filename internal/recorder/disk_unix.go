@@ -0,0 +1,15 @@
+//go:build !windows
+
+package recorder
+
+import "syscall"
+
+// diskSpace returns the bytes available to this process and the total size
+// of the filesystem holding path
+func diskSpace(path string) (free, total int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), int64(stat.Blocks) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package recorder
+
+import "golang.org/x/sys/windows"
+
+// diskSpace returns the bytes available to this process and the total size
+// of the volume holding path
+func diskSpace(path string) (free, total int64, err error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var available, size, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &available, &size, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return int64(available), int64(size), nil
+}
@@ -0,0 +1,194 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+const (
+	// DefaultAGCTarget is the RMS level in dBFS automatic gain control aims
+	// for, comfortable for speech with room for laughter and shouting
+	DefaultAGCTarget = -20.0
+
+	// DefaultAGCMaxGain is the most automatic gain control will boost or cut,
+	// in dB
+	DefaultAGCMaxGain = 24.0
+
+	// agcAttack and agcRelease are how fast, in dB per second, automatic
+	// gain control turns down loud input and turns up quiet input. Turning
+	// up slowly keeps it from pumping up the room noise between sentences.
+	agcAttack  = 20.0
+	agcRelease = 3.0
+
+	// gateHold keeps the noise gate open this long after the input drops
+	// below the threshold, so it doesn't chop off the ends of words
+	gateHold = 250 * time.Millisecond
+)
+
+// ErrInvalidDSP is returned when a recording is started with processing
+// settings that fail DSPConfig.Validate
+var ErrInvalidDSP = errors.New("invalid audio processing")
+
+// DSPConfig configures optional processing of captured audio before it's
+// written: a fixed gain, then automatic gain control, then a noise gate. The
+// zero value leaves the audio untouched. Levels and voice activity detection
+// see the unprocessed input.
+type DSPConfig struct {
+	// GainDB amplifies (or, if negative, attenuates) the input by a fixed
+	// amount
+	GainDB float64
+
+	// AGC continuously adjusts the gain so speech averages AGCTargetDB,
+	// within AGCMaxGainDB either way. Input below SilenceThreshold doesn't
+	// move the gain. Zero values use DefaultAGCTarget and DefaultAGCMaxGain.
+	AGC          bool
+	AGCTargetDB  float64
+	AGCMaxGainDB float64
+
+	// NoiseGateDB mutes the input while its RMS level is below this many
+	// dBFS, e.g. to silence a laptop fan between sentences. The level is
+	// measured before any gain. Zero disables the gate.
+	NoiseGateDB float64
+}
+
+// Validate checks that the settings are usable
+func (c DSPConfig) Validate() error {
+	if math.Abs(c.GainDB) > 60 {
+		return fmt.Errorf("gain %.0f dB is out of range (want -60 to 60)", c.GainDB)
+	}
+	if c.AGCTargetDB > 0 || c.AGCMaxGainDB < 0 {
+		return fmt.Errorf("AGC target must be at most 0 dBFS and its maximum gain positive")
+	}
+	if c.NoiseGateDB > 0 {
+		return fmt.Errorf("noise gate threshold %.0f dBFS must be negative", c.NoiseGateDB)
+	}
+	return nil
+}
+
+// withDefaults fills in the AGC defaults
+func (c DSPConfig) withDefaults() DSPConfig {
+	if c.AGC && c.AGCTargetDB == 0 {
+		c.AGCTargetDB = DefaultAGCTarget
+	}
+	if c.AGC && c.AGCMaxGainDB == 0 {
+		c.AGCMaxGainDB = DefaultAGCMaxGain
+	}
+	return c
+}
+
+// enabled reports whether the settings change the audio at all
+func (c DSPConfig) enabled() bool {
+	return c.GainDB != 0 || c.AGC || c.NoiseGateDB != 0
+}
+
+// model returns the settings as saved with a recording, or nil if the audio
+// isn't processed
+func (c DSPConfig) model() *models.AudioProcessing {
+	if !c.enabled() {
+		return nil
+	}
+	return &models.AudioProcessing{
+		GainDB:       c.GainDB,
+		AGC:          c.AGC,
+		AGCTargetDB:  c.AGCTargetDB,
+		AGCMaxGainDB: c.AGCMaxGainDB,
+		NoiseGateDB:  c.NoiseGateDB,
+	}
+}
+
+// dspChain applies a DSPConfig to captured audio. Each channel is processed
+// on its own, so each microphone of a multi-track recording gets its own AGC.
+type dspChain struct {
+	config   DSPConfig
+	format   AudioFormat
+	channels []dspState
+	out      []byte // Reused for each buffer; sources may reuse theirs too
+}
+
+// dspState is the gain of one channel at the end of the last buffer
+type dspState struct {
+	agcDB    float64       // Current automatic gain
+	gate     float64       // 1 while the gate is open, 0 while closed
+	gateHeld time.Duration // How long the input has been below the gate threshold
+}
+
+// newDSPChain returns a chain processing audio in format, or nil if config
+// leaves the audio untouched
+func newDSPChain(config DSPConfig, format AudioFormat) *dspChain {
+	if !config.enabled() {
+		return nil
+	}
+
+	channels := make([]dspState, format.Channels)
+	for i := range channels {
+		channels[i].gate = 1
+	}
+	return &dspChain{config: config.withDefaults(), format: format, channels: channels}
+}
+
+// process applies the chain to a buffer of interleaved PCM. Gain changes are
+// ramped across the buffer so they don't click. The returned buffer is only
+// valid until the next call. A nil chain returns data as-is.
+func (d *dspChain) process(data []byte) []byte {
+	if d == nil {
+		return data
+	}
+
+	size := d.format.bytesPerSample()
+	channels := d.format.Channels
+	frames := len(data) / (size * channels)
+	d.out = append(d.out[:0], data...)
+	if frames == 0 {
+		return d.out
+	}
+	elapsed := d.format.wavFormat().Duration(int64(frames * size * channels))
+
+	for ch := range d.channels {
+		state := &d.channels[ch]
+
+		var sumSquares float64
+		for i := 0; i < frames; i++ {
+			sample := d.format.decodeSample(data[(i*channels+ch)*size:])
+			sumSquares += sample * sample
+		}
+		level := toDBFS(math.Sqrt(sumSquares / float64(frames)))
+
+		fromAGC, toAGC := state.agcDB, state.agcDB
+		if d.config.AGC && level > SilenceThreshold {
+			want := math.Max(math.Min(d.config.AGCTargetDB-(level+d.config.GainDB), d.config.AGCMaxGainDB), -d.config.AGCMaxGainDB)
+			if want > toAGC {
+				toAGC = math.Min(want, toAGC+agcRelease*elapsed.Seconds())
+			} else {
+				toAGC = math.Max(want, toAGC-agcAttack*elapsed.Seconds())
+			}
+		}
+
+		fromGate, toGate := state.gate, state.gate
+		if d.config.NoiseGateDB != 0 {
+			if level >= d.config.NoiseGateDB {
+				state.gateHeld = 0
+				toGate = 1
+			} else if state.gateHeld += elapsed; state.gateHeld > gateHold {
+				toGate = 0
+			}
+		}
+
+		for i := 0; i < frames; i++ {
+			t := float64(i+1) / float64(frames)
+			gainDB := d.config.GainDB + fromAGC + (toAGC-fromAGC)*t
+			gain := math.Pow(10, gainDB/20) * (fromGate + (toGate-fromGate)*t)
+
+			offset := (i*channels + ch) * size
+			d.format.encodeSample(d.out[offset:], d.format.decodeSample(data[offset:])*gain)
+		}
+
+		state.agcDB = toAGC
+		state.gate = toGate
+	}
+
+	return d.out
+}
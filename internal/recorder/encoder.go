@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/flac"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+// Codec selects how recordings are stored on disk
+type Codec string
+
+const (
+	// CodecWAV stores uncompressed PCM in a WAV (or RF64) file
+	CodecWAV Codec = "wav"
+	// CodecFLAC stores losslessly compressed audio in a FLAC file, roughly
+	// half the size of WAV for speech
+	CodecFLAC Codec = "flac"
+)
+
+// ParseCodec parses a codec name as stored on recordings
+func ParseCodec(s string) (Codec, error) {
+	switch s {
+	case "", "wav":
+		return CodecWAV, nil
+	case "flac":
+		return CodecFLAC, nil
+	case "opus":
+		return CodecWAV, fmt.Errorf("opus recording is not supported yet (want wav or flac)")
+	default:
+		return CodecWAV, fmt.Errorf("unknown codec %q (want wav or flac)", s)
+	}
+}
+
+// Extension returns the file extension of recordings in this codec
+func (c Codec) Extension() string {
+	if c == CodecFLAC {
+		return ".flac"
+	}
+	return ".wav"
+}
+
+// ContentType returns the MIME type of recordings in this codec
+func (c Codec) ContentType() string {
+	if c == CodecFLAC {
+		return "audio/flac"
+	}
+	return "audio/wav"
+}
+
+// Encoder streams captured PCM into a recording file
+type Encoder interface {
+	// Write encodes whole frames of PCM in the recorder's format
+	Write(pcm []byte) error
+
+	// Checkpoint makes the audio written so far playable by writing it out
+	// to the file. It doesn't sync the file; the recorder does that outside
+	// its lock so capture isn't held up by a slow disk.
+	Checkpoint() error
+
+	// Close finishes the stream and syncs it to disk. It does not close the
+	// file.
+	Close() error
+}
+
+// NewEncoder writes the start of a stream in the format's codec to file and
+// returns an encoder for the audio that follows
+func NewEncoder(file *os.File, format AudioFormat) (Encoder, error) {
+	switch format.Codec {
+	case CodecFLAC:
+		return flac.NewEncoder(file, format.wavFormat())
+	default:
+		return newWAVEncoder(file, format)
+	}
+}
+
+// wavEncoder writes PCM as-is after a WAV header
+type wavEncoder struct {
+	file     *os.File
+	format   wav.Format
+	dataSize int64
+}
+
+// newWAVEncoder writes an empty WAV header, which is updated by checkpoints
+// and when the stream is closed
+func newWAVEncoder(file *os.File, format AudioFormat) (*wavEncoder, error) {
+	e := &wavEncoder{file: file, format: format.wavFormat()}
+
+	if err := wav.WriteHeader(file, e.format, 0); err != nil {
+		return nil, fmt.Errorf("failed to write WAV header: %w", err)
+	}
+
+	// WriteAt leaves the file offset alone, so move past the header before
+	// audio is appended
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf("failed to seek past WAV header: %w", err)
+	}
+
+	return e, nil
+}
+
+// Write appends PCM to the file
+func (e *wavEncoder) Write(pcm []byte) error {
+	n, err := e.file.Write(pcm)
+	e.dataSize += int64(n)
+	return err
+}
+
+// Checkpoint rewrites the header to cover the audio written so far
+func (e *wavEncoder) Checkpoint() error {
+	// A failed write may have left part of a frame behind
+	dataSize := e.dataSize - e.dataSize%int64(e.format.BlockAlign())
+
+	return wav.WriteHeader(e.file, e.format, dataSize)
+}
+
+// Close writes the final header and syncs the file
+func (e *wavEncoder) Close() error {
+	if err := e.Checkpoint(); err != nil {
+		return err
+	}
+	return e.file.Sync()
+}
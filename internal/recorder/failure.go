@@ -0,0 +1,66 @@
+package recorder
+
+import (
+	"fmt"
+	"time"
+)
+
+// Errors delivers the error behind each recording that fails while running,
+// e.g. because the capture device was unplugged or the disk stopped
+// accepting writes. By then the recorder is in StateFailed, the audio
+// captured so far has been saved and the recording is marked failed. Errors
+// that nobody receives in time are dropped; GetError keeps the latest.
+func (r *Recorder) Errors() <-chan error {
+	return r.errs
+}
+
+// GetError returns why the most recent recording failed, or nil
+func (r *Recorder) GetError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastErr
+}
+
+// failLater fails the recording from a new goroutine. fail waits for the
+// capture goroutines, so they can't call it directly.
+func (r *Recorder) failLater(recordingID int64, cause error) {
+	go r.fail(recordingID, cause)
+}
+
+// fail ends the recording with the given ID after capture broke. Whatever
+// audio made it to disk is finalized, and the recording is marked failed with
+// the cause and, like a stopped recording, the duration and size of that
+// audio.
+func (r *Recorder) fail(recordingID int64, cause error) {
+	r.control.Lock()
+	defer r.control.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The recording may have been stopped in the meantime
+	if err := r.halt(recordingID); err != nil {
+		return
+	}
+
+	duration := time.Since(r.startTime) - r.pausedTotal - r.skippedTotal
+	var err error
+	if finishErr := r.finishSegment(); finishErr != nil {
+		r.currentFile.Close()
+		err = r.db.MarkFailed(r.currentID, fmt.Sprintf("%v; %v", cause, finishErr))
+	} else {
+		err = r.db.MarkFailedWithAudio(r.currentID, int(duration.Seconds()), r.closedSize, cause.Error())
+	}
+	if err != nil {
+		fmt.Printf("Failed to mark recording %d failed: %v\n", r.currentID, err)
+	}
+
+	r.state = StateFailed
+	r.lastErr = cause
+	r.currentFile = nil
+	r.encoder = nil
+
+	select {
+	case r.errs <- cause:
+	default:
+	}
+}
@@ -0,0 +1,108 @@
+package recorder
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// MinLevel is the floor reported for digital silence, in dBFS. It's
+	// roughly the noise floor of 16-bit audio.
+	MinLevel = -96.0
+
+	// SilenceThreshold is the RMS level below which input counts as silent
+	SilenceThreshold = -50.0
+
+	// clipHold is how long Levels.Clipping stays set after a clipped sample,
+	// so a single clip is visible on a meter that refreshes a few times a
+	// second
+	clipHold = 2 * time.Second
+)
+
+// Levels describes the input level of the most recent buffer of audio
+type Levels struct {
+	RMS       float64       // Average level in dBFS, MinLevel to 0
+	Peak      float64       // Loudest sample in dBFS, MinLevel to 0
+	Clipping  bool          // A sample hit full scale within the last two seconds
+	SilentFor time.Duration // How long the RMS level has stayed below SilenceThreshold
+
+	// DroppedBuffers counts the capture buffers lost this recording because
+	// the recorder fell behind, e.g. on a slow disk. The audio has gaps if
+	// it's not 0.
+	DroppedBuffers int64
+}
+
+// levelMeter tracks input levels across buffers
+type levelMeter struct {
+	rms       float64
+	peak      float64
+	lastClip  time.Time
+	lastSound time.Time
+}
+
+// reset clears the meter, treating now as the last time sound was heard
+func (m *levelMeter) reset(now time.Time) {
+	m.rms = MinLevel
+	m.peak = MinLevel
+	m.lastClip = time.Time{}
+	m.lastSound = now
+}
+
+// update measures a buffer of samples in the given format
+func (m *levelMeter) update(data []byte, format AudioFormat, now time.Time) {
+	rms, peak, clipped := measureLevels(data, format)
+
+	m.rms = rms
+	m.peak = peak
+	if clipped {
+		m.lastClip = now
+	}
+	if rms >= SilenceThreshold {
+		m.lastSound = now
+	}
+}
+
+// levels returns the meter reading as of now
+func (m *levelMeter) levels(now time.Time) Levels {
+	return Levels{
+		RMS:       m.rms,
+		Peak:      m.peak,
+		Clipping:  !m.lastClip.IsZero() && now.Sub(m.lastClip) < clipHold,
+		SilentFor: now.Sub(m.lastSound),
+	}
+}
+
+// measureLevels returns the RMS and peak level of a buffer of samples in
+// dBFS, and whether any sample hit full scale
+func measureLevels(data []byte, format AudioFormat) (rms, peak float64, clipped bool) {
+	size := format.bytesPerSample()
+	samples := len(data) / size
+	if samples == 0 {
+		return MinLevel, MinLevel, false
+	}
+
+	clipLevel := format.clipLevel()
+	var sumSquares, maxAbs float64
+	for i := 0; i < samples; i++ {
+		sample := math.Abs(format.decodeSample(data[i*size:]))
+		if sample >= clipLevel {
+			clipped = true
+		}
+		if sample > maxAbs {
+			maxAbs = sample
+		}
+		sumSquares += sample * sample
+	}
+
+	rms = toDBFS(math.Sqrt(sumSquares / float64(samples)))
+	peak = toDBFS(maxAbs)
+	return rms, peak, clipped
+}
+
+// toDBFS converts a linear amplitude relative to full scale to dBFS
+func toDBFS(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return MinLevel
+	}
+	return math.Max(20*math.Log10(amplitude), MinLevel)
+}
@@ -0,0 +1,37 @@
+package recorder
+
+import (
+	"fmt"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// AddMarker drops a bookmark at the current position in the recording. The
+// label is optional and can be set later with SetMarkerLabel.
+func (r *Recorder) AddMarker(label string) (*models.RecordingMarker, error) {
+	// Holding control keeps Stop out until the marker is saved, and the
+	// recording and position are read together
+	r.control.Lock()
+	defer r.control.Unlock()
+	r.mu.RLock()
+	active := r.state == StateRecording || r.state == StatePaused
+	params := models.CreateRecordingMarkerParams{
+		RecordingID:   r.currentID,
+		OffsetSeconds: r.duration().Seconds(),
+	}
+	r.mu.RUnlock()
+
+	if !active {
+		return nil, fmt.Errorf("recorder is not active")
+	}
+	if label != "" {
+		params.Label = &label
+	}
+
+	return r.db.CreateMarker(params)
+}
+
+// SetMarkerLabel labels a bookmark after it was dropped
+func (r *Recorder) SetMarkerLabel(id int64, label string) error {
+	return r.db.UpdateMarkerLabel(id, label)
+}
@@ -0,0 +1,87 @@
+package recorder
+
+import "time"
+
+// DefaultPreRoll is how much audio from before Resume is kept when the
+// pre-roll is enabled from the environment
+const DefaultPreRoll = 3 * time.Second
+
+// ringBuffer keeps the most recent bytes written to it, up to a fixed size
+type ringBuffer struct {
+	data []byte
+	next int  // Where the next byte goes
+	full bool // Whether data has wrapped around at least once
+}
+
+// newRingBuffer creates a ring buffer holding up to size bytes
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, size)}
+}
+
+// Write appends p, overwriting the oldest bytes once the buffer is full
+func (b *ringBuffer) Write(p []byte) {
+	if len(p) >= len(b.data) {
+		copy(b.data, p[len(p)-len(b.data):])
+		b.next = 0
+		b.full = true
+		return
+	}
+
+	n := copy(b.data[b.next:], p)
+	if n < len(p) {
+		copy(b.data, p[n:])
+		b.full = true
+	}
+	b.next = (b.next + len(p)) % len(b.data)
+	if b.next == 0 && len(p) > 0 {
+		b.full = true
+	}
+}
+
+// Bytes returns a copy of the buffered bytes, oldest first
+func (b *ringBuffer) Bytes() []byte {
+	if !b.full {
+		return append([]byte(nil), b.data[:b.next]...)
+	}
+	out := make([]byte, 0, len(b.data))
+	out = append(out, b.data[b.next:]...)
+	return append(out, b.data[:b.next]...)
+}
+
+// Reset empties the buffer
+func (b *ringBuffer) Reset() {
+	b.next = 0
+	b.full = false
+}
+
+// newPreRoll returns a ring buffer holding d of audio in format, or nil when
+// the pre-roll is disabled. The size is a whole number of frames so the
+// oldest byte kept always starts a frame.
+func newPreRoll(format AudioFormat, d time.Duration) *ringBuffer {
+	wavFormat := format.wavFormat()
+	size := int64(d.Seconds() * float64(wavFormat.ByteRate()))
+	size -= size % int64(wavFormat.BlockAlign())
+	if size <= 0 {
+		return nil
+	}
+	return newRingBuffer(int(size))
+}
+
+// flushPreRoll writes the audio captured in the last moments before Resume
+// and returns how much was written. Callers must hold r.mu.
+func (r *Recorder) flushPreRoll() (time.Duration, error) {
+	if r.audioBuffer == nil {
+		return 0, nil
+	}
+
+	pcm := r.audioBuffer.Bytes()
+	r.audioBuffer.Reset()
+	if len(pcm) == 0 {
+		return 0, nil
+	}
+
+	if err := r.writeAudio(pcm); err != nil {
+		return 0, err
+	}
+	return r.format.wavFormat().Duration(int64(len(pcm))), nil
+}
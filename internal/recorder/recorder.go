@@ -1,23 +1,28 @@
 package recorder
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/gen2brain/malgo"
 	"github.com/google/uuid"
 	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
 	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
 )
 
 // AudioFormat defines the audio recording parameters
 type AudioFormat struct {
-	SampleRate  int // 16000 Hz for lower quality, longer recordings
-	Channels    int // 1 for mono
-	BitDepth    int // 16 bits
+	SampleRate int   // 16000 Hz for lower quality, longer recordings
+	Channels   int   // 1 for mono
+	BitDepth   int   // 16, 24 or 32 bits
+	Float      bool  // 32-bit IEEE float samples instead of integers
+	Codec      Codec // How the audio is stored; empty means WAV
 }
 
 // DefaultAudioFormat returns the default format optimized for long D&D sessions
@@ -26,9 +31,57 @@ func DefaultAudioFormat() AudioFormat {
 		SampleRate: 16000, // 16 kHz is good enough for speech
 		Channels:   1,     // Mono
 		BitDepth:   16,    // 16-bit
+		Codec:      CodecWAV,
 	}
 }
 
+// wavFormat returns the WAV header description of the format
+func (f AudioFormat) wavFormat() wav.Format {
+	return wav.Format{
+		SampleRate: f.SampleRate,
+		Channels:   f.Channels,
+		BitDepth:   f.BitDepth,
+		Float:      f.Float,
+	}
+}
+
+// Validate checks that the format is one the recorder can capture and write:
+// 16-, 24- or 32-bit integer samples, or 32-bit float samples. FLAC only
+// holds 16- and 24-bit integer samples.
+func (f AudioFormat) Validate() error {
+	if f.SampleRate < 8000 || f.SampleRate > 192000 {
+		return fmt.Errorf("unsupported sample rate %d Hz (want 8000 to 192000)", f.SampleRate)
+	}
+	if f.Channels < 1 || f.Channels > 8 {
+		return fmt.Errorf("unsupported channel count %d (want 1 to 8)", f.Channels)
+	}
+	switch f.Codec {
+	case "", CodecWAV:
+	case CodecFLAC:
+		if f.Float || (f.BitDepth != 16 && f.BitDepth != 24) {
+			return fmt.Errorf("FLAC recordings need 16- or 24-bit integer samples")
+		}
+	default:
+		return fmt.Errorf("unsupported codec %q", f.Codec)
+	}
+	if f.Float {
+		if f.BitDepth != 32 {
+			return fmt.Errorf("unsupported float bit depth %d (only 32-bit float is supported)", f.BitDepth)
+		}
+		return nil
+	}
+	switch f.BitDepth {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("unsupported bit depth %d (want 16, 24 or 32)", f.BitDepth)
+	}
+}
+
+// DefaultCheckpointInterval is how often the WAV header is rewritten and the
+// file flushed to disk while recording
+const DefaultCheckpointInterval = 30 * time.Second
+
 // RecorderState represents the current state of the recorder
 type RecorderState int
 
@@ -37,6 +90,7 @@ const (
 	StateRecording
 	StatePaused
 	StateStopped
+	StateFailed // Capture broke; see Errors and GetError
 )
 
 func (s RecorderState) String() string {
@@ -49,6 +103,8 @@ func (s RecorderState) String() string {
 		return "paused"
 	case StateStopped:
 		return "stopped"
+	case StateFailed:
+		return "failed"
 	default:
 		return "unknown"
 	}
@@ -56,22 +112,60 @@ func (s RecorderState) String() string {
 
 // Recorder handles audio recording
 type Recorder struct {
-	format       AudioFormat
-	dataDir      string
-	db           *db.RecordingRepository
-	state        RecorderState
-	currentFile  *os.File
-	currentID    int64
-	fileID       string
-	startTime    time.Time
-	pauseTime    time.Time
-	pausedTotal  time.Duration
-	mu           sync.RWMutex
-	stopChan     chan struct{}
-	audioBuffer  []byte
-	malgoCtx     *malgo.AllocatedContext
-	malgoDevice  *malgo.Device
-	captureWg    sync.WaitGroup
+	format      AudioFormat
+	dataDir     string
+	db          *db.RecordingRepository
+	state       RecorderState
+	currentFile *os.File
+	encoder     Encoder // Writes audio to currentFile in the format's codec
+	currentID   int64
+	fileID      string
+	startTime   time.Time
+	pauseTime   time.Time
+	pausedTotal time.Duration
+	checkpoint  time.Duration
+	heartbeat   time.Duration // How often the file is touched; see heartbeatLoop
+	lastSync    time.Time
+	baseName    string
+	mu          sync.RWMutex
+	control     sync.Mutex // Serializes Start, Pause, Resume, Stop and SetSource
+	stopChan    chan struct{}
+	audioBuffer *ringBuffer // Pre-roll captured while paused; nil if disabled
+	preRoll     time.Duration
+	defaultDSP  DSPConfig // Processing of recordings started without their own
+	dspConfig   DSPConfig // Processing of the current recording
+	dsp         *dspChain // Processing of the current recording; nil if none
+	stopReason  string
+	lastErr     error      // Why the most recent recording failed
+	errs        chan error // Delivers capture failures; see Errors
+	source      AudioSource
+	captureWg   sync.WaitGroup
+	meter       levelMeter
+
+	// Disk-space guard; diskSpace is swapped out in tests
+	diskWarn     int64
+	diskStop     int64
+	diskInterval time.Duration
+	diskSpace    func(path string) (free, total int64, err error)
+
+	// Voice activity detection; skippedTotal is the silence auto-pause has
+	// left out of the file
+	vad          VADConfig
+	silence      *silenceSpan
+	skippedTotal time.Duration
+
+	// Multi-track state; one file and row per channel while recording
+	splitTracks bool
+	trackFiles  []*os.File
+	trackIDs    []int64
+
+	// Segmenting state; segmentLimit is 0 when recording to a single file
+	segmentLimit int64         // Data bytes per segment
+	segmentIndex int           // Index of the current segment
+	segmentID    int64         // Database ID of the current segment
+	segmentBytes int64         // Data bytes written to the current segment
+	segmentStart time.Duration // Audio offset at which the current segment starts
+	closedSize   int64         // File size of the finished segments
 }
 
 // Config holds recorder configuration
@@ -79,80 +173,291 @@ type Config struct {
 	DataDir string
 	Format  AudioFormat
 	DB      *db.RecordingRepository
+
+	// Source provides the audio to record. Defaults to the capture device
+	// identified by DeviceID via malgo.
+	Source AudioSource
+
+	// DeviceID selects the capture device when Source is nil. Empty uses
+	// the system default; see ListDevices for the available IDs.
+	DeviceID string
+
+	// CheckpointInterval controls how often the header is rewritten and the
+	// file fsynced, bounding how much audio a crash can lose. Zero uses
+	// DefaultCheckpointInterval and a negative value disables checkpoints.
+	CheckpointInterval time.Duration
+
+	// SegmentDuration, when set, rolls the recording over to a new file
+	// every SegmentDuration of audio. All segments belong to the same
+	// recording and are stitched back together when streamed.
+	SegmentDuration time.Duration
+
+	// VAD optionally detects long silences and marks or skips them
+	VAD VADConfig
+
+	// SplitTracks also writes each input channel to a mono track file of its
+	// own, e.g. one per microphone, and makes the recording's own file a
+	// mono mixdown. It needs at least two channels and can't be combined
+	// with SegmentDuration.
+	SplitTracks bool
+
+	// PreRoll keeps the last PreRoll of audio captured while paused and
+	// writes it when the recording resumes, so words spoken just before
+	// Resume is pressed aren't lost. Zero disables it.
+	PreRoll time.Duration
+
+	// DSP optionally applies gain, automatic gain control and a noise gate
+	// to the audio before it's written. StartWith can use other processing
+	// for a single recording.
+	DSP DSPConfig
+
+	// DiskWarnBytes and DiskStopBytes are the free space in DataDir below
+	// which GetDiskStatus reports low space and the recording is stopped
+	// and saved. Zero uses DefaultDiskWarnBytes and DefaultDiskStopBytes and
+	// a negative value disables the warning or the auto-stop.
+	DiskWarnBytes int64
+	DiskStopBytes int64
 }
 
-// New creates a new recorder
-func New(cfg Config) *Recorder {
+// New creates a new recorder. It fails if the audio format isn't supported.
+func New(cfg Config) (*Recorder, error) {
 	if cfg.Format.SampleRate == 0 {
 		cfg.Format = DefaultAudioFormat()
 	}
+	if cfg.Format.Codec == "" {
+		cfg.Format.Codec = CodecWAV
+	}
+	if err := cfg.Format.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid audio format: %w", err)
+	}
+	// Segments are stitched back together as WAV when streamed
+	if cfg.SegmentDuration > 0 && cfg.Format.Codec != CodecWAV {
+		return nil, fmt.Errorf("segmented recordings must use the wav codec, not %s", cfg.Format.Codec)
+	}
+	if cfg.SplitTracks && cfg.Format.Channels < 2 {
+		return nil, fmt.Errorf("split tracks need at least two channels")
+	}
+	if cfg.SplitTracks && cfg.SegmentDuration > 0 {
+		return nil, fmt.Errorf("split tracks can't be combined with segmenting")
+	}
+	if err := cfg.DSP.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid audio processing: %w", err)
+	}
+	if cfg.CheckpointInterval == 0 {
+		cfg.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if cfg.Source == nil {
+		cfg.Source = NewMalgoSource(cfg.DeviceID)
+	}
+	if cfg.VAD.Threshold == 0 {
+		cfg.VAD.Threshold = SilenceThreshold
+	}
+	if cfg.VAD.MinSilence == 0 {
+		cfg.VAD.MinSilence = DefaultVADMinSilence
+	}
+	if cfg.DiskWarnBytes == 0 {
+		cfg.DiskWarnBytes = DefaultDiskWarnBytes
+	}
+	if cfg.DiskStopBytes == 0 {
+		cfg.DiskStopBytes = DefaultDiskStopBytes
+	}
 
-	return &Recorder{
-		format:  cfg.Format,
-		dataDir: cfg.DataDir,
-		db:      cfg.DB,
-		state:   StateIdle,
+	var segmentLimit int64
+	if cfg.SegmentDuration > 0 {
+		wavFormat := cfg.Format.wavFormat()
+		segmentLimit = int64(cfg.SegmentDuration.Seconds() * float64(wavFormat.ByteRate()))
+		segmentLimit -= segmentLimit % int64(wavFormat.BlockAlign())
 	}
+
+	return &Recorder{
+		format:       cfg.Format,
+		dataDir:      cfg.DataDir,
+		db:           cfg.DB,
+		state:        StateIdle,
+		errs:         make(chan error, 1),
+		checkpoint:   cfg.CheckpointInterval,
+		heartbeat:    heartbeatInterval,
+		source:       cfg.Source,
+		vad:          cfg.VAD,
+		preRoll:      cfg.PreRoll,
+		defaultDSP:   cfg.DSP.withDefaults(),
+		dspConfig:    cfg.DSP.withDefaults(),
+		splitTracks:  cfg.SplitTracks,
+		diskWarn:     cfg.DiskWarnBytes,
+		diskStop:     cfg.DiskStopBytes,
+		diskInterval: DefaultDiskCheckInterval,
+		diskSpace:    diskSpace,
+		segmentLimit: segmentLimit,
+	}, nil
+}
+
+// StartOptions customizes a single recording
+type StartOptions struct {
+	// SessionID links the recording to a game session. Nil leaves it
+	// unlinked.
+	SessionID *int64
+
+	// DSP is the processing of this recording alone. Nil uses the
+	// configured Config.DSP.
+	DSP *DSPConfig
 }
 
 // Start begins recording
 func (r *Recorder) Start() error {
+	return r.StartWith(StartOptions{})
+}
+
+// StartForSession begins a recording linked to the given game session
+func (r *Recorder) StartForSession(sessionID int64) error {
+	return r.StartWith(StartOptions{SessionID: &sessionID})
+}
+
+// StartWith begins a recording with the given options. Invalid processing
+// is reported as ErrInvalidDSP and nothing is started.
+func (r *Recorder) StartWith(opts StartOptions) error {
+	r.control.Lock()
+	defer r.control.Unlock()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.state != StateIdle && r.state != StateStopped {
+	if r.state == StateRecording || r.state == StatePaused {
 		return fmt.Errorf("recorder is already active")
 	}
 
-	// Generate unique file ID
-	r.fileID = uuid.New().String()
-	filename := fmt.Sprintf("recording_%s.wav", time.Now().Format("20060102_150405"))
-	filePath := filepath.Join(r.dataDir, filename)
+	dspConfig := r.defaultDSP
+	if opts.DSP != nil {
+		if err := opts.DSP.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDSP, err)
+		}
+		dspConfig = opts.DSP.withDefaults()
+	}
 
-	// Create the audio file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create audio file: %w", err)
+	if err := r.checkDiskSpace(); err != nil {
+		return err
 	}
 
-	// Write WAV header (will be updated when recording stops)
-	if err := r.writeWAVHeader(file, 0); err != nil {
-		file.Close()
-		return fmt.Errorf("failed to write WAV header: %w", err)
+	// Open the source first so a missing or busy device fails fast, before
+	// any file or row is created
+	if err := r.source.Open(r.format); err != nil {
+		return fmt.Errorf("failed to open audio source: %w", err)
 	}
+	deviceName := r.source.Name()
 
-	r.currentFile = file
-	r.startTime = time.Now()
-	r.pausedTotal = 0
-	r.audioBuffer = make([]byte, 0)
-	r.stopChan = make(chan struct{})
+	// Generate unique file ID
+	r.fileID = uuid.New().String()
+	r.baseName = r.uniqueBaseName(time.Now())
+	filename := r.baseName + r.format.Codec.Extension()
+	filePath := r.segmentPath(0)
 
 	// Create database record
 	rec, err := r.db.Create(models.CreateRecordingParams{
-		FileID:   r.fileID,
-		Filename: filename,
-		FilePath: filePath,
+		FileID:     r.fileID,
+		Filename:   filename,
+		FilePath:   filePath,
+		SessionID:  opts.SessionID,
+		DeviceName: &deviceName,
+		Codec:      string(r.format.Codec),
+		Processing: dspConfig.model(),
 	})
 	if err != nil {
-		file.Close()
+		r.source.Close()
 		return fmt.Errorf("failed to create recording record: %w", err)
 	}
-
 	r.currentID = rec.ID
+
+	// Create the audio file
+	r.segmentStart = 0
+	r.closedSize = 0
+	if err := r.startSegment(0); err != nil {
+		r.source.Close()
+		r.db.MarkFailed(rec.ID, err.Error())
+		return err
+	}
+
+	r.startTime = time.Now()
+	r.lastSync = r.startTime
+	r.pausedTotal = 0
+	r.skippedTotal = 0
+	r.silence = nil
+	r.audioBuffer = newPreRoll(r.format, r.preRoll)
+	r.dspConfig = dspConfig
+	r.dsp = newDSPChain(r.dspConfig, r.format)
+	r.stopReason = ""
+	r.lastErr = nil
+	r.meter.reset(r.startTime)
+	r.stopChan = make(chan struct{})
 	r.state = StateRecording
 
+	// The goroutines get their own copies, as halt clears stopChan
+	stop, recordingID := r.stopChan, r.currentID
+
 	// Start audio capture in a goroutine
 	r.captureWg.Add(1)
 	go func() {
 		defer r.captureWg.Done()
-		r.captureAudio()
+		r.captureAudio(stop, recordingID)
 	}()
 
+	// Show recovery in other processes that the recording is live
+	r.captureWg.Add(1)
+	go func() {
+		defer r.captureWg.Done()
+		r.heartbeatLoop(stop)
+	}()
+
+	// Keep the file playable in case we never reach Stop
+	if r.checkpoint > 0 {
+		r.captureWg.Add(1)
+		go func() {
+			defer r.captureWg.Done()
+			r.checkpointLoop(stop, recordingID)
+		}()
+	}
+
+	// Stop cleanly before the disk fills up
+	if r.diskStop > 0 {
+		r.captureWg.Add(1)
+		go func() {
+			defer r.captureWg.Done()
+			r.diskLoop(stop, recordingID)
+		}()
+	}
+
 	return nil
 }
 
+// SetSource replaces the audio source used by the next recording. It can only
+// be called while the recorder is idle or stopped.
+func (r *Recorder) SetSource(source AudioSource) error {
+	r.control.Lock()
+	defer r.control.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == StateRecording || r.state == StatePaused {
+		return fmt.Errorf("cannot change audio source while recording")
+	}
+
+	r.source = source
+	return nil
+}
+
+// GetDSP returns the audio processing of the current recording, or the
+// configured default while no recording is running
+func (r *Recorder) GetDSP() DSPConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.state == StateRecording || r.state == StatePaused {
+		return r.dspConfig
+	}
+	return r.defaultDSP
+}
+
 // Pause pauses the recording
 func (r *Recorder) Pause() error {
+	r.control.Lock()
+	defer r.control.Unlock()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -161,12 +466,18 @@ func (r *Recorder) Pause() error {
 	}
 
 	r.pauseTime = time.Now()
+	r.endSilence()
+	if r.audioBuffer != nil {
+		r.audioBuffer.Reset()
+	}
 	r.state = StatePaused
 	return nil
 }
 
 // Resume resumes the recording
 func (r *Recorder) Resume() error {
+	r.control.Lock()
+	defer r.control.Unlock()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -174,58 +485,132 @@ func (r *Recorder) Resume() error {
 		return fmt.Errorf("recorder is not paused")
 	}
 
-	r.pausedTotal += time.Since(r.pauseTime)
+	// The pre-roll was captured during the pause, so it counts as recorded
+	// time rather than paused time
+	written, err := r.flushPreRoll()
+	if err != nil {
+		r.failLater(r.currentID, fmt.Errorf("failed to write pre-roll: %w", err))
+	}
+	r.pausedTotal += max(time.Since(r.pauseTime)-written, 0)
+	// Silence during a break shouldn't trigger the warning right away
+	r.meter.lastSound = time.Now()
 	r.state = StateRecording
 	return nil
 }
 
 // Stop stops the recording
 func (r *Recorder) Stop() error {
+	return r.stop(0, models.StopReasonUser)
+}
+
+// stop ends the recording with the given ID, or whichever is active if it's
+// 0, and saves why it stopped
+func (r *Recorder) stop(recordingID int64, reason string) error {
+	// Holding control keeps other transitions out while mu is released
+	// below, so a second Stop can't close stopChan twice
+	r.control.Lock()
+	defer r.control.Unlock()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if err := r.halt(recordingID); err != nil {
+		return err
+	}
+	if dropped := r.droppedBuffers(); dropped > 0 {
+		fmt.Printf("Dropped %d capture buffers in recording %d because the recorder fell behind\n", dropped, r.currentID)
+	}
+
+	// Calculate final duration and file size, leaving out skipped silence
+	duration := time.Since(r.startTime) - r.pausedTotal - r.skippedTotal
+	durationSeconds := int(duration.Seconds())
+
+	// Capture is over whatever happens next, so the recorder must leave the
+	// active states even if finishing up fails
+	defer func() {
+		r.currentFile = nil
+		r.encoder = nil
+	}()
+
+	// Finalize the last (or only) file
+	if err := r.finishSegment(); err != nil {
+		r.currentFile.Close()
+		if dbErr := r.db.MarkFailed(r.currentID, err.Error()); dbErr != nil {
+			fmt.Printf("Failed to mark recording %d failed: %v\n", r.currentID, dbErr)
+		}
+		r.state = StateFailed
+		r.lastErr = err
+		return err
+	}
+	fileSize := r.closedSize
+
+	// The audio is safe on disk, so the recording counts as stopped even if
+	// its record can't be updated (e.g. because it was deleted)
+	r.state = StateStopped
+	r.stopReason = reason
+
+	// Update database record
+	if err := r.db.MarkCompleted(r.currentID, durationSeconds, fileSize, reason); err != nil {
+		return fmt.Errorf("failed to update recording: %w", err)
+	}
+
+	return nil
+}
+
+// halt stops capture for the recording with the given ID, or whichever is
+// active if it's 0. Callers must hold r.control and r.mu; r.mu is released
+// while capture winds down.
+func (r *Recorder) halt(recordingID int64) error {
 	if r.state != StateRecording && r.state != StatePaused {
 		return fmt.Errorf("recorder is not active")
 	}
+	if recordingID != 0 && recordingID != r.currentID {
+		return fmt.Errorf("recording %d is no longer active", recordingID)
+	}
 
 	// Signal the audio capture to stop
 	close(r.stopChan)
+	r.stopChan = nil
 
 	// Release lock while waiting for capture to finish
 	r.mu.Unlock()
 	r.captureWg.Wait()
 	r.mu.Lock()
 
-	// Calculate final duration and file size
-	duration := time.Since(r.startTime) - r.pausedTotal
-	durationSeconds := int(duration.Seconds())
+	r.endSilence()
+	return nil
+}
 
-	// Update WAV header with final size
-	if err := r.finalizeWAVFile(); err != nil {
-		return fmt.Errorf("failed to finalize WAV file: %w", err)
+// uniqueBaseName returns the base filename for a recording started at t,
+// numbered if a recording started within the same second already took it
+func (r *Recorder) uniqueBaseName(t time.Time) string {
+	base := fmt.Sprintf("recording_%s", t.Format("20060102_150405"))
+	name := base
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(r.dataDir, name+r.format.Codec.Extension())); err != nil {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, n)
 	}
+}
 
-	// Get file size
-	fileInfo, err := r.currentFile.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
-	}
-	fileSize := fileInfo.Size()
+// GetRecordingID returns the database ID of the current or most recent
+// recording, or 0 if nothing has been recorded yet
+func (r *Recorder) GetRecordingID() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.currentID
+}
 
-	// Close the file
-	if err := r.currentFile.Close(); err != nil {
-		return fmt.Errorf("failed to close file: %w", err)
-	}
+// GetActiveRecordingID returns the database ID of the recording being made,
+// or 0 if the recorder isn't recording or paused
+func (r *Recorder) GetActiveRecordingID() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	// Update database record
-	if err := r.db.MarkCompleted(r.currentID, durationSeconds, fileSize); err != nil {
-		return fmt.Errorf("failed to update recording: %w", err)
+	if r.state != StateRecording && r.state != StatePaused {
+		return 0
 	}
-
-	r.state = StateStopped
-	r.currentFile = nil
-
-	return nil
+	return r.currentID
 }
 
 // GetState returns the current recorder state
@@ -239,140 +624,196 @@ func (r *Recorder) GetState() RecorderState {
 func (r *Recorder) GetDuration() time.Duration {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.duration()
+}
 
-	if r.state == StateIdle || r.state == StateStopped {
+// duration returns the current recording duration. Callers must hold r.mu.
+func (r *Recorder) duration() time.Duration {
+	if r.state != StateRecording && r.state != StatePaused {
 		return 0
 	}
 
-	elapsed := time.Since(r.startTime) - r.pausedTotal
+	// While paused the clock stops at the moment we paused
+	now := time.Now()
 	if r.state == StatePaused {
-		elapsed -= time.Since(r.pauseTime)
+		now = r.pauseTime
 	}
 
-	return elapsed
+	skipped := r.skippedTotal
+	if r.silence != nil {
+		skipped += r.silence.trimmed
+	}
+
+	return now.Sub(r.startTime) - r.pausedTotal - skipped
 }
 
-// captureAudio captures audio from the microphone using malgo
-func (r *Recorder) captureAudio() {
-	// Initialize malgo context
-	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
-	if err != nil {
-		fmt.Printf("Failed to initialize malgo context: %v\n", err)
-		return
+// GetLevels returns the input level of the most recently captured audio. The
+// meter keeps running while paused so the microphone can still be checked.
+func (r *Recorder) GetLevels() Levels {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.state != StateRecording && r.state != StatePaused {
+		return Levels{RMS: MinLevel, Peak: MinLevel}
 	}
-	r.malgoCtx = ctx
-	defer func() {
-		_ = ctx.Uninit()
-		ctx.Free()
-	}()
+	levels := r.meter.levels(time.Now())
+	levels.DroppedBuffers = r.droppedBuffers()
+	return levels
+}
 
-	// Configure capture device
-	deviceConfig := malgo.DefaultDeviceConfig(malgo.Capture)
-	deviceConfig.Capture.Format = malgo.FormatS16
-	deviceConfig.Capture.Channels = uint32(r.format.Channels)
-	deviceConfig.SampleRate = uint32(r.format.SampleRate)
-	deviceConfig.Alsa.NoMMap = 1
-
-	// Data callback - called when audio data is available
-	onRecvFrames := func(pSample2, pSample []byte, framecount uint32) {
-		r.mu.RLock()
-		state := r.state
-		file := r.currentFile
-		r.mu.RUnlock()
-
-		// Only write if we're actively recording (not paused)
-		if state == StateRecording && file != nil {
-			_, err := file.Write(pSample)
-			if err != nil {
-				fmt.Printf("Failed to write audio data: %v\n", err)
-			}
-		}
+// droppedBuffers returns how many buffers the source has lost since it was
+// opened, if it can tell. Callers must hold r.mu.
+func (r *Recorder) droppedBuffers() int64 {
+	if counter, ok := r.source.(DropCounter); ok {
+		return counter.DroppedBuffers()
 	}
+	return 0
+}
 
-	// Initialize the device
-	device, err := malgo.InitDevice(ctx.Context, deviceConfig, malgo.DeviceCallbacks{
-		Data: onRecvFrames,
-	})
-	if err != nil {
-		fmt.Printf("Failed to initialize capture device: %v\n", err)
-		return
+// GetLastCheckpoint returns when the file was last flushed to disk with a
+// valid header
+func (r *Recorder) GetLastCheckpoint() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.currentFile == nil {
+		return time.Time{}
 	}
-	r.malgoDevice = device
-	defer device.Uninit()
+	return r.lastSync
+}
 
-	// Start the device
-	err = device.Start()
-	if err != nil {
-		fmt.Printf("Failed to start capture device: %v\n", err)
-		return
+// checkpointLoop periodically checkpoints the file until stop is closed.
+// A failed checkpoint fails the recording.
+func (r *Recorder) checkpointLoop(stop <-chan struct{}, recordingID int64) {
+	ticker := time.NewTicker(r.checkpoint)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := r.checkpointFile(); err != nil {
+				r.failLater(recordingID, fmt.Errorf("failed to checkpoint recording: %w", err))
+				return
+			}
+		}
 	}
+}
 
-	// Wait for stop signal
-	<-r.stopChan
+// heartbeatLoop touches the file being written every heartbeat until stop is
+// closed. Nothing else updates its modification time while the recording is
+// paused, between FLAC frames or between long checkpoints, and startup
+// recovery takes a file untouched for RecoveryGracePeriod for an interrupted
+// recording.
+func (r *Recorder) heartbeatLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			var path string
+			if r.currentFile != nil {
+				path = r.currentFile.Name()
+			}
+			r.mu.RUnlock()
+			if path == "" {
+				continue
+			}
 
-	// Stop the device
-	err = device.Stop()
-	if err != nil {
-		fmt.Printf("Failed to stop capture device: %v\n", err)
+			// A file finished in the meantime no longer needs it
+			now := time.Now()
+			if err := os.Chtimes(path, now, now); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				fmt.Printf("Failed to touch recording file: %v\n", err)
+			}
+		}
 	}
 }
 
-// writeWAVHeader writes a WAV file header
-func (r *Recorder) writeWAVHeader(file *os.File, dataSize uint32) error {
-	// WAV header structure
-	sampleRate := uint32(r.format.SampleRate)
-	numChannels := uint16(r.format.Channels)
-	bitsPerSample := uint16(r.format.BitDepth)
-	byteRate := sampleRate * uint32(numChannels) * uint32(bitsPerSample) / 8
-	blockAlign := numChannels * bitsPerSample / 8
-
-	header := make([]byte, 44)
+// checkpointFile makes the audio written so far playable (for WAV, by
+// rewriting the header) and flushes the file to disk. Only the checkpoint
+// itself holds the lock; capture carries on while the files are synced.
+func (r *Recorder) checkpointFile() error {
+	r.mu.Lock()
+	if r.currentFile == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	if err := r.encoder.Checkpoint(); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	files := append([]*os.File{r.currentFile}, r.trackFiles...)
+	r.mu.Unlock()
 
-	// RIFF chunk
-	copy(header[0:4], "RIFF")
-	writeUint32(header[4:8], dataSize+36)
-	copy(header[8:12], "WAVE")
+	for _, file := range files {
+		// A file closed in the meantime, by Stop or a segment rollover, was
+		// synced when its stream was finished
+		if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+	}
 
-	// fmt chunk
-	copy(header[12:16], "fmt ")
-	writeUint32(header[16:20], 16)                // fmt chunk size
-	writeUint16(header[20:22], 1)                 // PCM format
-	writeUint16(header[22:24], numChannels)
-	writeUint32(header[24:28], sampleRate)
-	writeUint32(header[28:32], byteRate)
-	writeUint16(header[32:34], blockAlign)
-	writeUint16(header[34:36], bitsPerSample)
+	r.mu.Lock()
+	r.lastSync = time.Now()
+	r.mu.Unlock()
+	return nil
+}
 
-	// data chunk
-	copy(header[36:40], "data")
-	writeUint32(header[40:44], dataSize)
+// captureAudio pulls audio from the opened source and writes it until stop is
+// closed. If reading or writing fails, the recording is failed.
+func (r *Recorder) captureAudio(stop <-chan struct{}, recordingID int64) {
+	// Closing the source unblocks ReadFrames once we're told to stop
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-stop
+		if err := r.source.Close(); err != nil {
+			fmt.Printf("Failed to close audio source: %v\n", err)
+		}
+	}()
+	defer func() { <-closed }()
 
-	_, err := file.WriteAt(header, 0)
-	return err
-}
+	for {
+		data, err := r.source.ReadFrames()
+		if err != nil {
+			if !errors.Is(err, ErrSourceClosed) && !errors.Is(err, io.EOF) {
+				r.failLater(recordingID, fmt.Errorf("failed to read audio: %w", err))
+			}
+			return
+		}
 
-// finalizeWAVFile updates the WAV header with the final file size
-func (r *Recorder) finalizeWAVFile() error {
-	fileInfo, err := r.currentFile.Stat()
-	if err != nil {
-		return err
+		if err := r.handleFrames(data); err != nil {
+			r.failLater(recordingID, fmt.Errorf("failed to write audio: %w", err))
+			return
+		}
 	}
-
-	dataSize := uint32(fileInfo.Size() - 44)
-	return r.writeWAVHeader(r.currentFile, dataSize)
 }
 
-// Helper functions for writing WAV header
-func writeUint32(b []byte, v uint32) {
-	b[0] = byte(v)
-	b[1] = byte(v >> 8)
-	b[2] = byte(v >> 16)
-	b[3] = byte(v >> 24)
-}
+// handleFrames meters a buffer of captured audio, processes it and writes
+// it, or keeps it as pre-roll while the recorder is paused. Levels and VAD
+// see the audio as captured.
+func (r *Recorder) handleFrames(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.meter.update(data, r.format, now)
 
-func writeUint16(b []byte, v uint16) {
-	b[0] = byte(v)
-	b[1] = byte(v >> 8)
+	// Only write if we're actively recording (not paused) and someone is
+	// talking or VAD is keeping the silence
+	if r.state == StatePaused && r.audioBuffer != nil {
+		r.audioBuffer.Write(r.dsp.process(data))
+		return nil
+	}
+	if r.state == StateRecording && r.currentFile != nil && r.detectVoice(data, now) {
+		return r.writeAudio(r.dsp.process(data))
+	}
+	return nil
 }
 
 // GetCurrentFile returns the path of the current recording file
@@ -386,7 +827,8 @@ func (r *Recorder) GetCurrentFile() string {
 	return r.currentFile.Name()
 }
 
-// GetFileSize returns the current size of the recording file in bytes
+// GetFileSize returns the current size of the recording in bytes, including
+// any finished segments
 func (r *Recorder) GetFileSize() int64 {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -397,8 +839,8 @@ func (r *Recorder) GetFileSize() int64 {
 
 	fileInfo, err := r.currentFile.Stat()
 	if err != nil {
-		return 0
+		return r.closedSize
 	}
 
-	return fileInfo.Size()
+	return r.closedSize + fileInfo.Size()
 }
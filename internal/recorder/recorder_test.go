@@ -0,0 +1,1490 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/flac"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// newTestRecorder creates a recorder backed by a fresh database in a
+// temporary directory
+func newTestRecorder(t *testing.T, cfg Config) (*Recorder, *db.RecordingRepository) {
+	t.Helper()
+
+	dir := t.TempDir()
+	database, err := db.New(db.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	repo := db.NewRecordingRepository(database)
+	cfg.DataDir = dir
+	cfg.DB = repo
+	rec, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	return rec, repo
+}
+
+// readWAV returns the parsed header of the WAV file at path
+func readWAV(t *testing.T, path string) *wav.Info {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	info, err := wav.ReadInfo(file)
+	if err != nil {
+		t.Fatalf("failed to read WAV header: %v", err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		t.Fatalf("failed to stat %s: %v", path, err)
+	}
+	if got := info.DataOffset + info.DataSize; got != fileInfo.Size() {
+		t.Errorf("header covers %d bytes, file has %d", got, fileInfo.Size())
+	}
+
+	return info
+}
+
+func TestRecorderStartStop(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{Source: NewToneSource(440, 0.5)})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if state := rec.GetState(); state != StateRecording {
+		t.Fatalf("state after Start = %v, want recording", state)
+	}
+	path := rec.GetCurrentFile()
+
+	time.Sleep(300 * time.Millisecond)
+
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Fatalf("state after Stop = %v, want stopped", state)
+	}
+
+	info := readWAV(t, path)
+	if info.Format != DefaultAudioFormat().wavFormat() {
+		t.Errorf("format = %+v, want %+v", info.Format, DefaultAudioFormat().wavFormat())
+	}
+	if got := info.Format.Duration(info.DataSize); got < 200*time.Millisecond || got > time.Second {
+		t.Errorf("recorded %v of audio, want about 300ms", got)
+	}
+
+	recordings, err := repo.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(recordings) != 1 {
+		t.Fatalf("got %d recordings, want 1", len(recordings))
+	}
+	if recordings[0].Status != models.RecordingStatusCompleted {
+		t.Errorf("status = %q, want completed", recordings[0].Status)
+	}
+	if recordings[0].FileSizeBytes != info.DataOffset+info.DataSize {
+		t.Errorf("file_size_bytes = %d, want %d", recordings[0].FileSizeBytes, info.DataOffset+info.DataSize)
+	}
+}
+
+func TestRecorderCheckpoint(t *testing.T) {
+	rec, _ := newTestRecorder(t, Config{
+		Source:             NewToneSource(440, 0.5),
+		CheckpointInterval: 100 * time.Millisecond,
+	})
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer rec.Stop()
+
+	started := rec.GetLastCheckpoint()
+	deadline := time.Now().Add(2 * time.Second)
+	for !rec.GetLastCheckpoint().After(started) {
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint within 2s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// While capture carries on, the header covers whole frames of audio that
+	// are all on disk
+	file, err := os.Open(rec.GetCurrentFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := wav.ReadInfo(file)
+	if err != nil {
+		t.Fatalf("header of the live file: %v", err)
+	}
+	if info.DataSize == 0 || info.DataSize%int64(info.Format.BlockAlign()) != 0 {
+		t.Errorf("header covers %d data bytes", info.DataSize)
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, info.DataOffset, info.DataSize))
+	if err != nil || int64(len(data)) != info.DataSize {
+		t.Errorf("read %d of %d data bytes: %v", len(data), info.DataSize, err)
+	}
+	if state := rec.GetState(); state != StateRecording {
+		t.Errorf("state = %v, want still recording", state)
+	}
+}
+
+func TestRecorderStopAfterDelete(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{Source: NewToneSource(440, 0.5)})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := repo.Delete(rec.GetRecordingID()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// The record is gone, but the recorder must still come to rest
+	if err := rec.Stop(); err == nil {
+		t.Error("Stop of a deleted recording succeeded")
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Errorf("state after failed Stop = %v, want stopped", state)
+	}
+	if err := rec.Stop(); err == nil {
+		t.Error("second Stop succeeded")
+	}
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start after failed Stop: %v", err)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	settings := &config.Config{
+		DataDir:                    "/recordings",
+		AudioSampleRate:            48000,
+		AudioChannels:              1,
+		AudioBitDepth:              24,
+		AudioCodec:                 "flac",
+		AudioDeviceID:              "mic-a, mic-b",
+		RecorderPreRoll:            2 * time.Second,
+		RecorderDiskWarnMB:         -1,
+		RecorderDiskStopMB:         50,
+		RecorderVAD:                "mark",
+		RecorderVADMinSilence:      time.Minute,
+		RecorderCheckpointInterval: 10 * time.Second,
+	}
+	cfg, err := NewConfig(settings)
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+
+	want := AudioFormat{SampleRate: 48000, Channels: 2, BitDepth: 24, Codec: CodecFLAC}
+	if cfg.Format != want {
+		t.Errorf("format = %+v, want %+v with a channel per device", cfg.Format, want)
+	}
+	if _, ok := cfg.Source.(*MultiSource); !ok || !cfg.SplitTracks {
+		t.Errorf("source = %T, split tracks %v; want a track per device", cfg.Source, cfg.SplitTracks)
+	}
+	if cfg.DataDir != "/recordings" || cfg.PreRoll != 2*time.Second || cfg.CheckpointInterval != 10*time.Second {
+		t.Errorf("config = %+v", cfg)
+	}
+	if cfg.DiskWarnBytes >= 0 || cfg.DiskStopBytes != 50<<20 {
+		t.Errorf("disk thresholds = %d, %d", cfg.DiskWarnBytes, cfg.DiskStopBytes)
+	}
+	if cfg.VAD.Mode != VADMarkSilence || cfg.VAD.MinSilence != time.Minute {
+		t.Errorf("VAD = %+v", cfg.VAD)
+	}
+
+	// Invalid settings are reported and left at their defaults
+	settings.AudioCodec = "mp3"
+	settings.RecorderVAD = "loud"
+	cfg, err = NewConfig(settings)
+	if err == nil || !strings.Contains(err.Error(), "AUDIO_CODEC") || !strings.Contains(err.Error(), "RECORDER_VAD") {
+		t.Errorf("NewConfig error = %v, want the codec and VAD mode reported", err)
+	}
+	if cfg.Format.Codec != CodecWAV || cfg.VAD.Mode != VADOff {
+		t.Errorf("codec %s, VAD %v; want the defaults", cfg.Format.Codec, cfg.VAD.Mode)
+	}
+}
+
+func TestRecorderPauseResume(t *testing.T) {
+	rec, _ := newTestRecorder(t, Config{Source: NewToneSource(440, 0.5)})
+
+	if err := rec.Resume(); err == nil {
+		t.Error("Resume before Start succeeded")
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := rec.Start(); err == nil {
+		t.Error("second Start succeeded")
+	}
+	path := rec.GetCurrentFile()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := rec.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if err := rec.Pause(); err == nil {
+		t.Error("Pause while paused succeeded")
+	}
+	pausedAt := rec.GetDuration()
+
+	time.Sleep(500 * time.Millisecond)
+	if got := rec.GetDuration(); got != pausedAt {
+		t.Errorf("duration moved from %v to %v while paused", pausedAt, got)
+	}
+
+	if err := rec.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := rec.Stop(); err == nil {
+		t.Error("second Stop succeeded")
+	}
+
+	// About 400ms was recorded; the 500ms pause must not be in the file
+	info := readWAV(t, path)
+	if got := info.Format.Duration(info.DataSize); got < 250*time.Millisecond || got > 700*time.Millisecond {
+		t.Errorf("recorded %v of audio, want about 400ms", got)
+	}
+}
+
+func TestRecorderPreRoll(t *testing.T) {
+	rec, _ := newTestRecorder(t, Config{
+		Source:  NewToneSource(440, 0.5),
+		PreRoll: 200 * time.Millisecond,
+	})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := rec.GetCurrentFile()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := rec.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	pausedAt := rec.GetDuration()
+	time.Sleep(500 * time.Millisecond)
+
+	// The last 200ms of the pause is written on Resume and counted as
+	// recorded time
+	if err := rec.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if got := rec.GetDuration() - pausedAt; got < 150*time.Millisecond || got > 300*time.Millisecond {
+		t.Errorf("duration grew by %v on Resume, want about 200ms", got)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	info := readWAV(t, path)
+	if got := info.Format.Duration(info.DataSize); got < 450*time.Millisecond || got > 900*time.Millisecond {
+		t.Errorf("recorded %v of audio, want about 600ms", got)
+	}
+}
+
+func TestRecorderDiskGuard(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{Source: NewToneSource(440, 0.5)})
+
+	var free atomic.Int64
+	free.Store(10 << 30)
+	rec.diskSpace = func(string) (int64, int64, error) { return free.Load(), 32 << 30, nil }
+	rec.diskInterval = 20 * time.Millisecond
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := rec.GetCurrentFile()
+	if status := rec.GetDiskStatus(); status.Low || status.FreeBytes != 10<<30 {
+		t.Errorf("disk status with 10 GiB free = %+v", status)
+	}
+
+	free.Store(500 << 20)
+	if status := rec.GetDiskStatus(); !status.Low {
+		t.Errorf("disk status with 500 MB free = %+v, want low", status)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if state := rec.GetState(); state != StateRecording {
+		t.Fatalf("state with 500 MB free = %v, want recording", state)
+	}
+
+	// Below the stop threshold the recording is stopped and saved
+	free.Store(50 << 20)
+	deadline := time.Now().Add(2 * time.Second)
+	for rec.GetState() != StateStopped && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Fatalf("state with 50 MB free = %v, want stopped", state)
+	}
+	if reason := rec.GetStopReason(); reason != models.StopReasonLowDisk {
+		t.Errorf("stop reason = %q, want %q", reason, models.StopReasonLowDisk)
+	}
+
+	readWAV(t, path)
+	recording, err := repo.GetByID(rec.GetRecordingID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if recording.Status != models.RecordingStatusCompleted || recording.StopReason == nil || *recording.StopReason != models.StopReasonLowDisk {
+		t.Errorf("recording saved as %q, stop reason %v", recording.Status, recording.StopReason)
+	}
+
+	if err := rec.Start(); err == nil {
+		t.Error("Start with 50 MB free succeeded")
+	}
+}
+
+// failingSource delivers audio from a tone source until it has been read
+// reads times, then fails like an unplugged device
+type failingSource struct {
+	AudioSource
+	reads int
+}
+
+func (s *failingSource) ReadFrames() ([]byte, error) {
+	if s.reads == 0 {
+		return nil, errors.New("device unplugged")
+	}
+	s.reads--
+	return s.AudioSource.ReadFrames()
+}
+
+func TestRecorderCaptureFailure(t *testing.T) {
+	// Over a second of audio before the device goes away
+	rec, repo := newTestRecorder(t, Config{Source: &failingSource{AudioSource: NewToneSource(440, 0.5), reads: 120}})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := rec.GetCurrentFile()
+
+	select {
+	case err := <-rec.Errors():
+		if !strings.Contains(err.Error(), "device unplugged") {
+			t.Errorf("error = %v, want the source's error", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no error delivered after the source failed")
+	}
+	if state := rec.GetState(); state != StateFailed {
+		t.Errorf("state = %v, want failed", state)
+	}
+	if rec.GetError() == nil {
+		t.Error("GetError returned nil")
+	}
+	if err := rec.Stop(); err == nil {
+		t.Error("Stop after failure succeeded")
+	}
+
+	// The audio captured before the failure is kept
+	if info := readWAV(t, path); info.DataSize == 0 {
+		t.Error("no audio saved before the failure")
+	}
+	recording, err := repo.GetByID(rec.GetRecordingID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if recording.Status != models.RecordingStatusFailed || recording.Notes == nil || !strings.Contains(*recording.Notes, "device unplugged") {
+		t.Errorf("recording saved as %q with notes %v", recording.Status, recording.Notes)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recording.FileSizeBytes != fileInfo.Size() || recording.DurationSeconds != 1 {
+		t.Errorf("failed recording saved with %d bytes and %ds, want the %d bytes and 1s on disk", recording.FileSizeBytes, recording.DurationSeconds, fileInfo.Size())
+	}
+
+	// A failed recorder can record again
+	if err := rec.SetSource(NewSilenceSource()); err != nil {
+		t.Fatalf("SetSource: %v", err)
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start after failure: %v", err)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if rec.GetError() != nil {
+		t.Errorf("GetError after a successful recording = %v", rec.GetError())
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	buf := newRingBuffer(4)
+	if got := buf.Bytes(); len(got) != 0 {
+		t.Errorf("empty buffer holds %v", got)
+	}
+
+	buf.Write([]byte{1, 2, 3})
+	buf.Write([]byte{4, 5})
+	if got := string(buf.Bytes()); got != "\x02\x03\x04\x05" {
+		t.Errorf("after wrapping, buffer holds %v, want [2 3 4 5]", buf.Bytes())
+	}
+
+	buf.Write([]byte{6, 7, 8, 9, 10})
+	if got := string(buf.Bytes()); got != "\x07\x08\x09\x0a" {
+		t.Errorf("after an oversized write, buffer holds %v, want [7 8 9 10]", buf.Bytes())
+	}
+
+	buf.Reset()
+	buf.Write([]byte{11})
+	if got := string(buf.Bytes()); got != "\x0b" {
+		t.Errorf("after Reset, buffer holds %v, want [11]", buf.Bytes())
+	}
+}
+
+func TestRecorderRestart(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{Source: NewSilenceSource()})
+
+	for i := 0; i < 2; i++ {
+		if err := rec.Start(); err != nil {
+			t.Fatalf("Start #%d: %v", i+1, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := rec.Stop(); err != nil {
+			t.Fatalf("Stop #%d: %v", i+1, err)
+		}
+	}
+
+	recordings, err := repo.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(recordings) != 2 {
+		t.Fatalf("got %d recordings, want 2", len(recordings))
+	}
+	// Both started within the same second but must not share a file
+	if recordings[0].FilePath == recordings[1].FilePath {
+		t.Errorf("both recordings were written to %s", recordings[0].FilePath)
+	}
+	for _, recording := range recordings {
+		readWAV(t, recording.FilePath)
+	}
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	_, repo := newTestRecorder(t, Config{Source: NewSilenceSource()})
+	dir := t.TempDir()
+	format := DefaultAudioFormat()
+
+	// A crash leaves the placeholder header with a data size of 0
+	crashed := append(wav.Header(format.wavFormat(), 0), toneFrames(format, 0.5, time.Second)...)
+	create := func(name string, write bool, modTime time.Time) *models.Recording {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if write {
+			if err := os.WriteFile(path, crashed, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		recording, err := repo.Create(models.CreateRecordingParams{FileID: name, Filename: name, FilePath: path})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return recording
+	}
+	truncated := create("truncated.wav", true, time.Now().Add(-time.Hour))
+	missing := create("missing.wav", false, time.Time{})
+	live := create("live.wav", true, time.Now())
+
+	results, err := RecoverInterrupted(repo, format, RecoveryGracePeriod)
+	if err != nil {
+		t.Fatalf("RecoverInterrupted: %v", err)
+	}
+	byID := make(map[int64]RecoveryResult)
+	for _, result := range results {
+		byID[result.RecordingID] = result
+	}
+	if len(byID) != 3 {
+		t.Fatalf("got %d results, want 3: %+v", len(byID), results)
+	}
+
+	// The truncated file's header is repaired and the recording completed
+	if result := byID[truncated.ID]; result.Status != models.RecordingStatusCompleted || result.Err != nil || result.DurationSeconds != 1 {
+		t.Errorf("truncated recording: %+v", result)
+	}
+	if info := readWAV(t, truncated.FilePath); info.DataSize != int64(len(crashed))-format.wavFormat().HeaderSize() {
+		t.Errorf("repaired header has %d data bytes", info.DataSize)
+	}
+	if recording, _ := repo.GetByID(truncated.ID); recording.Status != models.RecordingStatusCompleted || recording.DurationSeconds != 1 {
+		t.Errorf("truncated recording row: %+v", recording)
+	}
+
+	// A recording without a file is marked failed
+	if result := byID[missing.ID]; result.Status != models.RecordingStatusFailed || result.Err != nil {
+		t.Errorf("missing recording: %+v", result)
+	}
+	if recording, _ := repo.GetByID(missing.ID); recording.Status != models.RecordingStatusFailed {
+		t.Errorf("missing recording status = %s, want failed", recording.Status)
+	}
+
+	// A file modified within the grace period is left untouched
+	if result := byID[live.ID]; result.Status != RecoverySkipped || result.Err != nil {
+		t.Errorf("live recording: %+v", result)
+	}
+	if recording, _ := repo.GetByID(live.ID); recording.Status != models.RecordingStatusRecording {
+		t.Errorf("live recording status = %s, want recording", recording.Status)
+	}
+	if data, _ := os.ReadFile(live.FilePath); string(data) != string(crashed) {
+		t.Error("live recording's file was modified")
+	}
+}
+
+func TestRecorderHeartbeat(t *testing.T) {
+	// A paused FLAC recording without checkpoints writes nothing at all
+	format := DefaultAudioFormat()
+	format.Codec = CodecFLAC
+	rec, repo := newTestRecorder(t, Config{Format: format, Source: NewToneSource(440, 0.5), CheckpointInterval: -1})
+	rec.heartbeat = 20 * time.Millisecond
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer rec.Stop()
+	if err := rec.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+
+	path := rec.GetCurrentFile()
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	results, err := RecoverInterrupted(repo, format, RecoveryGracePeriod)
+	if err != nil {
+		t.Fatalf("RecoverInterrupted: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != RecoverySkipped {
+		t.Errorf("recovery of a paused recording: %+v", results)
+	}
+	if recording, _ := repo.GetByID(rec.GetRecordingID()); recording.Status != models.RecordingStatusRecording {
+		t.Errorf("paused recording status = %s, want recording", recording.Status)
+	}
+}
+
+func TestRecorderSegments(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{
+		Source:          NewSilenceSource(),
+		SegmentDuration: 100 * time.Millisecond,
+	})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	segments, err := repo.ListSegments(1)
+	if err != nil {
+		t.Fatalf("ListSegments: %v", err)
+	}
+	if len(segments) < 3 {
+		t.Fatalf("got %d segments, want at least 3", len(segments))
+	}
+
+	var offset float64
+	for i, segment := range segments {
+		if segment.Index != i {
+			t.Errorf("segment %d has index %d", i, segment.Index)
+		}
+		if diff := segment.StartOffsetSeconds - offset; diff > 0.001 || diff < -0.001 {
+			t.Errorf("segment %d starts at %.3fs, want %.3fs", i, segment.StartOffsetSeconds, offset)
+		}
+		info := readWAV(t, segment.FilePath)
+		if i < len(segments)-1 && info.Format.Duration(info.DataSize) != 100*time.Millisecond {
+			t.Errorf("segment %d is %v long, want 100ms", i, info.Format.Duration(info.DataSize))
+		}
+		offset += segment.DurationSeconds
+	}
+}
+
+func TestRecorderSplitTracks(t *testing.T) {
+	format := DefaultAudioFormat()
+	format.Channels = 2
+	rec, repo := newTestRecorder(t, Config{
+		Format:      format,
+		Source:      NewMultiSource(NewToneSource(440, 0.5), NewToneSource(660, 0.25)),
+		SplitTracks: true,
+	})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := rec.GetCurrentFile()
+	time.Sleep(300 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	tracks, err := repo.ListTracks(rec.GetRecordingID())
+	if err != nil {
+		t.Fatalf("ListTracks: %v", err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	if tracks[1].Label == nil || *tracks[1].Label != "660 Hz tone" {
+		t.Errorf("track 2 label = %v, want the second source's name", tracks[1].Label)
+	}
+
+	// The recording's own file is the average of the mono tracks
+	mono := DefaultAudioFormat().wavFormat()
+	mix := readWAV(t, path)
+	if mix.Format != mono || mix.DataSize == 0 {
+		t.Fatalf("mixdown is %+v with %d bytes of audio, want mono", mix.Format, mix.DataSize)
+	}
+	samples := make([][]byte, len(tracks))
+	for i, track := range tracks {
+		info := readWAV(t, track.FilePath)
+		if info.Format != mono || info.DataSize != mix.DataSize {
+			t.Fatalf("track %d is %+v with %d bytes, want mono like the %d-byte mixdown", i+1, info.Format, info.DataSize, mix.DataSize)
+		}
+		if track.FileSizeBytes != info.DataOffset+info.DataSize {
+			t.Errorf("track %d file_size_bytes = %d, want %d", i+1, track.FileSizeBytes, info.DataOffset+info.DataSize)
+		}
+		samples[i], _ = os.ReadFile(track.FilePath)
+		samples[i] = samples[i][info.DataOffset:]
+	}
+	mixed, _ := os.ReadFile(path)
+	mixed = mixed[mix.DataOffset:]
+	for i := 0; i+1 < len(mixed); i += 2 {
+		a := int16(binary.LittleEndian.Uint16(samples[0][i:]))
+		b := int16(binary.LittleEndian.Uint16(samples[1][i:]))
+		got := int16(binary.LittleEndian.Uint16(mixed[i:]))
+		if want := (int(a) + int(b)) / 2; got < int16(want-1) || got > int16(want+1) {
+			t.Fatalf("mixdown sample %d = %d, want about %d", i/2, got, want)
+		}
+	}
+
+	if _, err := New(Config{Source: NewSilenceSource(), SplitTracks: true}); err == nil {
+		t.Error("New accepted split tracks for a mono format")
+	}
+}
+
+func TestFileSourceReplay(t *testing.T) {
+	// Record a short tone, then replay it through a second recorder
+	original, _ := newTestRecorder(t, Config{Source: NewToneSource(440, 0.5)})
+	if err := original.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := original.GetCurrentFile()
+	time.Sleep(200 * time.Millisecond)
+	if err := original.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Metadata after the audio must not be replayed as audio
+	if err := os.WriteFile(path, append(append([]byte{}, want...), "LIST\x04\x00\x00\x00INFO"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, _ := newTestRecorder(t, Config{Source: NewFileSource(path, false)})
+	if err := replay.Start(); err != nil {
+		t.Fatalf("Start replay: %v", err)
+	}
+	replayPath := replay.GetCurrentFile()
+	time.Sleep(100 * time.Millisecond)
+	if err := replay.Stop(); err != nil {
+		t.Fatalf("Stop replay: %v", err)
+	}
+
+	got, err := os.ReadFile(replayPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("replayed file (%d bytes) differs from original (%d bytes)", len(got), len(want))
+	}
+}
+
+func TestRecorderFLAC(t *testing.T) {
+	input := writeToneWAV(t, 2*time.Second, time.Second)
+	format := DefaultAudioFormat()
+	format.Codec = CodecFLAC
+
+	rec, repo := newTestRecorder(t, Config{Format: format, Source: NewFileSource(input, false)})
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := rec.GetCurrentFile()
+	time.Sleep(200 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if filepath.Ext(path) != ".flac" {
+		t.Errorf("recorded to %s, want a .flac file", path)
+	}
+	recording, err := repo.GetByID(rec.GetRecordingID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if recording.Codec != "flac" {
+		t.Errorf("codec = %q, want flac", recording.Codec)
+	}
+
+	inputSize := readWAV(t, input).DataSize
+	if recording.FileSizeBytes <= 0 || recording.FileSizeBytes >= inputSize/2 {
+		t.Errorf("FLAC file is %d bytes, want well under the %d bytes of PCM", recording.FileSizeBytes, inputSize)
+	}
+
+	// Decoding gives back exactly the audio that was recorded
+	decoded := filepath.Join(t.TempDir(), "decoded.wav")
+	if err := flac.Decode(path, decoded); err != nil {
+		t.Fatalf("flac.Decode: %v", err)
+	}
+	want, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("decoded file (%d bytes) differs from the input (%d bytes)", len(got), len(want))
+	}
+}
+
+func TestArchiveRecordings(t *testing.T) {
+	input := writeToneWAV(t, time.Second, time.Second)
+	rec, repo := newTestRecorder(t, Config{
+		Source:          NewFileSource(input, false),
+		SegmentDuration: 500 * time.Millisecond,
+	})
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	segments, err := repo.ListSegments(rec.GetRecordingID())
+	if err != nil || len(segments) != 4 {
+		t.Fatalf("ListSegments = %d segments, %v; want 4", len(segments), err)
+	}
+
+	// Recordings younger than the minimum age are left alone
+	results, err := ArchiveRecordings(repo, time.Hour)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("ArchiveRecordings(1h) = %+v, %v; want nothing", results, err)
+	}
+
+	results, err = ArchiveRecordings(repo, 0)
+	if err != nil {
+		t.Fatalf("ArchiveRecordings: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != ArchiveArchived || results[0].Err != nil {
+		t.Fatalf("ArchiveRecordings = %+v, want one archived recording", results)
+	}
+	if results[0].SavedBytes <= 0 {
+		t.Errorf("saved %d bytes", results[0].SavedBytes)
+	}
+
+	recording, err := repo.GetByID(rec.GetRecordingID())
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if recording.Codec != "flac" || recording.FilePath != results[0].FilePath || filepath.Ext(recording.Filename) != ".flac" {
+		t.Errorf("archived recording = %+v", recording)
+	}
+	if segments, _ := repo.ListSegments(recording.ID); len(segments) != 0 {
+		t.Errorf("%d segments left after archiving", len(segments))
+	}
+	for _, segment := range segments {
+		if _, err := os.Stat(segment.FilePath); !os.IsNotExist(err) {
+			t.Errorf("original %s not deleted: %v", segment.FilePath, err)
+		}
+	}
+
+	// The segments were joined back into the original audio
+	decoded := filepath.Join(t.TempDir(), "decoded.wav")
+	if err := flac.Decode(recording.FilePath, decoded); err != nil {
+		t.Fatalf("flac.Decode: %v", err)
+	}
+	want, _ := os.ReadFile(input)
+	got, _ := os.ReadFile(decoded)
+	if string(got) != string(want) {
+		t.Errorf("archived audio (%d bytes) differs from the input (%d bytes)", len(got), len(want))
+	}
+
+	// Archived recordings aren't picked up again
+	if results, err := ArchiveRecordings(repo, 0); err != nil || len(results) != 0 {
+		t.Errorf("second run = %+v, %v; want nothing", results, err)
+	}
+}
+
+func TestArchiveRecordingsTracks(t *testing.T) {
+	format := DefaultAudioFormat()
+	format.Channels = 2
+	rec, repo := newTestRecorder(t, Config{
+		Format:      format,
+		Source:      NewMultiSource(NewToneSource(440, 0.5), NewToneSource(660, 0.25)),
+		SplitTracks: true,
+	})
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	recording, _ := repo.GetByID(rec.GetRecordingID())
+	tracks, err := repo.ListTracks(recording.ID)
+	if err != nil || len(tracks) != 2 {
+		t.Fatalf("ListTracks = %d tracks, %v; want 2", len(tracks), err)
+	}
+	originals := make([][]byte, len(tracks))
+	for i, track := range tracks {
+		originals[i], _ = os.ReadFile(track.FilePath)
+	}
+
+	// A file already at a destination is never overwritten, and nothing is
+	// archived
+	existing := strings.TrimSuffix(tracks[1].FilePath, ".wav") + ".flac"
+	if err := os.WriteFile(existing, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, err := ArchiveRecordings(repo, 0)
+	if err != nil || len(results) != 1 || results[0].Status != ArchiveFailed || results[0].Err == nil {
+		t.Fatalf("ArchiveRecordings with an existing file = %+v, %v; want failed", results, err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "keep me" {
+		t.Error("existing FLAC file was overwritten")
+	}
+	if _, err := os.Stat(strings.TrimSuffix(recording.FilePath, ".wav") + ".flac"); !os.IsNotExist(err) {
+		t.Errorf("mixdown FLAC file left behind after the failure: %v", err)
+	}
+	if unchanged, _ := repo.GetByID(recording.ID); unchanged.Codec != "wav" || unchanged.FilePath != recording.FilePath {
+		t.Errorf("recording changed by a failed archive: %+v", unchanged)
+	}
+	for _, track := range tracks {
+		readWAV(t, track.FilePath)
+	}
+	os.Remove(existing)
+
+	results, err = ArchiveRecordings(repo, 0)
+	if err != nil || len(results) != 1 || results[0].Status != ArchiveArchived || results[0].Err != nil {
+		t.Fatalf("ArchiveRecordings = %+v, %v; want one archived recording", results, err)
+	}
+
+	// The tracks are archived with the mixdown and still hold the same audio
+	archived, err := repo.ListTracks(recording.ID)
+	if err != nil || len(archived) != 2 {
+		t.Fatalf("ListTracks after archiving = %d tracks, %v", len(archived), err)
+	}
+	for i, track := range archived {
+		if filepath.Ext(track.FilePath) != ".flac" || *track.Label != *tracks[i].Label {
+			t.Errorf("archived track %d = %+v", i+1, track)
+		}
+		if fileInfo, err := os.Stat(track.FilePath); err != nil || fileInfo.Size() != track.FileSizeBytes {
+			t.Errorf("track %d file_size_bytes = %d, file: %v, %v", i+1, track.FileSizeBytes, fileInfo, err)
+		}
+		if _, err := os.Stat(tracks[i].FilePath); !os.IsNotExist(err) {
+			t.Errorf("original track %d not deleted: %v", i+1, err)
+		}
+
+		decoded := filepath.Join(t.TempDir(), "decoded.wav")
+		if err := flac.Decode(track.FilePath, decoded); err != nil {
+			t.Fatalf("flac.Decode: %v", err)
+		}
+		if got, _ := os.ReadFile(decoded); string(got) != string(originals[i]) {
+			t.Errorf("archived track %d (%d bytes) differs from the original (%d bytes)", i+1, len(got), len(originals[i]))
+		}
+	}
+}
+
+func TestFileSourceRejectsMismatchedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stereo.wav")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stereo := wav.Format{SampleRate: 44100, Channels: 2, BitDepth: 16}
+	if err := wav.WriteHeader(file, stereo, 0); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	source := NewFileSource(path, false)
+	if err := source.Open(DefaultAudioFormat()); err == nil {
+		source.Close()
+		t.Error("Open succeeded for a stereo 44.1kHz file")
+	}
+}
+
+func TestRecorderLevels(t *testing.T) {
+	rec, _ := newTestRecorder(t, Config{Source: NewToneSource(440, 0.5)})
+
+	if levels := rec.GetLevels(); levels.RMS != MinLevel || levels.Peak != MinLevel {
+		t.Errorf("levels before Start = %+v, want silence", levels)
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	levels := rec.GetLevels()
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	// A half-scale sine peaks at -6 dBFS with an RMS 3 dB lower
+	if levels.Peak < -6.5 || levels.Peak > -5.5 {
+		t.Errorf("peak = %.1f dBFS, want about -6", levels.Peak)
+	}
+	if levels.RMS < -9.5 || levels.RMS > -8.5 {
+		t.Errorf("RMS = %.1f dBFS, want about -9", levels.RMS)
+	}
+	if levels.Clipping {
+		t.Error("half-scale tone reported as clipping")
+	}
+	if levels.SilentFor > 50*time.Millisecond {
+		t.Errorf("silent for %v while a tone was playing", levels.SilentFor)
+	}
+
+	// Full scale clips; silence counts up
+	rec.SetSource(NewToneSource(440, 1))
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	clipped := rec.GetLevels().Clipping
+	rec.Stop()
+	if !clipped {
+		t.Error("full-scale tone not reported as clipping")
+	}
+
+	rec.SetSource(NewSilenceSource())
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	levels = rec.GetLevels()
+	rec.Stop()
+	if levels.RMS != MinLevel {
+		t.Errorf("RMS of silence = %.1f dBFS, want %.0f", levels.RMS, MinLevel)
+	}
+	if levels.SilentFor < 150*time.Millisecond {
+		t.Errorf("silent for %v, want about 200ms", levels.SilentFor)
+	}
+}
+
+// droppingSource is a tone that claims to have lost some buffers
+type droppingSource struct {
+	*ToneSource
+	dropped int64
+}
+
+func (s *droppingSource) DroppedBuffers() int64 {
+	return s.dropped
+}
+
+func TestRecorderDroppedBuffers(t *testing.T) {
+	format := DefaultAudioFormat()
+	format.Channels = 2
+	rec, _ := newTestRecorder(t, Config{
+		Format: format,
+		Source: NewMultiSource(
+			&droppingSource{ToneSource: NewToneSource(440, 0.5), dropped: 2},
+			&droppingSource{ToneSource: NewToneSource(660, 0.5), dropped: 3},
+		),
+		SplitTracks: true,
+	})
+	if levels := rec.GetLevels(); levels.DroppedBuffers != 0 {
+		t.Errorf("dropped %d buffers before recording", levels.DroppedBuffers)
+	}
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer rec.Stop()
+	if levels := rec.GetLevels(); levels.DroppedBuffers != 5 {
+		t.Errorf("dropped buffers = %d, want the 5 lost by both devices", levels.DroppedBuffers)
+	}
+}
+
+func TestRecorderDSP(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{
+		Source: NewToneSource(440, 0.1),
+		DSP:    DSPConfig{GainDB: 12},
+	})
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	path := rec.GetCurrentFile()
+	id := rec.GetRecordingID()
+	time.Sleep(300 * time.Millisecond)
+
+	// The meter shows the input, not the boosted audio
+	input := toDBFS(0.1 / math.Sqrt2)
+	if levels := rec.GetLevels(); math.Abs(levels.RMS-input) > 1 {
+		t.Errorf("metered RMS = %.1f dBFS, want %.1f", levels.RMS, input)
+	}
+	if dsp := rec.GetDSP(); dsp.GainDB != 12 {
+		t.Errorf("processing while recording = %+v, want a 12 dB gain", dsp)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	info := readWAV(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rms, _, _ := measureLevels(data[info.DataOffset:], rec.format)
+	if math.Abs(rms-(input+12)) > 0.5 {
+		t.Errorf("recorded RMS = %.1f dBFS, want %.1f", rms, input+12)
+	}
+
+	// The settings are kept with the recording so it can be reproduced
+	saved, err := repo.GetByID(id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if saved.Processing == nil || saved.Processing.GainDB != 12 || saved.Processing.AGC {
+		t.Errorf("saved processing = %+v, want a 12 dB gain", saved.Processing)
+	}
+
+	// Processing given to one start applies to that recording alone
+	if err := rec.StartWith(StartOptions{DSP: &DSPConfig{GainDB: 100}}); !errors.Is(err, ErrInvalidDSP) {
+		t.Errorf("StartWith invalid processing = %v, want ErrInvalidDSP", err)
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Errorf("state after invalid processing = %v, want stopped", state)
+	}
+	for _, want := range []float64{-6, 12} {
+		opts := StartOptions{}
+		if want != 12 {
+			opts.DSP = &DSPConfig{GainDB: want}
+		}
+		if err := rec.StartWith(opts); err != nil {
+			t.Fatalf("StartWith: %v", err)
+		}
+		if dsp := rec.GetDSP(); dsp.GainDB != want {
+			t.Errorf("processing while recording = %+v, want a %v dB gain", dsp, want)
+		}
+		id := rec.GetRecordingID()
+		if err := rec.Stop(); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+		if saved, _ := repo.GetByID(id); saved.Processing == nil || saved.Processing.GainDB != want {
+			t.Errorf("saved processing = %+v, want a %v dB gain", saved.Processing, want)
+		}
+	}
+	if dsp := rec.GetDSP(); dsp.GainDB != 12 {
+		t.Errorf("processing after recording = %+v, want the configured 12 dB gain", dsp)
+	}
+}
+
+// toneFrames returns d of a mono sine wave of the given amplitude
+func toneFrames(format AudioFormat, amplitude float64, d time.Duration) []byte {
+	frames := int(d.Seconds() * float64(format.SampleRate))
+	data := make([]byte, frames*format.bytesPerSample())
+	for i := 0; i < frames; i++ {
+		value := amplitude * math.Sin(2*math.Pi*440*float64(i)/float64(format.SampleRate))
+		format.encodeSample(data[i*format.bytesPerSample():], value)
+	}
+	return data
+}
+
+func TestDSPChain(t *testing.T) {
+	format := DefaultAudioFormat()
+	quiet := toneFrames(format, 0.025, 100*time.Millisecond) // About -35 dBFS
+
+	// AGC slowly brings quiet speech up to the target
+	agc := newDSPChain(DSPConfig{AGC: true}, format)
+	var rms float64
+	for i := 0; i < 80; i++ {
+		rms, _, _ = measureLevels(agc.process(quiet), format)
+	}
+	if math.Abs(rms-DefaultAGCTarget) > 1 {
+		t.Errorf("AGC output after 8s = %.1f dBFS, want %.1f", rms, DefaultAGCTarget)
+	}
+
+	// The gate closes once the hold time has passed and reopens for speech
+	gate := newDSPChain(DSPConfig{NoiseGateDB: -30}, format)
+	var peak float64
+	for i := 0; i < 5; i++ {
+		_, peak, _ = measureLevels(gate.process(quiet), format)
+	}
+	if peak != MinLevel {
+		t.Errorf("gated peak = %v, want silence", peak)
+	}
+	loud := toneFrames(format, 0.5, 100*time.Millisecond)
+	gate.process(loud)
+	if out := gate.process(loud); string(out) != string(loud) {
+		t.Error("gate didn't reopen for loud input")
+	}
+
+	if newDSPChain(DSPConfig{}, format) != nil {
+		t.Error("zero DSPConfig built a chain")
+	}
+}
+
+func TestRecorderFormats(t *testing.T) {
+	formats := []AudioFormat{
+		{SampleRate: 48000, Channels: 2, BitDepth: 16},
+		{SampleRate: 48000, Channels: 2, BitDepth: 24},
+		{SampleRate: 48000, Channels: 1, BitDepth: 32},
+		{SampleRate: 48000, Channels: 1, BitDepth: 32, Float: true},
+	}
+
+	for _, format := range formats {
+		rec, _ := newTestRecorder(t, Config{Format: format, Source: NewToneSource(440, 0.5)})
+		if err := rec.Start(); err != nil {
+			t.Fatalf("%+v: Start: %v", format, err)
+		}
+		path := rec.GetCurrentFile()
+		time.Sleep(100 * time.Millisecond)
+		levels := rec.GetLevels()
+		if err := rec.Stop(); err != nil {
+			t.Fatalf("%+v: Stop: %v", format, err)
+		}
+
+		info := readWAV(t, path)
+		if info.Format != format.wavFormat() {
+			t.Errorf("%+v: header format = %+v", format, info.Format)
+		}
+		if info.DataSize == 0 || info.DataSize%int64(info.Format.BlockAlign()) != 0 {
+			t.Errorf("%+v: data size %d is not whole frames", format, info.DataSize)
+		}
+		if levels.Peak < -6.5 || levels.Peak > -5.5 {
+			t.Errorf("%+v: peak = %.1f dBFS, want about -6", format, levels.Peak)
+		}
+	}
+
+	invalid := []AudioFormat{
+		{SampleRate: 16000, Channels: 1, BitDepth: 8},
+		{SampleRate: 16000, Channels: 1, BitDepth: 16, Float: true},
+		{SampleRate: 16000, Channels: 0, BitDepth: 16},
+		{SampleRate: 1000, Channels: 1, BitDepth: 16},
+		{SampleRate: 16000, Channels: 1, BitDepth: 32, Float: true, Codec: CodecFLAC},
+	}
+	for _, format := range invalid {
+		if _, err := New(Config{Format: format, Source: NewSilenceSource()}); err == nil {
+			t.Errorf("New accepted unsupported format %+v", format)
+		}
+	}
+}
+
+// writeToneWAV writes a 16 kHz mono WAV file made of alternating stretches
+// of half-scale tone and silence
+func writeToneWAV(t *testing.T, stretches ...time.Duration) string {
+	t.Helper()
+
+	format := DefaultAudioFormat()
+	var data []byte
+	for i, stretch := range stretches {
+		samples := int(stretch.Seconds() * float64(format.SampleRate))
+		for n := 0; n < samples; n++ {
+			var sample int16
+			if i%2 == 0 {
+				sample = int16(16384 * math.Sin(2*math.Pi*440*float64(n)/float64(format.SampleRate)))
+			}
+			data = binary.LittleEndian.AppendUint16(data, uint16(sample))
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "input.wav")
+	if err := os.WriteFile(path, append(wav.Header(format.wavFormat(), int64(len(data))), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecorderVAD(t *testing.T) {
+	tests := []struct {
+		mode         VADMode
+		wantAudio    time.Duration
+		wantOffset   float64
+		wantDuration float64
+	}{
+		// The first 100ms of the silence is kept, the other 300ms skipped
+		{VADAutoPause, 300 * time.Millisecond, 0.2, 0.3},
+		// Everything is kept and the whole silence marked
+		{VADMarkSilence, 600 * time.Millisecond, 0.1, 0.4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			input := writeToneWAV(t, 100*time.Millisecond, 400*time.Millisecond, 100*time.Millisecond)
+			rec, repo := newTestRecorder(t, Config{
+				Source: NewFileSource(input, false),
+				VAD:    VADConfig{Mode: tt.mode, MinSilence: 100 * time.Millisecond},
+			})
+
+			if err := rec.Start(); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			path := rec.GetCurrentFile()
+			time.Sleep(100 * time.Millisecond)
+			if err := rec.Stop(); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+
+			info := readWAV(t, path)
+			if got := info.Format.Duration(info.DataSize); got != tt.wantAudio {
+				t.Errorf("recorded %v of audio, want %v", got, tt.wantAudio)
+			}
+
+			silences, err := repo.ListSilences(1)
+			if err != nil {
+				t.Fatalf("ListSilences: %v", err)
+			}
+			if len(silences) != 1 {
+				t.Fatalf("got %d silences, want 1", len(silences))
+			}
+			silence := silences[0]
+			if silence.Trimmed != (tt.mode == VADAutoPause) {
+				t.Errorf("trimmed = %v in %v mode", silence.Trimmed, tt.mode)
+			}
+			if math.Abs(silence.OffsetSeconds-tt.wantOffset) > 0.011 {
+				t.Errorf("silence at %.3fs, want %.3fs", silence.OffsetSeconds, tt.wantOffset)
+			}
+			if math.Abs(silence.DurationSeconds-tt.wantDuration) > 0.011 {
+				t.Errorf("silence lasted %.3fs, want %.3fs", silence.DurationSeconds, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestRecorderMarkers(t *testing.T) {
+	rec, repo := newTestRecorder(t, Config{Source: NewSilenceSource()})
+
+	if _, err := rec.AddMarker("too early"); err == nil {
+		t.Error("AddMarker before Start succeeded")
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	crit, err := rec.AddMarker("")
+	if err != nil {
+		t.Fatalf("AddMarker: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, err := rec.AddMarker("Big reveal"); err != nil {
+		t.Fatalf("AddMarker: %v", err)
+	}
+	if err := rec.SetMarkerLabel(crit.ID, "Natural 20"); err != nil {
+		t.Fatalf("SetMarkerLabel: %v", err)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	markers, err := repo.ListMarkers(1)
+	if err != nil {
+		t.Fatalf("ListMarkers: %v", err)
+	}
+	if len(markers) != 2 {
+		t.Fatalf("got %d markers, want 2", len(markers))
+	}
+	for i, want := range []struct {
+		label  string
+		offset float64
+	}{{"Natural 20", 0.2}, {"Big reveal", 0.4}} {
+		if markers[i].Label == nil || *markers[i].Label != want.label {
+			t.Errorf("marker %d label = %v, want %q", i, markers[i].Label, want.label)
+		}
+		if math.Abs(markers[i].OffsetSeconds-want.offset) > 0.1 {
+			t.Errorf("marker %d at %.3fs, want about %.1fs", i, markers[i].OffsetSeconds, want.offset)
+		}
+	}
+}
+
+func TestRecorderConcurrentControl(t *testing.T) {
+	rec, _ := newTestRecorder(t, Config{Source: NewSilenceSource()})
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Exactly one of several simultaneous Stops may succeed, and none may
+	// panic closing the capture channel twice
+	var wg sync.WaitGroup
+	var stopped atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec.Pause()
+			if rec.Stop() == nil {
+				stopped.Add(1)
+			}
+			rec.Resume()
+		}()
+	}
+	wg.Wait()
+
+	if got := stopped.Load(); got != 1 {
+		t.Errorf("%d Stop calls succeeded, want 1", got)
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Errorf("state = %v, want stopped", state)
+	}
+}
+
+func TestLastOccurrence(t *testing.T) {
+	// Friday 16 October 2026
+	now := time.Date(2026, 10, 16, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		weekday      time.Weekday
+		hour, minute int
+		want         time.Time
+	}{
+		{time.Friday, 19, 30, time.Date(2026, 10, 16, 19, 30, 0, 0, time.UTC)},
+		{time.Friday, 20, 0, now},
+		{time.Friday, 21, 0, time.Date(2026, 10, 9, 21, 0, 0, 0, time.UTC)},
+		{time.Tuesday, 18, 0, time.Date(2026, 10, 13, 18, 0, 0, 0, time.UTC)},
+		{time.Saturday, 12, 0, time.Date(2026, 10, 10, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := lastOccurrence(tt.weekday, tt.hour, tt.minute, now); !got.Equal(tt.want) {
+			t.Errorf("last %v %02d:%02d = %v, want %v", tt.weekday, tt.hour, tt.minute, got, tt.want)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.New(db.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	repo := db.NewRecordingRepository(database)
+	campaigns := db.NewCampaignRepository(database)
+	sessions := db.NewSessionRepository(database)
+	rec, err := New(Config{DataDir: dir, DB: repo, Source: NewSilenceSource()})
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	campaign, err := campaigns.Create(models.CreateCampaignParams{Name: "Curse of Strahd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Create(models.CreateSessionParams{CampaignID: campaign.ID, Name: "Session 1", SessionNumber: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = campaigns.SetSchedule(models.SetCampaignScheduleParams{
+		CampaignID:            campaign.ID,
+		Weekday:               time.Friday,
+		StartTime:             "19:00",
+		SilenceTimeoutSeconds: 1,
+		Enabled:               true,
+	})
+	if err != nil {
+		t.Fatalf("SetSchedule: %v", err)
+	}
+
+	scheduler := NewScheduler(rec, campaigns, sessions)
+	now := time.Date(2026, 10, 16, 18, 59, 0, 0, time.Local)
+	scheduler.now = func() time.Time { return now }
+
+	if err := scheduler.tick(); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if state := rec.GetState(); state != StateIdle {
+		t.Fatalf("state before game time = %v, want idle", state)
+	}
+
+	// At game time the next session is created and recorded
+	now = now.Add(2 * time.Minute)
+	if err := scheduler.tick(); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if state := rec.GetState(); state != StateRecording {
+		t.Fatalf("state at game time = %v, want recording", state)
+	}
+	recording, err := repo.GetByID(rec.GetRecordingID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recording.SessionID == nil {
+		t.Fatal("scheduled recording isn't linked to a session")
+	}
+	session, err := sessions.GetByID(*recording.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.CampaignID != campaign.ID || session.SessionNumber != 2 {
+		t.Errorf("scheduled session = %+v, want session 2 of campaign %d", session, campaign.ID)
+	}
+
+	// After a second of silence the recording is stopped
+	time.Sleep(1100 * time.Millisecond)
+	if err := scheduler.tick(); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Fatalf("state after silence = %v, want stopped", state)
+	}
+	recording, err = repo.GetByID(recording.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recording.StopReason == nil || *recording.StopReason != models.StopReasonSilence {
+		t.Errorf("stop reason = %v, want %s", recording.StopReason, models.StopReasonSilence)
+	}
+
+	// The same game isn't recorded twice
+	if err := scheduler.tick(); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if state := rec.GetState(); state != StateStopped {
+		t.Errorf("state after the game = %v, want stopped", state)
+	}
+}
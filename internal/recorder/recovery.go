@@ -0,0 +1,218 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/flac"
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// RecoverySkipped is the result status of a recording that recovery left alone
+const RecoverySkipped = "skipped"
+
+// RecoveryGracePeriod is how long a recording must go unmodified before
+// startup recovery treats it as interrupted. Anything more recent may belong
+// to another recorder process that is still running.
+const RecoveryGracePeriod = 2 * time.Minute
+
+// heartbeatInterval is how often a running recorder touches the file it's
+// writing, whether or not it's writing audio, so the file's modification time
+// stays well within RecoveryGracePeriod
+const heartbeatInterval = RecoveryGracePeriod / 4
+
+// RecoveryResult describes what happened to one interrupted recording
+type RecoveryResult struct {
+	RecordingID     int64
+	FilePath        string
+	Status          string // completed, failed or skipped
+	DurationSeconds int
+	Err             error
+}
+
+// RecoverInterrupted repairs recordings left in the "recording" state by a
+// crash or power loss. Each WAV header is rewritten from the real file size
+// (FLAC files are only measured) and the row is marked completed, or failed
+// if the audio file is gone.
+//
+// Files modified within minIdle are assumed to belong to a recorder that is
+// still running and are skipped; callers pass RecoveryGracePeriod so they
+// never touch a live recording: running recorders touch their file well
+// within that period, even while paused.
+func RecoverInterrupted(repo *db.RecordingRepository, format AudioFormat, minIdle time.Duration) ([]RecoveryResult, error) {
+	if format.SampleRate == 0 {
+		format = DefaultAudioFormat()
+	}
+
+	recordings, err := repo.ListByStatus(models.RecordingStatusRecording)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RecoveryResult, 0, len(recordings))
+	for _, rec := range recordings {
+		result := recoverRecording(repo, rec, format, minIdle)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// recoverRecording repairs a single interrupted recording
+func recoverRecording(repo *db.RecordingRepository, rec *models.Recording, format AudioFormat, minIdle time.Duration) RecoveryResult {
+	result := RecoveryResult{
+		RecordingID: rec.ID,
+		FilePath:    rec.FilePath,
+	}
+
+	segments, err := repo.ListSegments(rec.ID)
+	if err != nil {
+		result.Status = RecoverySkipped
+		result.Err = err
+		return result
+	}
+	if len(segments) > 0 {
+		return recoverSegments(repo, rec, segments, format, minIdle)
+	}
+
+	fileInfo, err := os.Stat(rec.FilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		result.Status = models.RecordingStatusFailed
+		result.Err = repo.MarkFailed(rec.ID, "recovery: audio file missing after interrupted recording")
+		return result
+	}
+	if err != nil {
+		result.Status = RecoverySkipped
+		result.Err = fmt.Errorf("failed to stat audio file: %w", err)
+		return result
+	}
+
+	if time.Since(fileInfo.ModTime()) < minIdle {
+		result.Status = RecoverySkipped
+		return result
+	}
+
+	duration, err := repairFile(rec.FilePath, Codec(rec.Codec), format)
+	if err != nil {
+		result.Status = models.RecordingStatusFailed
+		note := fmt.Sprintf("recovery: could not repair audio file: %v", err)
+		if markErr := repo.MarkFailed(rec.ID, note); markErr != nil {
+			err = errors.Join(err, markErr)
+		}
+		result.Err = err
+		return result
+	}
+
+	result.Status = models.RecordingStatusCompleted
+	result.DurationSeconds = int(duration.Seconds())
+	result.Err = errors.Join(
+		repairTracks(repo, rec, format),
+		repo.MarkRecovered(rec.ID, result.DurationSeconds, fileInfo.Size(), recoveryNote(rec)),
+	)
+	return result
+}
+
+// repairFile makes the audio file at path playable and returns how much audio
+// it holds. FLAC files are playable as they are, so they're only decoded to
+// measure them.
+func repairFile(path string, codec Codec, format AudioFormat) (time.Duration, error) {
+	if codec == CodecFLAC {
+		return flac.Duration(path)
+	}
+
+	info, err := wav.Repair(path, format.wavFormat())
+	if err != nil {
+		return 0, err
+	}
+	return info.Format.Duration(info.DataSize), nil
+}
+
+// repairTracks repairs the per-channel track files of an interrupted
+// multi-track recording and saves their sizes
+func repairTracks(repo *db.RecordingRepository, rec *models.Recording, format AudioFormat) error {
+	tracks, err := repo.ListTracks(rec.ID)
+	if err != nil {
+		return err
+	}
+
+	mono := format
+	mono.Channels = 1
+	var errs []error
+	for _, track := range tracks {
+		if _, err := repairFile(track.FilePath, Codec(rec.Codec), mono); err != nil {
+			errs = append(errs, fmt.Errorf("track %d: %w", track.Index+1, err))
+			continue
+		}
+		fileInfo, err := os.Stat(track.FilePath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("track %d: %w", track.Index+1, err))
+			continue
+		}
+		errs = append(errs, repo.UpdateTrackSize(track.ID, fileInfo.Size()))
+	}
+	return errors.Join(errs...)
+}
+
+// recoverSegments repairs every chunk file of an interrupted segmented
+// recording. Segments whose files are gone are left out of the totals.
+func recoverSegments(repo *db.RecordingRepository, rec *models.Recording, segments []*models.RecordingSegment, format AudioFormat, minIdle time.Duration) RecoveryResult {
+	result := RecoveryResult{
+		RecordingID: rec.ID,
+		FilePath:    rec.FilePath,
+	}
+
+	// Only the last segment is being written to by a live recorder
+	last := segments[len(segments)-1]
+	if fileInfo, err := os.Stat(last.FilePath); err == nil && time.Since(fileInfo.ModTime()) < minIdle {
+		result.Status = RecoverySkipped
+		return result
+	}
+
+	var totalSize int64
+	var totalDuration time.Duration
+	var errs []error
+	for _, segment := range segments {
+		info, err := wav.Repair(segment.FilePath, format.wavFormat())
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("segment %d: %w", segment.Index, err))
+			}
+			continue
+		}
+
+		duration := info.Format.Duration(info.DataSize)
+		fileSize := info.DataOffset + info.DataSize
+		if err := repo.UpdateSegment(segment.ID, duration.Seconds(), fileSize); err != nil {
+			errs = append(errs, err)
+		}
+		totalSize += fileSize
+		totalDuration += duration
+	}
+
+	if totalSize == 0 {
+		result.Status = models.RecordingStatusFailed
+		errs = append(errs, repo.MarkFailed(rec.ID, "recovery: audio files missing after interrupted recording"))
+		result.Err = errors.Join(errs...)
+		return result
+	}
+
+	result.Status = models.RecordingStatusCompleted
+	result.DurationSeconds = int(totalDuration.Seconds())
+	errs = append(errs, repo.MarkRecovered(rec.ID, result.DurationSeconds, totalSize, recoveryNote(rec)))
+	result.Err = errors.Join(errs...)
+	return result
+}
+
+// recoveryNote appends the recovery marker to any existing notes
+func recoveryNote(rec *models.Recording) string {
+	note := "recovered: recording was interrupted and repaired at startup"
+	if rec.Notes != nil && *rec.Notes != "" {
+		return *rec.Notes + "\n" + note
+	}
+	return note
+}
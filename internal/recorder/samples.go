@@ -0,0 +1,28 @@
+package recorder
+
+// bytesPerSample returns the size of one sample of one channel
+func (f AudioFormat) bytesPerSample() int {
+	return f.BitDepth / 8
+}
+
+// decodeSample reads the sample at the start of data as a fraction of full
+// scale; see wav.Format.Sample
+func (f AudioFormat) decodeSample(data []byte) float64 {
+	return f.wavFormat().Sample(data)
+}
+
+// encodeSample writes value, a fraction of full scale, as the sample at the
+// start of data; see wav.Format.PutSample
+func (f AudioFormat) encodeSample(data []byte, value float64) {
+	f.wavFormat().PutSample(data, value)
+}
+
+// clipLevel returns the magnitude, as a fraction of full scale, at which a
+// sample counts as clipped
+func (f AudioFormat) clipLevel() float64 {
+	if f.Float {
+		return 1
+	}
+	scale := float64(int64(1) << (f.BitDepth - 1))
+	return (scale - 1) / scale
+}
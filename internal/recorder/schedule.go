@@ -0,0 +1,209 @@
+package recorder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/db"
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+const (
+	// DefaultScheduleMaxDuration stops a scheduled recording that nobody
+	// stopped, e.g. because the game ran into the early hours
+	DefaultScheduleMaxDuration = 6 * time.Hour
+
+	// DefaultScheduleSilence stops a scheduled recording once the table has
+	// been quiet this long, e.g. after everyone went home
+	DefaultScheduleSilence = 20 * time.Minute
+
+	// scheduleGrace is how late a game may still be started, e.g. after the
+	// server was restarted just after game time
+	scheduleGrace = 30 * time.Minute
+
+	// scheduleInterval is how often the schedules are checked
+	scheduleInterval = 30 * time.Second
+)
+
+// ParseStartTime parses a game time in HH:MM (24-hour) form
+func ParseStartTime(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start time %q (want HH:MM)", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// lastOccurrence returns the most recent weekday at hour:minute, in now's
+// time zone, that isn't after now
+func lastOccurrence(weekday time.Weekday, hour, minute int, now time.Time) time.Time {
+	days := (int(now.Weekday()) - int(weekday) + 7) % 7
+	t := time.Date(now.Year(), now.Month(), now.Day()-days, hour, minute, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -7)
+	}
+	return t
+}
+
+// Scheduler records campaigns at their weekly game time. When a schedule is
+// due it creates the campaign's next session, starts recording it and stops
+// the recording after the schedule's maximum duration or once it has been
+// silent for too long. Recordings started by hand are left alone.
+type Scheduler struct {
+	recorder  *Recorder
+	campaigns *db.CampaignRepository
+	sessions  *db.SessionRepository
+	now       func() time.Time // Swapped out in tests
+	run       *scheduledRun    // The recording the scheduler started, if any
+}
+
+// scheduledRun is a recording started by the scheduler
+type scheduledRun struct {
+	recordingID    int64
+	started        time.Time
+	maxDuration    time.Duration
+	silenceTimeout time.Duration
+}
+
+// NewScheduler creates a scheduler driving rec
+func NewScheduler(rec *Recorder, campaigns *db.CampaignRepository, sessions *db.SessionRepository) *Scheduler {
+	return &Scheduler{
+		recorder:  rec,
+		campaigns: campaigns,
+		sessions:  sessions,
+		now:       time.Now,
+	}
+}
+
+// Run checks the schedules every scheduleInterval until stop is closed
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.tick(); err != nil {
+			fmt.Printf("Failed to check recording schedules: %v\n", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick stops the scheduled recording if it's over and starts any game that
+// is due
+func (s *Scheduler) tick() error {
+	now := s.now()
+	s.checkRun(now)
+
+	schedules, err := s.campaigns.ListSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if !schedule.Enabled {
+			continue
+		}
+		hour, minute, err := ParseStartTime(schedule.StartTime)
+		if err != nil {
+			fmt.Printf("Ignoring schedule of campaign %d: %v\n", schedule.CampaignID, err)
+			continue
+		}
+
+		due := lastOccurrence(schedule.Weekday, hour, minute, now)
+		if now.Sub(due) > scheduleGrace || (schedule.LastRunAt != nil && !schedule.LastRunAt.Before(due)) {
+			continue
+		}
+
+		// Only try each game once, even if it can't be recorded
+		if err := s.campaigns.MarkScheduleRun(schedule.ID, now); err != nil {
+			return err
+		}
+		if err := s.start(schedule, now); err != nil {
+			fmt.Printf("Failed to start scheduled recording of campaign %d: %v\n", schedule.CampaignID, err)
+		}
+	}
+
+	return nil
+}
+
+// start creates the campaign's next session and records it
+func (s *Scheduler) start(schedule *models.CampaignSchedule, now time.Time) error {
+	if state := s.recorder.GetState(); state == StateRecording || state == StatePaused {
+		return fmt.Errorf("recorder is already active")
+	}
+
+	number, err := s.sessions.NextSessionNumber(schedule.CampaignID)
+	if err != nil {
+		return err
+	}
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	session, err := s.sessions.Create(models.CreateSessionParams{
+		CampaignID:    schedule.CampaignID,
+		Name:          fmt.Sprintf("Session %d", number),
+		SessionNumber: number,
+		SessionDate:   &date,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.recorder.StartForSession(session.ID); err != nil {
+		// Don't leave an empty session behind to take up the number
+		s.sessions.Delete(session.ID)
+		return err
+	}
+
+	run := &scheduledRun{
+		recordingID:    s.recorder.GetRecordingID(),
+		started:        now,
+		maxDuration:    time.Duration(schedule.MaxDurationSeconds) * time.Second,
+		silenceTimeout: time.Duration(schedule.SilenceTimeoutSeconds) * time.Second,
+	}
+	if run.maxDuration == 0 {
+		run.maxDuration = DefaultScheduleMaxDuration
+	}
+	if run.silenceTimeout == 0 {
+		run.silenceTimeout = DefaultScheduleSilence
+	}
+	s.run = run
+
+	fmt.Printf("Started scheduled recording of campaign %d, session %d\n", schedule.CampaignID, number)
+	return nil
+}
+
+// checkRun stops the scheduled recording once it has run for its maximum
+// duration or been silent for its silence timeout. Silence while paused
+// doesn't count.
+func (s *Scheduler) checkRun(now time.Time) {
+	if s.run == nil {
+		return
+	}
+
+	state := s.recorder.GetState()
+	if s.recorder.GetRecordingID() != s.run.recordingID || (state != StateRecording && state != StatePaused) {
+		// Stopped some other way
+		s.run = nil
+		return
+	}
+
+	var reason string
+	switch {
+	case now.Sub(s.run.started) >= s.run.maxDuration:
+		reason = models.StopReasonMaxDuration
+	case state == StateRecording && s.recorder.GetLevels().SilentFor >= s.run.silenceTimeout:
+		reason = models.StopReasonSilence
+	default:
+		return
+	}
+
+	fmt.Printf("Stopping scheduled recording %d: %s\n", s.run.recordingID, reason)
+	if err := s.recorder.stop(s.run.recordingID, reason); err != nil {
+		fmt.Printf("Failed to stop scheduled recording: %v\n", err)
+	}
+	s.run = nil
+}
@@ -0,0 +1,126 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// segmentPath returns the file path of the segment with the given index. The
+// first segment keeps the recording's own filename.
+func (r *Recorder) segmentPath(index int) string {
+	if index == 0 {
+		return filepath.Join(r.dataDir, r.baseName+r.format.Codec.Extension())
+	}
+	return filepath.Join(r.dataDir, fmt.Sprintf("%s_%03d%s", r.baseName, index+1, r.format.Codec.Extension()))
+}
+
+// startSegment creates the file for the segment with the given index and
+// makes it the current file. Callers must hold r.mu.
+func (r *Recorder) startSegment(index int) error {
+	filePath := r.segmentPath(index)
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create audio file: %w", err)
+	}
+
+	var encoder Encoder
+	if r.splitTracks {
+		encoder, err = r.startTracks(file)
+	} else {
+		encoder, err = NewEncoder(file, r.format)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if r.segmentLimit > 0 {
+		segment, err := r.db.CreateSegment(models.CreateRecordingSegmentParams{
+			RecordingID:        r.currentID,
+			Index:              index,
+			FilePath:           filePath,
+			StartOffsetSeconds: r.segmentStart.Seconds(),
+		})
+		if err != nil {
+			file.Close()
+			return err
+		}
+		r.segmentID = segment.ID
+	}
+
+	r.currentFile = file
+	r.encoder = encoder
+	r.segmentIndex = index
+	r.segmentBytes = 0
+	return nil
+}
+
+// finishSegment finalizes and closes the current file, adding its size to the
+// recording's total. Callers must hold r.mu.
+func (r *Recorder) finishSegment() error {
+	// Finish the stream, e.g. the WAV header with the final size
+	err := r.encoder.Close()
+	if tracksErr := r.finishTracks(); err == nil {
+		err = tracksErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finalize audio file: %w", err)
+	}
+
+	// Get file size
+	fileInfo, err := r.currentFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	// Close the file
+	if err := r.currentFile.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	duration := r.format.wavFormat().Duration(r.segmentBytes)
+	if r.segmentLimit > 0 {
+		if err := r.db.UpdateSegment(r.segmentID, duration.Seconds(), fileInfo.Size()); err != nil {
+			return err
+		}
+	}
+
+	r.closedSize += fileInfo.Size()
+	r.segmentStart += duration
+	return nil
+}
+
+// writeAudio writes captured audio to the current file, rolling over to a new
+// segment whenever the current one is full. Callers must hold r.mu.
+func (r *Recorder) writeAudio(data []byte) error {
+	for len(data) > 0 {
+		if r.segmentLimit > 0 && r.segmentBytes >= r.segmentLimit {
+			if err := r.finishSegment(); err != nil {
+				return err
+			}
+			if err := r.startSegment(r.segmentIndex + 1); err != nil {
+				return err
+			}
+		}
+
+		// Split the buffer at the segment boundary
+		chunk := data
+		if r.segmentLimit > 0 {
+			if remaining := r.segmentLimit - r.segmentBytes; int64(len(chunk)) > remaining {
+				chunk = chunk[:remaining]
+			}
+		}
+
+		if err := r.encoder.Write(chunk); err != nil {
+			return err
+		}
+		r.segmentBytes += int64(len(chunk))
+		data = data[len(chunk):]
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/config"
+)
+
+// NewConfig builds a recorder configuration from the application settings;
+// only DB is left for the caller. Several comma-separated device IDs record
+// every device at once with a track each, so the format gets one channel per
+// device. Settings that can't be parsed are reported in the error and left at
+// their defaults, so the returned configuration is usable either way.
+func NewConfig(settings *config.Config) (Config, error) {
+	var errs []error
+
+	format := DefaultAudioFormat()
+	format.SampleRate = settings.AudioSampleRate
+	format.Channels = settings.AudioChannels
+	format.BitDepth = settings.AudioBitDepth
+	format.Float = settings.AudioFloat
+	codec, err := ParseCodec(settings.AudioCodec)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("AUDIO_CODEC: %w", err))
+	}
+	format.Codec = codec
+
+	vadMode, err := ParseVADMode(settings.RecorderVAD)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("RECORDER_VAD: %w", err))
+	}
+
+	cfg := Config{
+		DataDir:            settings.DataDir,
+		Format:             format,
+		DeviceID:           settings.AudioDeviceID,
+		SplitTracks:        settings.RecorderSplitTracks,
+		CheckpointInterval: settings.RecorderCheckpointInterval,
+		SegmentDuration:    settings.RecorderSegmentDuration,
+		PreRoll:            settings.RecorderPreRoll,
+		DSP: DSPConfig{
+			GainDB:      settings.RecorderGainDB,
+			AGC:         settings.RecorderAGC,
+			AGCTargetDB: settings.RecorderAGCTarget,
+			NoiseGateDB: settings.RecorderNoiseGate,
+		},
+		DiskWarnBytes: int64(settings.RecorderDiskWarnMB) << 20,
+		DiskStopBytes: int64(settings.RecorderDiskStopMB) << 20,
+		VAD: VADConfig{
+			Mode:       vadMode,
+			Threshold:  settings.RecorderVADThreshold,
+			MinSilence: settings.RecorderVADMinSilence,
+		},
+	}
+
+	if ids := strings.Split(settings.AudioDeviceID, ","); len(ids) > 1 {
+		sources := make([]AudioSource, len(ids))
+		for i, id := range ids {
+			sources[i] = NewMalgoSource(strings.TrimSpace(id))
+		}
+		cfg.Source = NewMultiSource(sources...)
+		cfg.Format.Channels = len(ids)
+		cfg.SplitTracks = true
+	}
+
+	return cfg, errors.Join(errs...)
+}
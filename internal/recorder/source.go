@@ -0,0 +1,43 @@
+package recorder
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSourceClosed is returned by ReadFrames once the source has been closed
+var ErrSourceClosed = errors.New("audio source closed")
+
+// sourceBufferDuration is how much audio the non-hardware sources return from
+// each ReadFrames call, close to what a capture device delivers per callback
+const sourceBufferDuration = 10 * time.Millisecond
+
+// AudioSource produces the audio the recorder writes. The recorder opens the
+// source when recording starts, pulls frames from it until recording stops,
+// then closes it. A source may be opened again after it has been closed.
+type AudioSource interface {
+	// Open prepares the source to deliver interleaved little-endian PCM in
+	// the given format
+	Open(format AudioFormat) error
+
+	// ReadFrames blocks until audio is available and returns it. It returns
+	// io.EOF when a finite source runs out and ErrSourceClosed once Close has
+	// been called.
+	ReadFrames() ([]byte, error)
+
+	// Close stops the source and unblocks any pending ReadFrames. It is safe
+	// to call from another goroutine.
+	Close() error
+
+	// Name describes where the audio comes from, e.g. the capture device's
+	// name. It is saved with the recording.
+	Name() string
+}
+
+// DropCounter is implemented by sources that lose audio when the recorder
+// doesn't keep up with them, such as MalgoSource
+type DropCounter interface {
+	// DroppedBuffers returns how many buffers of audio have been lost since
+	// the source was opened
+	DroppedBuffers() int64
+}
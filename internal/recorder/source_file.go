@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/internal/wav"
+)
+
+// FileSource replays the audio of an existing WAV file, which must match the
+// recorder's format
+type FileSource struct {
+	path     string
+	realtime bool
+
+	mu      sync.Mutex
+	file    *os.File
+	reader  *io.SectionReader
+	chunk   int
+	align   int
+	next    time.Time
+	done    chan struct{}
+	stopped bool
+}
+
+// NewFileSource creates a source that replays the WAV file at path. When
+// realtime is true the audio is delivered at its natural rate; otherwise it
+// is delivered as fast as the recorder can write it.
+func NewFileSource(path string, realtime bool) *FileSource {
+	return &FileSource{
+		path:     path,
+		realtime: realtime,
+	}
+}
+
+// Open opens the WAV file and checks its format
+func (s *FileSource) Open(format AudioFormat) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open audio file: %w", err)
+	}
+
+	info, err := wav.ReadInfo(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to read WAV header: %w", err)
+	}
+	if info.Format != format.wavFormat() {
+		file.Close()
+		return fmt.Errorf("audio file format %+v does not match recorder format %+v", info.Format, format.wavFormat())
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audio file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blockAlign := info.Format.BlockAlign()
+	s.file = file
+	// Chunks after the audio, like LIST metadata, aren't played. The header
+	// of a file cut short can claim more audio than there is.
+	s.reader = io.NewSectionReader(file, info.DataOffset, min(info.DataSize, fileInfo.Size()-info.DataOffset))
+	s.chunk = int(float64(info.Format.SampleRate)*sourceBufferDuration.Seconds()) * blockAlign
+	s.align = blockAlign
+	s.next = time.Now()
+	s.done = make(chan struct{})
+	s.stopped = false
+	return nil
+}
+
+// ReadFrames returns the next buffer of audio from the file, or io.EOF at the
+// end of the file
+func (s *FileSource) ReadFrames() ([]byte, error) {
+	s.mu.Lock()
+	if s.done == nil || s.stopped {
+		s.mu.Unlock()
+		return nil, ErrSourceClosed
+	}
+	wait := time.Until(s.next)
+	done := s.done
+	s.mu.Unlock()
+
+	if s.realtime && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-done:
+			return nil, ErrSourceClosed
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return nil, ErrSourceClosed
+	}
+
+	data := make([]byte, s.chunk)
+	n, err := io.ReadFull(s.reader, data)
+
+	// Drop a partial frame at the end of the file
+	n -= n % s.align
+	if n == 0 {
+		if err == nil || err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	s.next = s.next.Add(sourceBufferDuration)
+	return data[:n], nil
+}
+
+// Name returns the name of the replayed file
+func (s *FileSource) Name() string {
+	return filepath.Base(s.path)
+}
+
+// Close closes the WAV file
+func (s *FileSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done == nil || s.stopped {
+		return nil
+	}
+	s.stopped = true
+	close(s.done)
+	return s.file.Close()
+}
@@ -0,0 +1,243 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gen2brain/malgo"
+)
+
+// malgoQueueSize is how many capture callbacks can be buffered before frames
+// are dropped, about 2.5 seconds at typical callback sizes
+const malgoQueueSize = 256
+
+// Device describes an audio capture device
+type Device struct {
+	ID        string // Identifier accepted by Config.DeviceID
+	Name      string
+	IsDefault bool
+}
+
+// ListDevices returns the capture devices available on this machine
+func ListDevices() ([]Device, error) {
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize malgo context: %w", err)
+	}
+	defer func() {
+		_ = ctx.Uninit()
+		ctx.Free()
+	}()
+
+	infos, err := ctx.Devices(malgo.Capture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capture devices: %w", err)
+	}
+
+	devices := make([]Device, len(infos))
+	for i, info := range infos {
+		devices[i] = Device{
+			ID:        info.ID.String(),
+			Name:      info.Name(),
+			IsDefault: info.IsDefault != 0,
+		}
+	}
+	return devices, nil
+}
+
+// MalgoSource captures audio from a capture device
+type MalgoSource struct {
+	deviceID string
+
+	mu      sync.Mutex
+	name    string
+	ctx     *malgo.AllocatedContext
+	device  *malgo.Device
+	frames  chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// NewMalgoSource creates a source for the capture device with the given ID,
+// as returned by ListDevices. An empty ID selects the system default.
+func NewMalgoSource(deviceID string) *MalgoSource {
+	return &MalgoSource{deviceID: deviceID}
+}
+
+// Open initializes malgo and starts the capture device
+func (s *MalgoSource) Open(format AudioFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Initialize malgo context
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize malgo context: %w", err)
+	}
+
+	// Find the requested device, or the default one for its name
+	info, err := s.findDevice(ctx)
+	if err != nil {
+		_ = ctx.Uninit()
+		ctx.Free()
+		return err
+	}
+
+	// Configure capture device
+	deviceConfig := malgo.DefaultDeviceConfig(malgo.Capture)
+	deviceConfig.Capture.Format = malgoFormat(format)
+	deviceConfig.Capture.Channels = uint32(format.Channels)
+	deviceConfig.SampleRate = uint32(format.SampleRate)
+	deviceConfig.Alsa.NoMMap = 1
+	if s.deviceID != "" {
+		// Pointer copies the ID into C memory, which miniaudio reads during
+		// InitDevice
+		deviceConfig.Capture.DeviceID = info.ID.Pointer()
+	}
+
+	frames := make(chan []byte, malgoQueueSize)
+	done := make(chan struct{})
+
+	// Data callback - called on the audio thread when audio data is available.
+	// malgo reuses the buffer, so hand the recorder a copy and never block.
+	onRecvFrames := func(pSample2, pSample []byte, framecount uint32) {
+		data := make([]byte, len(pSample))
+		copy(data, pSample)
+
+		select {
+		case frames <- data:
+		case <-done:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+
+	// Initialize the device
+	device, err := malgo.InitDevice(ctx.Context, deviceConfig, malgo.DeviceCallbacks{
+		Data: onRecvFrames,
+	})
+	if err != nil {
+		_ = ctx.Uninit()
+		ctx.Free()
+		return fmt.Errorf("failed to initialize capture device: %w", err)
+	}
+
+	// Start the device
+	if err := device.Start(); err != nil {
+		device.Uninit()
+		_ = ctx.Uninit()
+		ctx.Free()
+		return fmt.Errorf("failed to start capture device: %w", err)
+	}
+
+	s.name = "Default capture device"
+	if info != nil {
+		s.name = info.Name()
+	}
+	s.ctx = ctx
+	s.device = device
+	s.frames = frames
+	s.done = done
+	s.dropped.Store(0)
+	return nil
+}
+
+// malgoFormat returns the miniaudio sample format for a validated format.
+// miniaudio converts from whatever the device delivers natively.
+func malgoFormat(format AudioFormat) malgo.FormatType {
+	switch {
+	case format.Float:
+		return malgo.FormatF32
+	case format.BitDepth == 24:
+		return malgo.FormatS24
+	case format.BitDepth == 32:
+		return malgo.FormatS32
+	default:
+		return malgo.FormatS16
+	}
+}
+
+// findDevice looks up the configured device. It returns nil when the default
+// device was requested but the backend doesn't report one.
+func (s *MalgoSource) findDevice(ctx *malgo.AllocatedContext) (*malgo.DeviceInfo, error) {
+	infos, err := ctx.Devices(malgo.Capture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capture devices: %w", err)
+	}
+
+	for i := range infos {
+		if s.deviceID == "" && infos[i].IsDefault != 0 {
+			return &infos[i], nil
+		}
+		if s.deviceID != "" && infos[i].ID.String() == s.deviceID {
+			return &infos[i], nil
+		}
+	}
+
+	if s.deviceID != "" {
+		return nil, fmt.Errorf("capture device %q not found", s.deviceID)
+	}
+	return nil, nil
+}
+
+// Name returns the name of the opened capture device
+func (s *MalgoSource) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+// DroppedBuffers returns how many capture callbacks were lost because the
+// recorder fell behind since the device was opened
+func (s *MalgoSource) DroppedBuffers() int64 {
+	return s.dropped.Load()
+}
+
+// ReadFrames returns the next buffer delivered by the capture device
+func (s *MalgoSource) ReadFrames() ([]byte, error) {
+	s.mu.Lock()
+	frames, done := s.frames, s.done
+	s.mu.Unlock()
+
+	if frames == nil {
+		return nil, ErrSourceClosed
+	}
+
+	select {
+	case data := <-frames:
+		return data, nil
+	case <-done:
+		return nil, ErrSourceClosed
+	}
+}
+
+// Close stops the capture device and releases malgo
+func (s *MalgoSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.device == nil {
+		return nil
+	}
+
+	close(s.done)
+
+	// Stop the device
+	err := s.device.Stop()
+	s.device.Uninit()
+	_ = s.ctx.Uninit()
+	s.ctx.Free()
+
+	s.device = nil
+	s.ctx = nil
+	s.frames = nil
+	if err != nil {
+		return fmt.Errorf("failed to stop capture device: %w", err)
+	}
+	return nil
+}
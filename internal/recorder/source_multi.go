@@ -0,0 +1,180 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMultiSourceSkew is how far one device may get ahead of the slowest
+// before its oldest audio is dropped. Separate devices run on separate clocks
+// and drift apart by a few samples a second.
+const maxMultiSourceSkew = 500 * time.Millisecond
+
+// MultiSource records several sources at once, e.g. one USB microphone at
+// each end of the table, as a single source with one channel per source.
+// Each source is opened in mono.
+type MultiSource struct {
+	sources []AudioSource
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	format  AudioFormat // Of each source
+	pending [][]byte    // Audio read from each source but not yet returned
+	err     error       // First error reported by a source
+	closed  bool
+	readers sync.WaitGroup
+}
+
+// NewMultiSource combines sources into one multi-channel source
+func NewMultiSource(sources ...AudioSource) *MultiSource {
+	s := &MultiSource{sources: sources}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Open opens every source in mono. format must have one channel per source.
+func (s *MultiSource) Open(format AudioFormat) error {
+	if format.Channels != len(s.sources) {
+		return fmt.Errorf("recording %d sources needs %d channels, not %d", len(s.sources), len(s.sources), format.Channels)
+	}
+
+	mono := format
+	mono.Channels = 1
+	for i, source := range s.sources {
+		if err := source.Open(mono); err != nil {
+			for _, opened := range s.sources[:i] {
+				opened.Close()
+			}
+			return fmt.Errorf("failed to open %s: %w", source.Name(), err)
+		}
+	}
+
+	s.mu.Lock()
+	s.format = mono
+	s.pending = make([][]byte, len(s.sources))
+	s.err = nil
+	s.closed = false
+	s.mu.Unlock()
+
+	for i, source := range s.sources {
+		s.readers.Add(1)
+		go s.read(i, source)
+	}
+	return nil
+}
+
+// read collects audio from one source until it fails or is closed
+func (s *MultiSource) read(index int, source AudioSource) {
+	defer s.readers.Done()
+
+	wavFormat := s.format.wavFormat()
+	maxSkew := int(maxMultiSourceSkew.Seconds() * float64(wavFormat.ByteRate()))
+	maxSkew -= maxSkew % wavFormat.BlockAlign()
+
+	for {
+		data, err := source.ReadFrames()
+
+		s.mu.Lock()
+		if err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+			s.cond.Broadcast()
+			s.mu.Unlock()
+			return
+		}
+
+		s.pending[index] = append(s.pending[index], data...)
+		if excess := len(s.pending[index]) - maxSkew; excess > 0 {
+			s.pending[index] = s.pending[index][excess:]
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// ReadFrames waits until every source has delivered audio and returns as many
+// frames as all of them have, interleaved
+func (s *MultiSource) ReadFrames() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var available int
+	for {
+		if s.closed {
+			return nil, ErrSourceClosed
+		}
+		if s.err != nil {
+			return nil, s.err
+		}
+
+		available = -1
+		for _, pending := range s.pending {
+			if available < 0 || len(pending) < available {
+				available = len(pending)
+			}
+		}
+		if available > 0 {
+			break
+		}
+		s.cond.Wait()
+	}
+
+	size := s.format.bytesPerSample()
+	channels := len(s.pending)
+	frames := available / size
+	data := make([]byte, frames*size*channels)
+	for i := 0; i < frames; i++ {
+		for ch, pending := range s.pending {
+			copy(data[(i*channels+ch)*size:], pending[i*size:(i+1)*size])
+		}
+	}
+	for ch := range s.pending {
+		s.pending[ch] = s.pending[ch][frames*size:]
+	}
+
+	return data, nil
+}
+
+// Close closes every source and waits for their readers to finish
+func (s *MultiSource) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	var errs []error
+	for _, source := range s.sources {
+		errs = append(errs, source.Close())
+	}
+	s.readers.Wait()
+	return errors.Join(errs...)
+}
+
+// Name lists the combined sources
+func (s *MultiSource) Name() string {
+	return strings.Join(s.ChannelNames(), " + ")
+}
+
+// ChannelNames returns the name of the source behind each channel
+func (s *MultiSource) ChannelNames() []string {
+	names := make([]string, len(s.sources))
+	for i, source := range s.sources {
+		names[i] = source.Name()
+	}
+	return names
+}
+
+// DroppedBuffers adds up the buffers lost by the combined sources
+func (s *MultiSource) DroppedBuffers() int64 {
+	var dropped int64
+	for _, source := range s.sources {
+		if counter, ok := source.(DropCounter); ok {
+			dropped += counter.DroppedBuffers()
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,119 @@
+package recorder
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ToneSource generates a sine tone, or silence, in real time. It stands in
+// for a microphone on machines without one.
+type ToneSource struct {
+	frequency float64 // Hz
+	amplitude float64 // 0.0 (silence) to 1.0 (full scale)
+
+	mu      sync.Mutex
+	format  AudioFormat
+	phase   float64
+	next    time.Time
+	done    chan struct{}
+	stopped bool
+}
+
+// NewToneSource creates a source that plays a sine tone at frequency Hz with
+// the given amplitude between 0 and 1
+func NewToneSource(frequency, amplitude float64) *ToneSource {
+	return &ToneSource{
+		frequency: frequency,
+		amplitude: amplitude,
+	}
+}
+
+// NewSilenceSource creates a source that produces digital silence
+func NewSilenceSource() *ToneSource {
+	return NewToneSource(0, 0)
+}
+
+// Open resets the tone generator
+func (s *ToneSource) Open(format AudioFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.format = format
+	s.phase = 0
+	s.next = time.Now()
+	s.done = make(chan struct{})
+	s.stopped = false
+	return nil
+}
+
+// ReadFrames waits until the next buffer is due and returns it
+func (s *ToneSource) ReadFrames() ([]byte, error) {
+	s.mu.Lock()
+	if s.done == nil || s.stopped {
+		s.mu.Unlock()
+		return nil, ErrSourceClosed
+	}
+	wait := time.Until(s.next)
+	done := s.done
+	s.mu.Unlock()
+
+	// Pace the output like a real capture device
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-done:
+			return nil, ErrSourceClosed
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return nil, ErrSourceClosed
+	}
+
+	frameCount := int(float64(s.format.SampleRate) * sourceBufferDuration.Seconds())
+	size := s.format.bytesPerSample()
+	data := make([]byte, frameCount*s.format.Channels*size)
+	step := 2 * math.Pi * s.frequency / float64(s.format.SampleRate)
+
+	for i := 0; i < frameCount; i++ {
+		sample := s.amplitude * math.Sin(s.phase)
+		for ch := 0; ch < s.format.Channels; ch++ {
+			s.format.encodeSample(data[(i*s.format.Channels+ch)*size:], sample)
+		}
+		s.phase = math.Mod(s.phase+step, 2*math.Pi)
+	}
+
+	s.next = s.next.Add(sourceBufferDuration)
+	return data, nil
+}
+
+// Name describes the generated signal
+func (s *ToneSource) Name() string {
+	if s.amplitude == 0 {
+		return "Silence"
+	}
+	return fmt.Sprintf("%.0f Hz tone", s.frequency)
+}
+
+// Close stops the generator
+func (s *ToneSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil && !s.stopped {
+		s.stopped = true
+		close(s.done)
+	}
+	return nil
+}
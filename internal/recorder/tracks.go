@@ -0,0 +1,179 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// ChannelNamer is implemented by sources whose channels come from different
+// devices, such as MultiSource, to label the tracks of a multi-track
+// recording
+type ChannelNamer interface {
+	ChannelNames() []string
+}
+
+// trackEncoder writes multi-channel audio as a mono mixdown to the
+// recording's own file and each channel to a mono track file of its own
+type trackEncoder struct {
+	format AudioFormat // Of the captured audio
+	mix    Encoder
+	tracks []Encoder
+}
+
+// newTrackEncoder starts the mixdown stream in file and a track stream in each
+// of trackFiles, one per channel of format
+func newTrackEncoder(file *os.File, trackFiles []*os.File, format AudioFormat) (*trackEncoder, error) {
+	mono := format
+	mono.Channels = 1
+
+	mix, err := NewEncoder(file, mono)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]Encoder, len(trackFiles))
+	for i, trackFile := range trackFiles {
+		tracks[i], err = NewEncoder(trackFile, mono)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &trackEncoder{format: format, mix: mix, tracks: tracks}, nil
+}
+
+// Write splits interleaved PCM into the tracks and averages the channels into
+// the mixdown
+func (e *trackEncoder) Write(pcm []byte) error {
+	size := e.format.bytesPerSample()
+	channels := e.format.Channels
+	frames := len(pcm) / (size * channels)
+
+	mix := make([]byte, frames*size)
+	tracks := make([][]byte, channels)
+	for ch := range tracks {
+		tracks[ch] = make([]byte, frames*size)
+	}
+
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for ch := 0; ch < channels; ch++ {
+			sample := pcm[(i*channels+ch)*size:][:size]
+			copy(tracks[ch][i*size:], sample)
+			sum += e.format.decodeSample(sample)
+		}
+		e.format.encodeSample(mix[i*size:], sum/float64(channels))
+	}
+
+	if err := e.mix.Write(mix); err != nil {
+		return err
+	}
+	for ch, track := range e.tracks {
+		if err := track.Write(tracks[ch]); err != nil {
+			return fmt.Errorf("failed to write track %d: %w", ch+1, err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint checkpoints the mixdown and every track
+func (e *trackEncoder) Checkpoint() error {
+	errs := []error{e.mix.Checkpoint()}
+	for _, track := range e.tracks {
+		errs = append(errs, track.Checkpoint())
+	}
+	return errors.Join(errs...)
+}
+
+// Close finishes the mixdown and every track
+func (e *trackEncoder) Close() error {
+	errs := []error{e.mix.Close()}
+	for _, track := range e.tracks {
+		errs = append(errs, track.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// trackPath returns the file path of the track for the given channel
+func (r *Recorder) trackPath(channel int) string {
+	return filepath.Join(r.dataDir, fmt.Sprintf("%s_track%d%s", r.baseName, channel+1, r.format.Codec.Extension()))
+}
+
+// startTracks creates a track file and row for every channel and returns an
+// encoder that writes them alongside the mixdown in file. Callers must hold
+// r.mu.
+func (r *Recorder) startTracks(file *os.File) (Encoder, error) {
+	var labels []string
+	if namer, ok := r.source.(ChannelNamer); ok {
+		labels = namer.ChannelNames()
+	}
+
+	files := make([]*os.File, 0, r.format.Channels)
+	ids := make([]int64, 0, r.format.Channels)
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	for ch := 0; ch < r.format.Channels; ch++ {
+		path := r.trackPath(ch)
+		trackFile, err := os.Create(path)
+		if err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("failed to create track file: %w", err)
+		}
+		files = append(files, trackFile)
+
+		params := models.CreateRecordingTrackParams{
+			RecordingID: r.currentID,
+			Index:       ch,
+			FilePath:    path,
+		}
+		if ch < len(labels) {
+			params.Label = &labels[ch]
+		}
+		track, err := r.db.CreateTrack(params)
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
+		ids = append(ids, track.ID)
+	}
+
+	encoder, err := newTrackEncoder(file, files, r.format)
+	if err != nil {
+		closeFiles()
+		return nil, err
+	}
+
+	r.trackFiles = files
+	r.trackIDs = ids
+	return encoder, nil
+}
+
+// finishTracks closes the track files, which the encoder has finalized, and
+// saves their sizes. Callers must hold r.mu.
+func (r *Recorder) finishTracks() error {
+	var errs []error
+	for i, trackFile := range r.trackFiles {
+		fileInfo, err := trackFile.Stat()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get track file info: %w", err))
+		}
+		if err := trackFile.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close track file: %w", err))
+		}
+		if fileInfo != nil {
+			errs = append(errs, r.db.UpdateTrackSize(r.trackIDs[i], fileInfo.Size()))
+		}
+	}
+
+	r.trackFiles = nil
+	r.trackIDs = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,180 @@
+package recorder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/maxheckel/maxs-marvelous-manuscript/pkg/models"
+)
+
+// VADMode selects what voice activity detection does with long silences
+type VADMode int
+
+const (
+	// VADOff records everything and detects nothing
+	VADOff VADMode = iota
+	// VADMarkSilence records everything and saves each long silence to the
+	// database
+	VADMarkSilence
+	// VADAutoPause stops writing once the input has been silent for
+	// MinSilence and resumes as soon as someone speaks. The skipped spans are
+	// saved to the database.
+	VADAutoPause
+)
+
+// DefaultVADMinSilence is how long the input must stay silent before voice
+// activity detection acts on it
+const DefaultVADMinSilence = 30 * time.Second
+
+func (m VADMode) String() string {
+	switch m {
+	case VADOff:
+		return "off"
+	case VADMarkSilence:
+		return "mark"
+	case VADAutoPause:
+		return "pause"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseVADMode parses the names returned by VADMode.String
+func ParseVADMode(s string) (VADMode, error) {
+	switch s {
+	case "", "off":
+		return VADOff, nil
+	case "mark":
+		return VADMarkSilence, nil
+	case "pause":
+		return VADAutoPause, nil
+	default:
+		return VADOff, fmt.Errorf("unknown VAD mode %q (want off, mark or pause)", s)
+	}
+}
+
+// VADConfig configures energy-based voice activity detection
+type VADConfig struct {
+	Mode VADMode
+
+	// Threshold is the RMS level in dBFS below which a buffer counts as
+	// silent. Zero uses SilenceThreshold.
+	Threshold float64
+
+	// MinSilence is how long a silence must last to be marked or trimmed.
+	// Shorter pauses in conversation are left alone. Zero uses
+	// DefaultVADMinSilence.
+	MinSilence time.Duration
+}
+
+// silenceSpan tracks the silence currently in progress
+type silenceSpan struct {
+	offset    time.Duration // Audio offset at which the silence began
+	startedAt time.Time     // Wall-clock time the silence began
+	length    time.Duration // Audio length of the silence so far
+
+	// Set once auto-pause kicks in: where the file was cut, when, and how
+	// much audio has been left out since
+	cutOffset time.Duration
+	cutAt     time.Time
+	trimmed   time.Duration
+}
+
+// detectVoice runs voice activity detection on a buffer whose level has just
+// been metered and reports whether it should be written. Callers must hold
+// r.mu.
+func (r *Recorder) detectVoice(data []byte, now time.Time) bool {
+	if r.vad.Mode == VADOff {
+		return true
+	}
+
+	if r.meter.rms >= r.vad.Threshold {
+		r.endSilence()
+		return true
+	}
+
+	if r.silence == nil {
+		r.silence = &silenceSpan{
+			offset:    r.audioOffset(),
+			startedAt: now,
+		}
+	}
+	r.silence.length += r.format.wavFormat().Duration(int64(len(data)))
+
+	if r.vad.Mode != VADAutoPause || r.silence.length <= r.vad.MinSilence {
+		return true
+	}
+
+	if r.silence.trimmed == 0 {
+		r.silence.cutOffset = r.audioOffset()
+		r.silence.cutAt = now
+	}
+	r.silence.trimmed += r.format.wavFormat().Duration(int64(len(data)))
+	return false
+}
+
+// endSilence closes the silence in progress, if any, and saves it when it
+// was long enough to matter. Callers must hold r.mu.
+func (r *Recorder) endSilence() {
+	span := r.silence
+	if span == nil {
+		return
+	}
+	r.silence = nil
+
+	var params models.CreateRecordingSilenceParams
+	switch {
+	case span.trimmed > 0:
+		r.skippedTotal += span.trimmed
+		params = models.CreateRecordingSilenceParams{
+			RecordingID:     r.currentID,
+			OffsetSeconds:   span.cutOffset.Seconds(),
+			StartedAt:       span.cutAt,
+			DurationSeconds: span.trimmed.Seconds(),
+			Trimmed:         true,
+		}
+	case r.vad.Mode == VADMarkSilence && span.length >= r.vad.MinSilence:
+		params = models.CreateRecordingSilenceParams{
+			RecordingID:     r.currentID,
+			OffsetSeconds:   span.offset.Seconds(),
+			StartedAt:       span.startedAt,
+			DurationSeconds: span.length.Seconds(),
+		}
+	default:
+		return
+	}
+
+	if _, err := r.db.CreateSilence(params); err != nil {
+		fmt.Printf("Failed to save silence: %v\n", err)
+	}
+}
+
+// audioOffset returns how much audio has been written to the recording so
+// far. Callers must hold r.mu.
+func (r *Recorder) audioOffset() time.Duration {
+	return r.segmentStart + r.format.wavFormat().Duration(r.segmentBytes)
+}
+
+// WallClockOffset maps an offset in a recording's audio, such as a transcript
+// timestamp, to how long after the recording started that audio was
+// captured, by adding back the trimmed silences before it. Manual pauses
+// are not included.
+func WallClockOffset(silences []*models.RecordingSilence, audioOffset time.Duration) time.Duration {
+	wall := audioOffset
+	for _, silence := range silences {
+		if !silence.Trimmed || silence.OffsetSeconds > audioOffset.Seconds() {
+			continue
+		}
+		wall += time.Duration(silence.DurationSeconds * float64(time.Second))
+	}
+	return wall
+}
+
+// IsSkippingSilence reports whether auto-pause is currently leaving silence
+// out of the recording
+func (r *Recorder) IsSkippingSilence() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.state == StateRecording && r.silence != nil && r.silence.trimmed > 0
+}
@@ -0,0 +1,72 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// ValidateSamples checks that the samples are ones this package can decode
+// and encode: 16-, 24- or 32-bit integers, or 32-bit floats
+func (f Format) ValidateSamples() error {
+	if f.Float {
+		if f.BitDepth != 32 {
+			return fmt.Errorf("unsupported samples: %d-bit float (want 32-bit)", f.BitDepth)
+		}
+		return nil
+	}
+	if f.BitDepth != 16 && f.BitDepth != 24 && f.BitDepth != 32 {
+		return fmt.Errorf("unsupported samples: %d-bit integer (want 16, 24 or 32)", f.BitDepth)
+	}
+	return nil
+}
+
+// Sample reads the little-endian sample at the start of data and returns it
+// as a fraction of full scale, from -1 to just under 1 for integer samples
+func (f Format) Sample(data []byte) float64 {
+	if f.Float {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+	}
+	return float64(SampleInt(data, f.BitDepth)) / float64(int64(1)<<(f.BitDepth-1))
+}
+
+// PutSample writes value, a fraction of full scale, as a little-endian
+// sample at the start of data. Integer samples are clamped to full scale.
+func (f Format) PutSample(data []byte, value float64) {
+	if f.Float {
+		binary.LittleEndian.PutUint32(data, math.Float32bits(float32(value)))
+		return
+	}
+
+	scale := float64(int64(1) << (f.BitDepth - 1))
+	PutSampleInt(data, int32(math.Max(math.Min(value*scale, scale-1), -scale)), f.BitDepth)
+}
+
+// SampleInt reads the little-endian 16-, 24- or 32-bit integer sample at
+// the start of data
+func SampleInt(data []byte, bitDepth int) int32 {
+	switch bitDepth {
+	case 24:
+		// Sign-extend the packed 3-byte sample
+		return int32(uint32(data[0])<<8|uint32(data[1])<<16|uint32(data[2])<<24) >> 8
+	case 32:
+		return int32(binary.LittleEndian.Uint32(data))
+	default:
+		return int32(int16(binary.LittleEndian.Uint16(data)))
+	}
+}
+
+// PutSampleInt writes a 16-, 24- or 32-bit integer sample at the start of
+// data
+func PutSampleInt(data []byte, sample int32, bitDepth int) {
+	switch bitDepth {
+	case 24:
+		data[0] = byte(sample)
+		data[1] = byte(sample >> 8)
+		data[2] = byte(sample >> 16)
+	case 32:
+		binary.LittleEndian.PutUint32(data, uint32(sample))
+	default:
+		binary.LittleEndian.PutUint16(data, uint16(sample))
+	}
+}
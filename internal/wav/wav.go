@@ -0,0 +1,322 @@
+// Package wav reads and writes the RIFF/WAVE headers used for recordings.
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// MaxRIFFSize is the largest RIFF size a plain WAV header can hold. Larger
+// files are written as RF64.
+const MaxRIFFSize = math.MaxUint32
+
+// ds64Size is the size of the body of a ds64 chunk without a table
+const ds64Size = 28
+
+// Format tags stored in the fmt chunk
+const (
+	formatPCM        = 0x0001
+	formatIEEEFloat  = 0x0003
+	formatExtensible = 0xFFFE
+)
+
+// fmt chunk body sizes for plain PCM and WAVE_FORMAT_EXTENSIBLE
+const (
+	fmtSize           = 16
+	fmtExtensibleSize = 40
+)
+
+// subFormatGUID is the tail shared by the KSDATAFORMAT_SUBTYPE GUIDs; the
+// first two bytes hold the format tag
+var subFormatGUID = []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// ErrNotWAV is returned when a file does not start with a RIFF/WAVE header
+var ErrNotWAV = errors.New("not a WAV file")
+
+// Format describes the sample layout of a WAV file
+type Format struct {
+	SampleRate int
+	Channels   int
+	BitDepth   int
+	Float      bool // IEEE float samples rather than signed integers
+}
+
+// HeaderSize returns the size of the header Header writes for f: the RIFF
+// header, a JUNK chunk reserving room for an RF64 ds64 chunk, the fmt chunk
+// and the data chunk header
+func (f Format) HeaderSize() int64 {
+	if f.extensible() {
+		return 12 + 8 + ds64Size + 8 + fmtExtensibleSize + 8
+	}
+	return 12 + 8 + ds64Size + 8 + fmtSize + 8
+}
+
+// extensible reports whether f needs a WAVE_FORMAT_EXTENSIBLE fmt chunk,
+// which is the case for anything but 8- or 16-bit integer mono or stereo
+func (f Format) extensible() bool {
+	return f.Float || f.BitDepth > 16 || f.Channels > 2
+}
+
+// channelMask returns the speaker positions for an extensible header
+func (f Format) channelMask() uint32 {
+	switch f.Channels {
+	case 1:
+		return 0x4 // Front center
+	case 2:
+		return 0x3 // Front left and right
+	default:
+		return 0 // Unassigned
+	}
+}
+
+// BlockAlign returns the number of bytes in one frame (one sample per channel)
+func (f Format) BlockAlign() int {
+	return f.Channels * f.BitDepth / 8
+}
+
+// ByteRate returns the number of bytes per second of audio
+func (f Format) ByteRate() int {
+	return f.SampleRate * f.BlockAlign()
+}
+
+// Duration returns how long dataSize bytes of audio play for
+func (f Format) Duration(dataSize int64) time.Duration {
+	byteRate := int64(f.ByteRate())
+	if byteRate == 0 {
+		return 0
+	}
+	return time.Duration(dataSize) * time.Second / time.Duration(byteRate)
+}
+
+// Info describes a parsed WAV header
+type Info struct {
+	Format     Format
+	DataOffset int64 // Offset of the first audio byte
+	DataSize   int64 // Size of the data chunk as declared in the header
+}
+
+// WriteHeader writes the header for f at the start of w
+func WriteHeader(w io.WriterAt, f Format, dataSize int64) error {
+	_, err := w.WriteAt(Header(f, dataSize), 0)
+	return err
+}
+
+// Header returns the f.HeaderSize()-byte header for dataSize bytes of audio.
+// Up to 4 GiB it's a plain WAV header whose JUNK chunk reserves room for a
+// ds64 chunk; beyond that the same layout is written as RF64 (EBU Tech 3306)
+// with the real sizes in the ds64 chunk. Either way the audio starts at
+// f.HeaderSize(), so a growing file can switch over without moving any audio.
+// Float, 24/32-bit and multichannel formats use a WAVE_FORMAT_EXTENSIBLE fmt
+// chunk.
+func Header(f Format, dataSize int64) []byte {
+	headerSize := f.HeaderSize()
+	header := make([]byte, headerSize)
+	riffSize := dataSize + headerSize - 8
+	rf64 := riffSize > MaxRIFFSize
+
+	// RIFF chunk
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(riffSize))
+	copy(header[8:12], "WAVE")
+
+	// JUNK chunk, or ds64 chunk holding the 64-bit sizes
+	copy(header[12:16], "JUNK")
+	binary.LittleEndian.PutUint32(header[16:20], ds64Size)
+	if rf64 {
+		copy(header[0:4], "RF64")
+		binary.LittleEndian.PutUint32(header[4:8], math.MaxUint32)
+		copy(header[12:16], "ds64")
+		binary.LittleEndian.PutUint64(header[20:28], uint64(riffSize))
+		binary.LittleEndian.PutUint64(header[28:36], uint64(dataSize))
+		if blockAlign := int64(f.BlockAlign()); blockAlign > 0 {
+			binary.LittleEndian.PutUint64(header[36:44], uint64(dataSize/blockAlign)) // sample count
+		}
+		// header[44:48] is the table length, always 0
+	}
+
+	// fmt chunk
+	tag := uint16(formatPCM)
+	if f.Float {
+		tag = formatIEEEFloat
+	}
+	size := fmtSize
+	if f.extensible() {
+		size = fmtExtensibleSize
+	}
+	copy(header[48:52], "fmt ")
+	binary.LittleEndian.PutUint32(header[52:56], uint32(size))
+	binary.LittleEndian.PutUint16(header[56:58], tag)
+	binary.LittleEndian.PutUint16(header[58:60], uint16(f.Channels))
+	binary.LittleEndian.PutUint32(header[60:64], uint32(f.SampleRate))
+	binary.LittleEndian.PutUint32(header[64:68], uint32(f.ByteRate()))
+	binary.LittleEndian.PutUint16(header[68:70], uint16(f.BlockAlign()))
+	binary.LittleEndian.PutUint16(header[70:72], uint16(f.BitDepth))
+	if f.extensible() {
+		binary.LittleEndian.PutUint16(header[56:58], formatExtensible)
+		binary.LittleEndian.PutUint16(header[72:74], fmtExtensibleSize-18) // cbSize
+		binary.LittleEndian.PutUint16(header[74:76], uint16(f.BitDepth))   // valid bits per sample
+		binary.LittleEndian.PutUint32(header[76:80], f.channelMask())
+		binary.LittleEndian.PutUint16(header[80:82], tag)
+		copy(header[82:96], subFormatGUID)
+	}
+
+	// data chunk
+	data := 56 + size
+	copy(header[data:data+4], "data")
+	if rf64 {
+		binary.LittleEndian.PutUint32(header[data+4:data+8], math.MaxUint32)
+	} else {
+		binary.LittleEndian.PutUint32(header[data+4:data+8], uint32(dataSize))
+	}
+
+	return header
+}
+
+// ReadInfo walks the chunks of a WAV or RF64 file until it finds the data
+// chunk
+func ReadInfo(r io.ReaderAt) (*Info, error) {
+	riff := make([]byte, 12)
+	if _, err := r.ReadAt(riff, 0); err != nil {
+		return nil, fmt.Errorf("failed to read RIFF header: %w", err)
+	}
+	if (string(riff[0:4]) != "RIFF" && string(riff[0:4]) != "RF64") || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+	rf64 := string(riff[0:4]) == "RF64"
+
+	var info Info
+	var ds64DataSize int64 = -1
+	haveFormat := false
+	offset := int64(12)
+	chunk := make([]byte, 8)
+
+	for {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return nil, fmt.Errorf("failed to read chunk header: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		offset += 8
+
+		switch id {
+		case "ds64":
+			body := make([]byte, 16)
+			if _, err := r.ReadAt(body, offset); err != nil {
+				return nil, fmt.Errorf("failed to read ds64 chunk: %w", err)
+			}
+			ds64DataSize = int64(binary.LittleEndian.Uint64(body[8:16]))
+		case "fmt ":
+			body := make([]byte, min(max(size, fmtSize), fmtExtensibleSize))
+			if _, err := r.ReadAt(body, offset); err != nil {
+				return nil, fmt.Errorf("failed to read fmt chunk: %w", err)
+			}
+			tag := binary.LittleEndian.Uint16(body[0:2])
+			if tag == formatExtensible && len(body) == fmtExtensibleSize {
+				tag = binary.LittleEndian.Uint16(body[24:26])
+			}
+			info.Format = Format{
+				Channels:   int(binary.LittleEndian.Uint16(body[2:4])),
+				SampleRate: int(binary.LittleEndian.Uint32(body[4:8])),
+				BitDepth:   int(binary.LittleEndian.Uint16(body[14:16])),
+				Float:      tag == formatIEEEFloat,
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return nil, fmt.Errorf("data chunk before fmt chunk")
+			}
+			info.DataOffset = offset
+			info.DataSize = size
+			if rf64 && size == math.MaxUint32 {
+				if ds64DataSize < 0 {
+					return nil, fmt.Errorf("RF64 file without a ds64 chunk")
+				}
+				info.DataSize = ds64DataSize
+			}
+			return &info, nil
+		}
+
+		// Chunks are padded to an even number of bytes
+		offset += size + size%2
+	}
+}
+
+// Repair rewrites the RIFF and data sizes of the WAV file at path so they
+// match the bytes actually on disk, switching to RF64 if the file has grown
+// past 4 GiB. A file without a readable header gets a fresh one in the
+// fallback format. It returns the corrected header.
+func Repair(path string, fallback Format) (*Info, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	fileSize := fileInfo.Size()
+
+	info, err := ReadInfo(file)
+	if err != nil {
+		// Power was lost before the header made it to disk, or audio was
+		// written over it. Recordings always use the Header layout.
+		info = &Info{Format: fallback, DataOffset: fallback.HeaderSize()}
+		if fileSize < info.DataOffset {
+			if err := file.Truncate(info.DataOffset); err != nil {
+				return nil, fmt.Errorf("failed to extend file: %w", err)
+			}
+			fileSize = info.DataOffset
+		}
+		if err := WriteHeader(file, fallback, 0); err != nil {
+			return nil, fmt.Errorf("failed to write WAV header: %w", err)
+		}
+	}
+
+	// Ignore a partially written trailing frame
+	dataSize := fileSize - info.DataOffset
+	if blockAlign := int64(info.Format.BlockAlign()); blockAlign > 0 {
+		dataSize -= dataSize % blockAlign
+	}
+	info.DataSize = dataSize
+
+	if err := writeSizes(file, info); err != nil {
+		return nil, err
+	}
+
+	return info, file.Sync()
+}
+
+// writeSizes updates the size fields of a header read by ReadInfo. Files in
+// the Header layout get a whole new header, so they can become RF64; older
+// 44-byte headers have no room for a ds64 chunk and are patched in place,
+// saturating at 4 GiB.
+func writeSizes(file *os.File, info *Info) error {
+	reserved := make([]byte, 4)
+	if _, err := file.ReadAt(reserved, 12); err != nil {
+		return fmt.Errorf("failed to read WAV header: %w", err)
+	}
+	if info.DataOffset == info.Format.HeaderSize() && (string(reserved) == "JUNK" || string(reserved) == "ds64") {
+		if err := WriteHeader(file, info.Format, info.DataSize); err != nil {
+			return fmt.Errorf("failed to write WAV header: %w", err)
+		}
+		return nil
+	}
+
+	sizes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sizes, uint32(min(info.DataOffset+info.DataSize-8, MaxRIFFSize)))
+	if _, err := file.WriteAt(sizes, 4); err != nil {
+		return fmt.Errorf("failed to write RIFF size: %w", err)
+	}
+	binary.LittleEndian.PutUint32(sizes, uint32(min(info.DataSize, MaxRIFFSize)))
+	if _, err := file.WriteAt(sizes, info.DataOffset-4); err != nil {
+		return fmt.Errorf("failed to write data size: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	cd   = Format{SampleRate: 44100, Channels: 2, BitDepth: 16}
+	hiFi = Format{SampleRate: 48000, Channels: 2, BitDepth: 24}
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	formats := []struct {
+		format     Format
+		headerSize int64
+		tag        uint16
+	}{
+		{cd, 80, formatPCM},
+		{hiFi, 104, formatExtensible},
+		{Format{SampleRate: 48000, Channels: 1, BitDepth: 32, Float: true}, 104, formatExtensible},
+	}
+
+	for _, tt := range formats {
+		headerSize := tt.format.HeaderSize()
+		if headerSize != tt.headerSize {
+			t.Errorf("%+v: header size = %d, want %d", tt.format, headerSize, tt.headerSize)
+		}
+
+		for _, dataSize := range []int64{0, 6000, MaxRIFFSize - headerSize + 8, 5 << 30} {
+			header := Header(tt.format, dataSize)
+			if int64(len(header)) != headerSize {
+				t.Fatalf("%+v: header is %d bytes, want %d", tt.format, len(header), headerSize)
+			}
+			if tag := binary.LittleEndian.Uint16(header[56:58]); tag != tt.tag {
+				t.Errorf("%+v: format tag = %#x, want %#x", tt.format, tag, tt.tag)
+			}
+
+			wantRF64 := dataSize+headerSize-8 > MaxRIFFSize
+			if got := string(header[0:4]) == "RF64"; got != wantRF64 {
+				t.Errorf("%+v, data size %d: RF64 = %v, want %v", tt.format, dataSize, got, wantRF64)
+			}
+
+			info, err := ReadInfo(bytes.NewReader(header))
+			if err != nil {
+				t.Fatalf("%+v, data size %d: ReadInfo: %v", tt.format, dataSize, err)
+			}
+			if info.Format != tt.format || info.DataOffset != headerSize || info.DataSize != dataSize {
+				t.Errorf("%+v, data size %d: read back %+v", tt.format, dataSize, info)
+			}
+		}
+	}
+}
+
+func TestRepairSwitchesToRF64(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "long.wav")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A recording checkpointed at 1 KiB that then grew past 4 GiB before a
+	// crash. Truncate makes a sparse file, so this takes no real disk space.
+	if err := WriteHeader(file, hiFi, 1024); err != nil {
+		t.Fatal(err)
+	}
+	const dataSize = 6 * 900_000_000 // Whole 24-bit stereo frames
+	if err := file.Truncate(hiFi.HeaderSize() + dataSize + 2); err != nil {
+		t.Skipf("can't create a sparse 5 GiB file here: %v", err)
+	}
+	file.Close()
+
+	info, err := Repair(path, hiFi)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if info.DataSize != dataSize {
+		t.Errorf("repaired data size = %d, want %d", info.DataSize, dataSize)
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	file.ReadAt(magic, 0)
+	if string(magic) != "RF64" {
+		t.Errorf("repaired file starts with %q, want RF64", magic)
+	}
+	reread, err := ReadInfo(file)
+	if err != nil {
+		t.Fatalf("ReadInfo: %v", err)
+	}
+	if reread.DataSize != dataSize {
+		t.Errorf("re-read data size = %d, want %d", reread.DataSize, dataSize)
+	}
+}
+
+func TestRepairLegacyHeader(t *testing.T) {
+	// Recordings made before RF64 support have a 44-byte header with no
+	// room for a ds64 chunk; their sizes are patched in place
+	legacy := make([]byte, 44)
+	copy(legacy[0:4], "RIFF")
+	copy(legacy[8:12], "WAVE")
+	copy(legacy[12:16], "fmt ")
+	legacy[16] = 16
+	copy(legacy[20:36], Header(cd, 0)[56:72])
+	copy(legacy[36:40], "data")
+
+	path := filepath.Join(t.TempDir(), "legacy.wav")
+	if err := os.WriteFile(path, append(legacy, make([]byte, 600)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Repair(path, cd)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if info.DataOffset != 44 || info.DataSize != 600 {
+		t.Errorf("repaired %+v, want 600 bytes of data at 44", info)
+	}
+}
+
+func TestSampleRoundTrip(t *testing.T) {
+	for _, format := range []Format{
+		{BitDepth: 16},
+		{BitDepth: 24},
+		{BitDepth: 32},
+		{BitDepth: 32, Float: true},
+	} {
+		data := make([]byte, format.BitDepth/8)
+		for _, value := range []float64{0, 0.5, -0.25, -1} {
+			format.PutSample(data, value)
+			if got := format.Sample(data); math.Abs(got-value) > 1e-4 {
+				t.Errorf("%+v: %v decoded as %v", format, value, got)
+			}
+		}
+
+		// Integer samples are clamped to full scale
+		format.PutSample(data, 2)
+		if got := format.Sample(data); !format.Float && (got < 0.999 || got > 1) {
+			t.Errorf("%+v: 2 decoded as %v, want full scale", format, got)
+		}
+	}
+
+	if err := (Format{BitDepth: 8}).ValidateSamples(); err == nil {
+		t.Error("8-bit samples are accepted")
+	}
+}
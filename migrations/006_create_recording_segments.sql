@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS recording_segments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recording_id INTEGER NOT NULL,
+    segment_index INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    start_offset_seconds REAL NOT NULL DEFAULT 0,
+    duration_seconds REAL NOT NULL DEFAULT 0,
+    file_size_bytes INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (recording_id, segment_index),
+    FOREIGN KEY (recording_id) REFERENCES recordings(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recording_segments_recording_id ON recording_segments(recording_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_recording_segments_recording_id;
+DROP TABLE IF EXISTS recording_segments;
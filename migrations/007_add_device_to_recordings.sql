@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE recordings ADD COLUMN device_name TEXT;
+
+-- +migrate Down
+ALTER TABLE recordings DROP COLUMN device_name;
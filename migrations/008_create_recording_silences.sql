@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS recording_silences (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recording_id INTEGER NOT NULL,
+    offset_seconds REAL NOT NULL,          -- Position in the recorded audio where the silence falls
+    started_at TIMESTAMP NOT NULL,         -- Wall-clock time the silence began
+    duration_seconds REAL NOT NULL,
+    trimmed BOOLEAN NOT NULL DEFAULT 0,    -- 1 if the silence was left out of the audio file
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (recording_id) REFERENCES recordings(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recording_silences_recording_id ON recording_silences(recording_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_recording_silences_recording_id;
+DROP TABLE IF EXISTS recording_silences;
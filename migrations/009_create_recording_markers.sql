@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS recording_markers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recording_id INTEGER NOT NULL,
+    offset_seconds REAL NOT NULL,
+    label TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (recording_id) REFERENCES recordings(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recording_markers_recording_id ON recording_markers(recording_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_recording_markers_recording_id;
+DROP TABLE IF EXISTS recording_markers;
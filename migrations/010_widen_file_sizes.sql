@@ -0,0 +1,23 @@
+-- +migrate Up
+-- INTEGER columns are generated as int32, which overflows for recordings
+-- over 2 GiB. SQLite can't change a column's type, so swap in a BIGINT copy.
+ALTER TABLE recordings ADD COLUMN file_size_bytes_wide BIGINT DEFAULT 0;
+UPDATE recordings SET file_size_bytes_wide = file_size_bytes;
+ALTER TABLE recordings DROP COLUMN file_size_bytes;
+ALTER TABLE recordings RENAME COLUMN file_size_bytes_wide TO file_size_bytes;
+
+ALTER TABLE recording_segments ADD COLUMN file_size_bytes_wide BIGINT NOT NULL DEFAULT 0;
+UPDATE recording_segments SET file_size_bytes_wide = file_size_bytes;
+ALTER TABLE recording_segments DROP COLUMN file_size_bytes;
+ALTER TABLE recording_segments RENAME COLUMN file_size_bytes_wide TO file_size_bytes;
+
+-- +migrate Down
+ALTER TABLE recording_segments ADD COLUMN file_size_bytes_narrow INTEGER NOT NULL DEFAULT 0;
+UPDATE recording_segments SET file_size_bytes_narrow = file_size_bytes;
+ALTER TABLE recording_segments DROP COLUMN file_size_bytes;
+ALTER TABLE recording_segments RENAME COLUMN file_size_bytes_narrow TO file_size_bytes;
+
+ALTER TABLE recordings ADD COLUMN file_size_bytes_narrow INTEGER DEFAULT 0;
+UPDATE recordings SET file_size_bytes_narrow = file_size_bytes;
+ALTER TABLE recordings DROP COLUMN file_size_bytes;
+ALTER TABLE recordings RENAME COLUMN file_size_bytes_narrow TO file_size_bytes;
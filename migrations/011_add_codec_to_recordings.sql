@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE recordings ADD COLUMN codec TEXT NOT NULL DEFAULT 'wav';
+
+-- +migrate Down
+ALTER TABLE recordings DROP COLUMN codec;
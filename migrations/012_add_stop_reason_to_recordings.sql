@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE recordings ADD COLUMN stop_reason TEXT;
+
+-- +migrate Down
+ALTER TABLE recordings DROP COLUMN stop_reason;
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS recording_tracks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recording_id INTEGER NOT NULL,
+    track_index INTEGER NOT NULL,
+    label TEXT,
+    file_path TEXT NOT NULL,
+    file_size_bytes BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (recording_id, track_index),
+    FOREIGN KEY (recording_id) REFERENCES recordings(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recording_tracks_recording_id ON recording_tracks(recording_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_recording_tracks_recording_id;
+DROP TABLE IF EXISTS recording_tracks;
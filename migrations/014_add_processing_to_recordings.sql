@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE recordings ADD COLUMN processing TEXT;
+
+-- +migrate Down
+ALTER TABLE recordings DROP COLUMN processing;
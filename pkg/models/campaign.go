@@ -31,3 +31,27 @@ type CampaignWithSessions struct {
 	Campaign
 	Sessions []Session `json:"sessions"`
 }
+
+// CampaignSchedule is the weekly game time of a campaign. At that time the
+// web server's recorder creates the next session and records it.
+type CampaignSchedule struct {
+	ID                    int64        `json:"id"`
+	CampaignID            int64        `json:"campaign_id"`
+	Weekday               time.Weekday `json:"weekday"`                 // 0 is Sunday
+	StartTime             string       `json:"start_time"`              // HH:MM in the server's time zone
+	MaxDurationSeconds    int          `json:"max_duration_seconds"`    // Stop after this long; 0 uses the default
+	SilenceTimeoutSeconds int          `json:"silence_timeout_seconds"` // Stop after this much silence; 0 uses the default
+	Enabled               bool         `json:"enabled"`
+	LastRunAt             *time.Time   `json:"last_run_at,omitempty"`
+	CreatedAt             time.Time    `json:"created_at"`
+	UpdatedAt             time.Time    `json:"updated_at"`
+}
+
+type SetCampaignScheduleParams struct {
+	CampaignID            int64
+	Weekday               time.Weekday
+	StartTime             string
+	MaxDurationSeconds    int
+	SilenceTimeoutSeconds int
+	Enabled               bool
+}
@@ -2,26 +2,67 @@ package models
 
 import "time"
 
+// Recording statuses
+const (
+	RecordingStatusRecording = "recording"
+	RecordingStatusCompleted = "completed"
+	RecordingStatusFailed    = "failed"
+)
+
+// Reasons a recording was stopped
+const (
+	StopReasonUser    = "user"     // Stopped from the UI, a signal or the API
+	StopReasonLowDisk = "low_disk" // Stopped before the disk filled up
+
+	StopReasonMaxDuration = "max_duration" // A scheduled recording ran for its maximum duration
+	StopReasonSilence     = "silence"      // A scheduled recording heard nothing for too long
+)
+
+// Transcription statuses
+const (
+	TranscriptionStatusPending    = "pending"
+	TranscriptionStatusProcessing = "processing"
+	TranscriptionStatusCompleted  = "completed"
+	TranscriptionStatusFailed     = "failed"
+)
+
 type Recording struct {
-	ID                   int64      `json:"id"`
-	SessionID            *int64     `json:"session_id,omitempty"`
-	FileID               string     `json:"file_id"`
-	Filename             string     `json:"filename"`
-	FilePath             string     `json:"file_path"`
-	DurationSeconds      int        `json:"duration_seconds"`
-	FileSizeBytes        int64      `json:"file_size_bytes"`
-	Status               string     `json:"status"` // recording, completed, failed
-	CreatedAt            time.Time  `json:"created_at"`
-	CompletedAt          *time.Time `json:"completed_at,omitempty"`
-	TranscriptionStatus  string     `json:"transcription_status"` // pending, processing, completed, failed
-	Notes                *string    `json:"notes,omitempty"`
+	ID                  int64            `json:"id"`
+	SessionID           *int64           `json:"session_id,omitempty"`
+	FileID              string           `json:"file_id"`
+	Filename            string           `json:"filename"`
+	FilePath            string           `json:"file_path"`
+	DurationSeconds     int              `json:"duration_seconds"`
+	FileSizeBytes       int64            `json:"file_size_bytes"`
+	Status              string           `json:"status"` // recording, completed, failed
+	CreatedAt           time.Time        `json:"created_at"`
+	CompletedAt         *time.Time       `json:"completed_at,omitempty"`
+	TranscriptionStatus string           `json:"transcription_status"` // pending, processing, completed, failed
+	Notes               *string          `json:"notes,omitempty"`
+	DeviceName          *string          `json:"device_name,omitempty"` // Capture device the audio came from
+	Codec               string           `json:"codec"`                 // wav or flac
+	StopReason          *string          `json:"stop_reason,omitempty"` // user, low_disk, max_duration or silence
+	Processing          *AudioProcessing `json:"processing,omitempty"`  // Nil if the audio was recorded as captured
+}
+
+// AudioProcessing is the gain, automatic gain control and noise gate applied
+// to a recording's audio while it was captured
+type AudioProcessing struct {
+	GainDB       float64 `json:"gain_db,omitempty"`
+	AGC          bool    `json:"agc,omitempty"`
+	AGCTargetDB  float64 `json:"agc_target_db,omitempty"`
+	AGCMaxGainDB float64 `json:"agc_max_gain_db,omitempty"`
+	NoiseGateDB  float64 `json:"noise_gate_db,omitempty"`
 }
 
 type CreateRecordingParams struct {
-	SessionID *int64
-	FileID    string
-	Filename  string
-	FilePath  string
+	SessionID  *int64
+	FileID     string
+	Filename   string
+	FilePath   string
+	DeviceName *string
+	Codec      string // Defaults to wav
+	Processing *AudioProcessing
 }
 
 type UpdateRecordingParams struct {
@@ -32,4 +73,114 @@ type UpdateRecordingParams struct {
 	CompletedAt         *time.Time
 	TranscriptionStatus *string
 	Notes               *string
+	StopReason          *string
+}
+
+// RecordingSegment is one chunk file of a recording that rolls over to a new
+// file every few minutes
+type RecordingSegment struct {
+	ID                 int64     `json:"id"`
+	RecordingID        int64     `json:"recording_id"`
+	Index              int       `json:"index"`
+	FilePath           string    `json:"file_path"`
+	StartOffsetSeconds float64   `json:"start_offset_seconds"`
+	DurationSeconds    float64   `json:"duration_seconds"`
+	FileSizeBytes      int64     `json:"file_size_bytes"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+type CreateRecordingSegmentParams struct {
+	RecordingID        int64
+	Index              int
+	FilePath           string
+	StartOffsetSeconds float64
+}
+
+// RecordingSilence is a stretch of silence detected while recording. Trimmed
+// silences were left out of the audio file, so every later point in the
+// audio happened DurationSeconds later in wall-clock time.
+type RecordingSilence struct {
+	ID              int64     `json:"id"`
+	RecordingID     int64     `json:"recording_id"`
+	OffsetSeconds   float64   `json:"offset_seconds"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Trimmed         bool      `json:"trimmed"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type CreateRecordingSilenceParams struct {
+	RecordingID     int64
+	OffsetSeconds   float64
+	StartedAt       time.Time
+	DurationSeconds float64
+	Trimmed         bool
+}
+
+// RecordingMarker is a bookmark dropped while recording, e.g. at a critical
+// hit or a big reveal
+type RecordingMarker struct {
+	ID            int64     `json:"id"`
+	RecordingID   int64     `json:"recording_id"`
+	OffsetSeconds float64   `json:"offset_seconds"`
+	Label         *string   `json:"label,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CreateRecordingMarkerParams struct {
+	RecordingID   int64
+	OffsetSeconds float64
+	Label         *string
+}
+
+// RecordingTrack is the mono audio of one input channel of a multi-track
+// recording, e.g. one microphone at each end of the table. The recording's
+// own file holds the mixdown of all tracks.
+type RecordingTrack struct {
+	ID            int64     `json:"id"`
+	RecordingID   int64     `json:"recording_id"`
+	Index         int       `json:"index"`
+	Label         *string   `json:"label,omitempty"` // e.g. the microphone's name
+	FilePath      string    `json:"file_path"`
+	FileSizeBytes int64     `json:"file_size_bytes"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CreateRecordingTrackParams struct {
+	RecordingID int64
+	Index       int
+	Label       *string
+	FilePath    string
+}
+
+// RecordingTranscript is the transcription of a recording, and its summary
+// once one was asked for
+type RecordingTranscript struct {
+	RecordingID     int64               `json:"recording_id"`
+	Language        string              `json:"language"`
+	DurationSeconds float64             `json:"duration_seconds"`
+	Text            string              `json:"text"`
+	Segments        []TranscriptSegment `json:"segments"`
+	Summary         *TranscriptSummary  `json:"summary,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+}
+
+// TranscriptSegment is one stretch of speech in a transcript
+type TranscriptSegment struct {
+	Speaker string  `json:"speaker,omitempty"`
+	Text    string  `json:"text"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+}
+
+// TranscriptSummary is the structured summary of a session
+type TranscriptSummary struct {
+	Overview     string   `json:"overview"`
+	KeyEvents    []string `json:"key_events"`
+	NPCs         []string `json:"npcs"`
+	Locations    []string `json:"locations"`
+	Items        []string `json:"items"`
+	Combat       []string `json:"combat"`
+	Decisions    []string `json:"decisions"`
+	Cliffhangers []string `json:"cliffhangers"`
 }
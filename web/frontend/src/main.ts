@@ -3,12 +3,14 @@ import { createRouter, createWebHistory } from 'vue-router'
 import App from './App.vue'
 import RecordingsList from './views/RecordingsList.vue'
 import RecordingDetail from './views/RecordingDetail.vue'
+import RecorderRemote from './views/RecorderRemote.vue'
 
 const router = createRouter({
   history: createWebHistory(),
   routes: [
     { path: '/', component: RecordingsList },
     { path: '/recordings/:id', component: RecordingDetail },
+    { path: '/recorder', component: RecorderRemote },
   ]
 })
 
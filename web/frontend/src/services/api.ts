@@ -14,6 +14,66 @@ export interface Recording {
   completed_at?: string
   transcription_status: 'pending' | 'processing' | 'completed' | 'failed'
   notes?: string
+  device_name?: string
+  codec: string
+  stop_reason?: 'user' | 'low_disk' | 'max_duration' | 'silence'
+  processing?: AudioProcessing
+}
+
+export interface AudioProcessing {
+  gain_db?: number
+  agc?: boolean
+  agc_target_db?: number
+  agc_max_gain_db?: number
+  noise_gate_db?: number
+}
+
+export interface RecordingSilence {
+  id: number
+  recording_id: number
+  offset_seconds: number
+  started_at: string
+  duration_seconds: number
+  trimmed: boolean
+  created_at: string
+}
+
+export interface RecordingMarker {
+  id: number
+  recording_id: number
+  offset_seconds: number
+  label?: string
+  created_at: string
+}
+
+export interface RecordingTrack {
+  id: number
+  recording_id: number
+  index: number
+  label?: string
+  file_path: string
+  file_size_bytes: number
+  created_at: string
+}
+
+export interface RecorderStatus {
+  state: 'idle' | 'recording' | 'paused' | 'stopped' | 'failed'
+  recording_id?: number
+  duration_seconds: number
+  file_size_bytes: number
+  levels: {
+    rms: number
+    peak: number
+    clipping: boolean
+    silent_for_seconds: number
+    dropped_buffers: number
+  }
+  skipping_silence: boolean
+  last_checkpoint_at?: string
+  disk_free_bytes: number
+  disk_low: boolean
+  stop_reason?: 'user' | 'low_disk' | 'max_duration' | 'silence'
+  error?: string
 }
 
 export const api = {
@@ -30,8 +90,46 @@ export const api = {
     return axios.delete(`${API_BASE}/recordings/${id}`)
   },
 
-  getAudioUrl(id: number): string {
-    return `${API_BASE}/recordings/${id}/audio`
+  // Multi-track recordings stream the mixdown unless a track index is given
+  getAudioUrl(id: number, track?: number): string {
+    const url = `${API_BASE}/recordings/${id}/audio`
+    return track === undefined ? url : `${url}?track=${track}`
+  },
+
+  getRecordingTracks(id: number): Promise<AxiosResponse<RecordingTrack[]>> {
+    return axios.get<RecordingTrack[]>(`${API_BASE}/recordings/${id}/tracks`)
+  },
+
+  getRecordingMarkers(id: number): Promise<AxiosResponse<RecordingMarker[]>> {
+    return axios.get<RecordingMarker[]>(`${API_BASE}/recordings/${id}/markers`)
+  },
+
+  getRecordingSilences(id: number): Promise<AxiosResponse<RecordingSilence[]>> {
+    return axios.get<RecordingSilence[]>(`${API_BASE}/recordings/${id}/silences`)
+  },
+
+  // Recorder remote control
+  getRecorderStatus(): Promise<AxiosResponse<RecorderStatus>> {
+    return axios.get<RecorderStatus>(`${API_BASE}/recorder/status`)
+  },
+
+  startRecorder(sessionId?: number, processing?: AudioProcessing): Promise<AxiosResponse<RecorderStatus>> {
+    return axios.post<RecorderStatus>(`${API_BASE}/recorder/start`, {
+      ...(sessionId ? { session_id: sessionId } : {}),
+      ...(processing ? { processing } : {}),
+    })
+  },
+
+  pauseRecorder(): Promise<AxiosResponse<RecorderStatus>> {
+    return axios.post<RecorderStatus>(`${API_BASE}/recorder/pause`, {})
+  },
+
+  resumeRecorder(): Promise<AxiosResponse<RecorderStatus>> {
+    return axios.post<RecorderStatus>(`${API_BASE}/recorder/resume`, {})
+  },
+
+  stopRecorder(): Promise<AxiosResponse<RecorderStatus>> {
+    return axios.post<RecorderStatus>(`${API_BASE}/recorder/stop`, {})
   },
 
   // Health check